@@ -16,11 +16,30 @@ limitations under the License.
 
 package kubernetes
 
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// redacted replaces the value of sensitive fields in ClusterInfo.SafeString().
+const redacted = "<redacted>"
+
 type ClusterInfo struct {
 	// ClusterID is used for unique identification
 	ClusterID string `json:"clusterID"`
+	// Name is a friendly name of the cluster, that is easier to recognize
+	// in logs and events than the ClusterID
+	Name string `json:"name,omitempty"`
 	// Monitors is monitor list for corresponding cluster ID
 	Monitors []string `json:"monitors"`
+	// MonitorPriorities contains the priority of monitors, monitors with a
+	// lower value are listed first
+	MonitorPriorities map[string]int `json:"monitorPriorities,omitempty"`
+	// PreferMsgr2 adds the msgr2 port (3300) instead of the msgr1 port (6789)
+	// to the monitors that do not have a port
+	PreferMsgr2 FlexBool `json:"preferMsgr2,omitempty"`
 	// CephFS contains CephFS specific options
 	CephFS CephFS `json:"cephFS"`
 	// RBD Contains RBD specific options
@@ -29,6 +48,94 @@ type ClusterInfo struct {
 	NFS NFS `json:"nfs"`
 	// Read affinity map options
 	ReadAffinity ReadAffinity `json:"readAffinity"`
+	// ReadBalancing spreads the reads of librbd over the replicas of the
+	// objects, independent of the read affinity
+	ReadBalancing FlexBool `json:"readBalancing,omitempty"`
+	// Namespace is the Kubernetes namespace that contains the secrets for
+	// the cluster
+	Namespace string `json:"namespace,omitempty"`
+	// ReadOnly forces all volumes of the cluster to be published read-only
+	ReadOnly FlexBool `json:"readOnly,omitempty"`
+	// LogLevel is the log verbosity for operations on the cluster, the
+	// verbosity of the driver is used when not set. An explicit 0 lowers
+	// the verbosity for the cluster.
+	LogLevel *FlexInt `json:"logLevel,omitempty"`
+	// LogDir is the directory for the log files of the Ceph clients that
+	// connect to the cluster, the log files are not written when not set
+	LogDir string `json:"cephLogDir,omitempty"`
+	// CephConfFile is the path to a ceph.conf for the cluster, that is used
+	// instead of the ceph.conf that the driver generates
+	CephConfFile string `json:"cephConfFile,omitempty"`
+	// AuthMode is the authentication of the Ceph clients, only "cephx" (the
+	// default) is supported
+	AuthMode string `json:"authMode,omitempty"`
+}
+
+// DeepCopy returns a copy of the ClusterInfo that does not share any slices
+// or maps with the original, so that the copy can be modified safely.
+func (ci ClusterInfo) DeepCopy() ClusterInfo {
+	c := ci
+	c.Monitors = slices.Clone(ci.Monitors)
+	c.MonitorPriorities = maps.Clone(ci.MonitorPriorities)
+	if ci.LogLevel != nil {
+		logLevel := *ci.LogLevel
+		c.LogLevel = &logLevel
+	}
+	c.ReadAffinity.CrushLocationLabels = slices.Clone(ci.ReadAffinity.CrushLocationLabels)
+	c.NFS.Clients = slices.Clone(ci.NFS.Clients)
+
+	c.RBD.TopologyConstrainedPools = slices.Clone(ci.RBD.TopologyConstrainedPools)
+	for i := range c.RBD.TopologyConstrainedPools {
+		pool := &c.RBD.TopologyConstrainedPools[i]
+		pool.DomainSegments = slices.Clone(pool.DomainSegments)
+	}
+
+	return c
+}
+
+// safeClusterInfo is the ClusterInfo that SafeString() renders, with the
+// monitors replaced by their number.
+type safeClusterInfo struct {
+	ClusterInfo
+
+	Monitors int `json:"monitors"`
+}
+
+// SafeString returns a JSON representation of the ClusterInfo for logging.
+//
+// The ClusterInfo does not contain keyring paths or KMS IDs, the keys of the
+// Ceph users are stored in Kubernetes Secrets, and the KMS configuration in a
+// separate ConfigMap. The fields that are treated as sensitive instead are
+// the ones that help to reach or authenticate to the Ceph cluster:
+//   - Monitors, the addresses of the cluster, are summarized by their number.
+//   - MonitorPriorities is dropped, it is keyed by the monitor addresses.
+//   - CephConfFile is redacted, the ceph.conf can refer to a keyring.
+//   - The ClientID of RBD, CephFS and NFS are redacted, they name the Ceph
+//     users that the keys in the Secrets belong to.
+//
+// Redacted fields that are not set are left out, so that it is visible in
+// the log whether they are configured.
+func (ci ClusterInfo) SafeString() string {
+	c := ci.DeepCopy()
+	c.MonitorPriorities = nil
+	redact(&c.CephConfFile)
+	redact(&c.RBD.ClientID)
+	redact(&c.CephFS.ClientID)
+	redact(&c.NFS.ClientID)
+
+	out, err := json.Marshal(safeClusterInfo{ClusterInfo: c, Monitors: len(ci.Monitors)})
+	if err != nil {
+		return fmt.Sprintf(`{"clusterID":%q}`, ci.ClusterID)
+	}
+
+	return string(out)
+}
+
+// redact replaces a non-empty value with the redacted placeholder.
+func redact(value *string) {
+	if *value != "" {
+		*value = redacted
+	}
 }
 
 type CephFS struct {
@@ -42,22 +149,176 @@ type CephFS struct {
 	KernelMountOptions string `json:"kernelMountOptions"`
 	// FuseMountOptions contains the fuse mount options for CephFS volumes
 	FuseMountOptions string `json:"fuseMountOptions"`
+	// ClientID is the Ceph user for CephFS volumes
+	ClientID string `json:"clientID,omitempty"`
+	// FsName is the name of the CephFS filesystem for CephFS volumes
+	FsName string `json:"fsName,omitempty"`
+	// MaxSnapshotsPerVolume is the maximum number of snapshots of a CephFS
+	// volume, 0 means unlimited
+	MaxSnapshotsPerVolume FlexInt `json:"maxSnapshotsPerVolume,omitempty"`
+	// SnapshotRetentionCount is the number of snapshots of a CephFS volume
+	// that are retained, older snapshots can be pruned. 0 means unlimited
+	SnapshotRetentionCount FlexInt `json:"snapshotRetentionCount,omitempty"`
+	// ForceKernelClient refuses the FUSE mounter for CephFS volumes, for
+	// clusters that do not support the features of ceph-fuse
+	ForceKernelClient FlexBool `json:"forceKernelClient,omitempty"`
 }
 type RBD struct {
 	// symlink filepath for the network namespace where we need to execute commands.
 	NetNamespaceFilePath string `json:"netNamespaceFilePath"`
 	// RadosNamespace is a rados namespace in the pool
 	RadosNamespace string `json:"radosNamespace"`
-	// RBD mirror daemons running in the ceph cluster.
-	MirrorDaemonCount int `json:"mirrorDaemonCount"`
+	// RBD mirror daemons running in the ceph cluster, defaults to 1 when
+	// not set.
+	MirrorDaemonCount int `json:"mirrorDaemonCount,omitempty"`
+	// MapOptions contains the map options for RBD volumes, in the same
+	// format as the mapOptions StorageClass parameter
+	MapOptions string `json:"mapOptions,omitempty"`
+	// UnmapOptions contains the unmap options for RBD volumes, in the same
+	// format as the unmapOptions StorageClass parameter
+	UnmapOptions string `json:"unmapOptions,omitempty"`
+	// DefaultImageFeatures is a comma separated list of the image features
+	// for RBD volumes, when the StorageClass does not set imageFeatures
+	DefaultImageFeatures string `json:"defaultImageFeatures,omitempty"`
+	// DefaultPool is the pool for RBD volumes, when the StorageClass does
+	// not set a pool and no topology constrained pool matches
+	DefaultPool string `json:"defaultPool,omitempty"`
+	// MetadataPool is the pool for the CSI OMAP objects of RBD volumes,
+	// the pool of the image is used when not set
+	MetadataPool string `json:"metadataPool,omitempty"`
+	// Mounter is the mounter for RBD volumes ("rbd" or "rbd-nbd"), when the
+	// StorageClass does not set the mounter
+	Mounter string `json:"mounter,omitempty"`
+	// ClientID is the Ceph user for RBD volumes
+	ClientID string `json:"clientID,omitempty"`
+	// TopologyConstrainedPools contains the pools for topology aware
+	// provisioning, when the StorageClass does not set topologyConstrainedPools
+	TopologyConstrainedPools []TopologyPool `json:"topologyConstrainedPools,omitempty"`
+	// MaxSnapshotsPerVolume is the maximum number of snapshots of a RBD
+	// volume, 0 means unlimited
+	MaxSnapshotsPerVolume FlexInt `json:"maxSnapshotsPerVolume,omitempty"`
+	// StripeUnit is the stripe unit in bytes for new RBD images, when the
+	// StorageClass does not set stripeUnit and stripeCount
+	StripeUnit FlexInt `json:"stripeUnit,omitempty"`
+	// StripeCount is the number of objects to stripe over for new RBD
+	// images, when the StorageClass does not set stripeUnit and stripeCount
+	StripeCount FlexInt `json:"stripeCount,omitempty"`
+	// MaxCloneDepth is the number of nested clones of a RBD image after
+	// which the image is flattened, the default is used when not set
+	MaxCloneDepth FlexInt `json:"maxCloneDepth,omitempty"`
+
+	// zeroMirrorDaemonCount is set when the parsed JSON contains a
+	// mirrorDaemonCount of 0, which is not the same as an unset count.
+	zeroMirrorDaemonCount bool
+}
+
+// HasMirrorDaemonCount returns true when the MirrorDaemonCount is set,
+// including a mirrorDaemonCount of 0 in the parsed JSON.
+func (rbd RBD) HasMirrorDaemonCount() bool {
+	return rbd.MirrorDaemonCount != 0 || rbd.zeroMirrorDaemonCount
+}
+
+// UnmarshalJSON parses the RBD options, and records whether the
+// mirrorDaemonCount is set. Like the FlexInt fields, the mirrorDaemonCount
+// can be a quoted number.
+func (rbd *RBD) UnmarshalJSON(data []byte) error {
+	// plainRBD does not have the UnmarshalJSON method of RBD
+	type plainRBD RBD
+	aux := struct {
+		*plainRBD
+		MirrorDaemonCount *FlexInt `json:"mirrorDaemonCount"`
+	}{
+		plainRBD: (*plainRBD)(rbd),
+	}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	if aux.MirrorDaemonCount != nil {
+		rbd.MirrorDaemonCount = int(*aux.MirrorDaemonCount)
+		rbd.zeroMirrorDaemonCount = rbd.MirrorDaemonCount == 0
+	}
+
+	return nil
+}
+
+// MarshalJSON returns the RBD options as JSON, a mirrorDaemonCount of 0 is
+// only included when it was set in the parsed JSON.
+func (rbd RBD) MarshalJSON() ([]byte, error) {
+	type plainRBD RBD
+	aux := struct {
+		plainRBD
+		MirrorDaemonCount *int `json:"mirrorDaemonCount,omitempty"`
+	}{
+		plainRBD: plainRBD(rbd),
+	}
+	if rbd.HasMirrorDaemonCount() {
+		aux.MirrorDaemonCount = &rbd.MirrorDaemonCount
+	}
+
+	return json.Marshal(aux)
+}
+
+// TopologyPool is a pool that is used for volumes in the topology domain
+// that matches all DomainSegments.
+type TopologyPool struct {
+	// PoolName is the name of the pool for the RBD images
+	PoolName string `json:"poolName"`
+	// DataPoolName is the name of the optional data pool for the RBD images
+	DataPoolName string `json:"dataPool"`
+	// DomainSegments are the topology domain labels and values of the pool
+	DomainSegments []TopologySegment `json:"domainSegments"`
+}
+
+// TopologySegment is a topology domain label with its value.
+type TopologySegment struct {
+	DomainLabel string `json:"domainLabel"`
+	DomainValue string `json:"value"`
 }
 
 type NFS struct {
 	// symlink filepath for the network namespace where we need to execute commands.
 	NetNamespaceFilePath string `json:"netNamespaceFilePath"`
+	// ClientID is the Ceph user for NFS volumes
+	ClientID string `json:"clientID,omitempty"`
+	// Squash is the user-id squashing of new exports ("none", "root",
+	// "rootid" or "all"), defaults to "none"
+	Squash string `json:"squash,omitempty"`
+	// AccessType is the access of the clients to new exports ("RW" or
+	// "RO"), defaults to "RW"
+	AccessType string `json:"accessType,omitempty"`
+	// Clients are the addresses of the clients that may access new exports,
+	// when the StorageClass does not set clients
+	Clients []string `json:"clients,omitempty"`
 }
 
 type ReadAffinity struct {
 	Enabled             bool     `json:"enabled"`
 	CrushLocationLabels []string `json:"crushLocationLabels"`
 }
+
+// UnmarshalJSON parses the read affinity options. Like the FlexBool fields,
+// enabled can be a quoted bool.
+func (ra *ReadAffinity) UnmarshalJSON(data []byte) error {
+	// plainReadAffinity does not have the UnmarshalJSON method of ReadAffinity
+	type plainReadAffinity ReadAffinity
+	aux := struct {
+		*plainReadAffinity
+		Enabled *FlexBool `json:"enabled"`
+	}{
+		plainReadAffinity: (*plainReadAffinity)(ra),
+	}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	if aux.Enabled != nil {
+		ra.Enabled = bool(*aux.Enabled)
+	}
+
+	return nil
+}
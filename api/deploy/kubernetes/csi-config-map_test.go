@@ -0,0 +1,123 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClusterInfo() ClusterInfo {
+	return ClusterInfo{
+		ClusterID:         "cluster-1",
+		Monitors:          []string{"mon1", "mon2"},
+		MonitorPriorities: map[string]int{"mon1": 1, "mon2": 2},
+		RBD: RBD{
+			RadosNamespace:    "rbd-ns",
+			MirrorDaemonCount: 2,
+			TopologyConstrainedPools: []TopologyPool{
+				{
+					PoolName: "pool-a",
+					DomainSegments: []TopologySegment{
+						{DomainLabel: "zone", DomainValue: "zone-a"},
+					},
+				},
+			},
+		},
+		NFS: NFS{
+			Clients: []string{"192.168.0.0/16"},
+		},
+		ReadAffinity: ReadAffinity{
+			Enabled:             true,
+			CrushLocationLabels: []string{"zone", "rack"},
+		},
+	}
+}
+
+func TestClusterInfoDeepCopy(t *testing.T) {
+	t.Parallel()
+
+	original := newTestClusterInfo()
+	cp := original.DeepCopy()
+	require.Equal(t, original, cp)
+
+	cp.ClusterID = "cluster-2"
+	cp.Monitors[0] = "mon3"
+	cp.Monitors = append(cp.Monitors, "mon4")
+	cp.MonitorPriorities["mon1"] = 5
+	cp.RBD.RadosNamespace = "other-ns"
+	cp.RBD.TopologyConstrainedPools[0].PoolName = "pool-b"
+	cp.RBD.TopologyConstrainedPools[0].DomainSegments[0].DomainValue = "zone-b"
+	cp.ReadAffinity.Enabled = false
+	cp.ReadAffinity.CrushLocationLabels[0] = "host"
+	cp.NFS.Clients[0] = "10.0.0.0/8"
+
+	require.Equal(t, newTestClusterInfo(), original)
+}
+
+func TestClusterInfoDeepCopyEmpty(t *testing.T) {
+	t.Parallel()
+
+	cp := ClusterInfo{}.DeepCopy()
+	require.Equal(t, ClusterInfo{}, cp)
+}
+
+func TestClusterInfoSafeString(t *testing.T) {
+	t.Parallel()
+
+	ci := newTestClusterInfo()
+	ci.Name = "production"
+	ci.Monitors = []string{"10.0.0.1:6789", "10.0.0.2:6789", "10.0.0.3:6789"}
+	ci.MonitorPriorities = map[string]int{"10.0.0.4:6789": 1}
+	ci.CephConfFile = "/etc/ceph-cluster-1/ceph.conf"
+	ci.RBD.ClientID = "csi-rbd-node"
+	ci.CephFS.ClientID = "csi-cephfs-node"
+	ci.Namespace = "rook-ceph"
+	ci.LogDir = "/var/log/ceph-cluster-1"
+
+	// the monitor addresses, the ceph.conf and the Ceph users are sensitive
+	out := ci.SafeString()
+	for _, sensitive := range []string{"10.0.0.1", "10.0.0.4", "ceph.conf", "csi-rbd-node", "csi-cephfs-node"} {
+		require.NotContains(t, out, sensitive)
+	}
+
+	var rendered map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out), &rendered))
+	require.Equal(t, "cluster-1", rendered["clusterID"])
+	require.Equal(t, "production", rendered["name"])
+	require.Equal(t, "rook-ceph", rendered["namespace"])
+	require.Equal(t, "/var/log/ceph-cluster-1", rendered["cephLogDir"])
+	require.InDelta(t, 3, rendered["monitors"], 0)
+	require.Equal(t, redacted, rendered["cephConfFile"])
+	require.Nil(t, rendered["monitorPriorities"])
+
+	rbd, ok := rendered["rbd"].(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, redacted, rbd["clientID"])
+	require.Equal(t, "rbd-ns", rbd["radosNamespace"])
+
+	// unset sensitive fields stay empty, so it is visible that they are unset
+	nfs, ok := rendered["nfs"].(map[string]any)
+	require.True(t, ok)
+	require.Empty(t, nfs["clientID"])
+
+	// the ClusterInfo itself is not modified
+	require.Equal(t, "csi-rbd-node", ci.RBD.ClientID)
+	require.Len(t, ci.Monitors, 3)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// FlexInt is an int that can be set in JSON as a number (2) or as a string
+// that contains a number ("2"). Configurations that are generated from
+// templates often contain quoted numbers.
+type FlexInt int
+
+// UnmarshalJSON parses a number or a quoted number.
+func (fi *FlexInt) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		data = []byte(s)
+	}
+
+	i, err := strconv.Atoi(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid integer %s: %w", data, err)
+	}
+	*fi = FlexInt(i)
+
+	return nil
+}
+
+// FlexBool is a bool that can be set in JSON as a bool (true) or as a string
+// that contains a bool ("true").
+type FlexBool bool
+
+// UnmarshalJSON parses a bool or a quoted bool.
+func (fb *FlexBool) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		data = []byte(s)
+	}
+
+	b, err := strconv.ParseBool(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid bool %s: %w", data, err)
+	}
+	*fb = FlexBool(b)
+
+	return nil
+}
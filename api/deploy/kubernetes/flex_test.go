@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlexInt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		json    string
+		want    FlexInt
+		wantErr bool
+	}{
+		{name: "number", json: `2`, want: 2},
+		{name: "negative number", json: `-1`, want: -1},
+		{name: "quoted number", json: `"2"`, want: 2},
+		{name: "null", json: `null`, want: 0},
+		{name: "bool", json: `true`, wantErr: true},
+		{name: "quoted bool", json: `"true"`, wantErr: true},
+		{name: "float", json: `2.5`, wantErr: true},
+		{name: "empty string", json: `""`, wantErr: true},
+		{name: "malformed", json: `"two"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got FlexInt
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		json    string
+		want    FlexBool
+		wantErr bool
+	}{
+		{name: "bool", json: `true`, want: true},
+		{name: "false", json: `false`, want: false},
+		{name: "quoted bool", json: `"true"`, want: true},
+		{name: "quoted false", json: `"false"`, want: false},
+		{name: "null", json: `null`, want: false},
+		{name: "number", json: `2`, wantErr: true},
+		{name: "quoted number", json: `"2"`, wantErr: true},
+		{name: "empty string", json: `""`, wantErr: true},
+		{name: "malformed", json: `"yes"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got FlexBool
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClusterInfoFlexFields(t *testing.T) {
+	t.Parallel()
+
+	config := `{
+		"clusterID": "cluster-1",
+		"preferMsgr2": "true",
+		"readOnly": true,
+		"logLevel": "5",
+		"readAffinity": {"enabled": "true"},
+		"rbd": {"mirrorDaemonCount": "2", "maxSnapshotsPerVolume": 10, "stripeUnit": "65536", "stripeCount": 4},
+		"cephFS": {"maxSnapshotsPerVolume": "20"}
+	}`
+
+	var ci ClusterInfo
+	require.NoError(t, json.Unmarshal([]byte(config), &ci))
+	require.True(t, bool(ci.PreferMsgr2))
+	require.True(t, bool(ci.ReadOnly))
+	require.NotNil(t, ci.LogLevel)
+	require.Equal(t, FlexInt(5), *ci.LogLevel)
+	require.True(t, ci.ReadAffinity.Enabled)
+	require.Equal(t, 2, ci.RBD.MirrorDaemonCount)
+	require.Equal(t, FlexInt(10), ci.RBD.MaxSnapshotsPerVolume)
+	require.Equal(t, FlexInt(65536), ci.RBD.StripeUnit)
+	require.Equal(t, FlexInt(4), ci.RBD.StripeCount)
+	require.Equal(t, FlexInt(20), ci.CephFS.MaxSnapshotsPerVolume)
+
+	// the values are written as native JSON types
+	content, err := json.Marshal(ci.RBD)
+	require.NoError(t, err)
+	require.Contains(t, string(content), `"mirrorDaemonCount":2`)
+
+	// an explicit 0 is kept apart from an unset count
+	var rbd RBD
+	require.NoError(t, json.Unmarshal([]byte(`{"mirrorDaemonCount": 0}`), &rbd))
+	require.True(t, rbd.HasMirrorDaemonCount())
+	require.Zero(t, rbd.MirrorDaemonCount)
+	content, err = json.Marshal(rbd)
+	require.NoError(t, err)
+	require.Contains(t, string(content), `"mirrorDaemonCount":0`)
+
+	rbd = RBD{}
+	require.NoError(t, json.Unmarshal([]byte(`{"radosNamespace": "ns"}`), &rbd))
+	require.False(t, rbd.HasMirrorDaemonCount())
+	content, err = json.Marshal(rbd)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "mirrorDaemonCount")
+
+	// an explicit log level of 0 overrides the verbosity of the driver
+	ci = ClusterInfo{}
+	require.NoError(t, json.Unmarshal([]byte(`{"logLevel": "0"}`), &ci))
+	require.NotNil(t, ci.LogLevel)
+	require.Zero(t, *ci.LogLevel)
+	content, err = json.Marshal(ci)
+	require.NoError(t, err)
+	require.Contains(t, string(content), `"logLevel":0`)
+	require.NotSame(t, ci.LogLevel, ci.DeepCopy().LogLevel)
+
+	err = json.Unmarshal([]byte(`{"logLevel": "high"}`), &ci)
+	require.Error(t, err)
+	err = json.Unmarshal([]byte(`{"readAffinity": {"enabled": "yes"}}`), &ci)
+	require.Error(t, err)
+	err = json.Unmarshal([]byte(`{"rbd": {"mirrorDaemonCount": "two"}}`), &ci)
+	require.Error(t, err)
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -88,6 +90,26 @@ func init() {
 		"",
 		"list of Kubernetes node labels, that determines the"+
 			" CRUSH location the node belongs to, separated by ','")
+	flag.BoolVar(
+		&conf.ExpandConfigPaths,
+		"expand-config-paths",
+		false,
+		"expand environment variables in the paths of the CSI config")
+	flag.BoolVar(
+		&conf.StrictConfigPaths,
+		"strict-config-paths",
+		false,
+		"fail the expansion of paths of the CSI config that reference unset environment variables")
+	flag.BoolVar(
+		&conf.ValidateCephConf,
+		"validate-ceph-conf-file",
+		false,
+		"fail when the cephConfFile of a cluster in the CSI config does not exist")
+	flag.BoolVar(
+		&conf.WatchCSIConfig,
+		"watch-csi-config",
+		true,
+		"cache the CSI config, and reload it when the file changes")
 
 	// cephfs related flags
 	flag.BoolVar(
@@ -129,7 +151,7 @@ func init() {
 	flag.UintVar(
 		&conf.RbdHardMaxCloneDepth,
 		"rbdhardmaxclonedepth",
-		8,
+		util.DefaultRBDMaxCloneDepth,
 		"Hard limit for maximum number of nested volume clones that are taken before a flatten occurs")
 	flag.UintVar(
 		&conf.RbdSoftMaxCloneDepth,
@@ -226,6 +248,12 @@ func main() {
 		}
 	}
 
+	util.SetConfigPathExpansion(conf.ExpandConfigPaths, conf.StrictConfigPaths)
+	util.SetCephConfFileValidation(conf.ValidateCephConf)
+	lintCSIConfig()
+	validateReadAffinity(&conf)
+	watchCSIConfig(&conf)
+
 	if err = util.WriteCephConfig(); err != nil {
 		log.FatalLogMsg("failed to write ceph configuration file (%v)", err)
 	}
@@ -296,6 +324,64 @@ func initControllers() {
 	persistentvolume.Init()
 }
 
+// watchCSIConfig caches the CSI config and reloads it on changes, unless the
+// --watch-csi-config flag is disabled. The config is read from the file on
+// every access when watching fails.
+func watchCSIConfig(conf *util.Config) {
+	if !conf.WatchCSIConfig {
+		return
+	}
+
+	err := util.WatchCSIConfig(context.Background(), util.CsiConfigFile)
+	if err != nil {
+		log.WarningLogMsg("failed to watch the CSI config, it is not cached: %v", err)
+	}
+}
+
+// lintCSIConfig logs the issues that are found in the CSI config. The config
+// is optional for some driver types, so a missing config is not reported.
+func lintCSIConfig() {
+	issues, err := util.LintCSIConfig(util.CsiConfigFile)
+	if err != nil {
+		log.DebugLogMsg("skipping the check of the CSI config: %v", err)
+
+		return
+	}
+
+	for _, issue := range issues {
+		if issue.Severity == util.LintError {
+			log.ErrorLogMsg("CSI config %s", issue)
+		} else {
+			log.WarningLogMsg("CSI config %s", issue)
+		}
+	}
+}
+
+// validateReadAffinity exits when read affinity is enabled for a cluster in
+// the CSI config of a node plugin, and no crush location labels are configured
+// for it, or set on the command line. The config is optional for some driver
+// types, so a missing config is not reported.
+func validateReadAffinity(conf *util.Config) {
+	if !conf.IsNodeServer || (conf.Vtype != rbdType && conf.Vtype != cephFSType) {
+		return
+	}
+
+	cliCrushLocationLabels := ""
+	if conf.EnableReadAffinity {
+		cliCrushLocationLabels = conf.CrushLocationLabels
+	}
+
+	err := util.ValidateReadAffinityConfig(util.CsiConfigFile, cliCrushLocationLabels)
+	if errors.Is(err, os.ErrNotExist) {
+		log.DebugLogMsg("skipping the check of the read affinity options: %v", err)
+
+		return
+	}
+	if err != nil {
+		logAndExit(err.Error())
+	}
+}
+
 func validateCloneDepthFlag(conf *util.Config) {
 	// keeping hardlimit to 14 as max to avoid max image depth
 	if conf.RbdHardMaxCloneDepth == 0 || conf.RbdHardMaxCloneDepth > 14 {
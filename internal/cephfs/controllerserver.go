@@ -873,6 +873,11 @@ func (cs *ControllerServer) CreateSnapshot(
 		}, nil
 	}
 
+	err = checkSnapshotLimit(ctx, volClient, parentVolOptions.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Reservation
 	sID, err := store.ReserveSnap(ctx, parentVolOptions, vid.FsSubvolName, cephfsSnap, cr)
 	if err != nil {
@@ -911,6 +916,32 @@ func (cs *ControllerServer) CreateSnapshot(
 	}, nil
 }
 
+// checkSnapshotLimit returns a ResourceExhausted error when the subvolume
+// already has the maximum number of snapshots that is configured for the
+// cluster.
+func checkSnapshotLimit(ctx context.Context, volClient core.SubVolumeClient, clusterID string) error {
+	maxSnapshots, err := util.GetCephFSMaxSnapshotsPerVolume(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if maxSnapshots == 0 {
+		return nil
+	}
+
+	snaps, err := volClient.ListSnapshots(ctx)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if len(snaps) >= maxSnapshots {
+		return status.Errorf(codes.ResourceExhausted,
+			"volume has %d snapshots, the maximum for cluster %q is %d", len(snaps), clusterID, maxSnapshots)
+	}
+
+	return nil
+}
+
 func (cs *ControllerServer) doSnapshot(
 	ctx context.Context,
 	volOpt *store.VolumeOptions,
@@ -39,6 +39,9 @@ type SnapshotClient interface {
 	DeleteSnapshot(ctx context.Context) error
 	// GetSnapshotInfo returns the snapshot info of the subvolume.
 	GetSnapshotInfo(ctx context.Context) (SnapshotInfo, error)
+	// GetQuotaUsage returns the number of bytes that are referenced by the
+	// snapshot of the subvolume.
+	GetQuotaUsage(ctx context.Context) (int64, error)
 	// CloneSnapshot clones the snapshot of the subvolume.
 	CloneSnapshot(ctx context.Context, cloneVolOptions *SubVolume) error
 	// SetAllSnapshotMetadata set all the metadata from arg parameters on
@@ -129,6 +132,18 @@ type SnapshotInfo struct {
 	CreatedAt        time.Time
 	CreationTime     *timestamp.Timestamp
 	HasPendingClones string
+	// Size is the recursive size of the snapshot as reported by CephFS.
+	Size int64
+}
+
+// newSnapshotInfo converts the subvolume snapshot info that is returned by
+// the CephFS admin API to a SnapshotInfo.
+func newSnapshotInfo(info *admin.SubVolumeSnapshotInfo) SnapshotInfo {
+	return SnapshotInfo{
+		CreatedAt:        info.CreatedAt.Time,
+		HasPendingClones: info.HasPendingClones,
+		Size:             int64(info.Size),
+	}
 }
 
 // GetSnapshotInfo returns the snapshot info of the subvolume.
@@ -156,10 +171,23 @@ func (s *snapshotClient) GetSnapshotInfo(ctx context.Context) (SnapshotInfo, err
 
 		return snap, err
 	}
-	snap.CreatedAt = info.CreatedAt.Time
-	snap.HasPendingClones = info.HasPendingClones
 
-	return snap, nil
+	return newSnapshotInfo(info), nil
+}
+
+// GetQuotaUsage returns the number of bytes that are referenced by the
+// snapshot, from the CephFS snapshot info. CephFS does not track the data
+// that a snapshot shares with the subvolume, so unlike the RBD usage, this
+// includes the shared data and is an upper bound of the space that the
+// snapshot consumes. The snapshot info is cheap to get, there is no
+// separate exact calculation.
+func (s *snapshotClient) GetQuotaUsage(ctx context.Context) (int64, error) {
+	info, err := s.GetSnapshotInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size, nil
 }
 
 // CloneSnapshot clones the snapshot of the subvolume.
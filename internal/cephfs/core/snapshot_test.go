@@ -0,0 +1,40 @@
+/*
+Copyright 2026 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	fsa "github.com/ceph/go-ceph/cephfs/admin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSnapshotInfo(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2026, time.March, 4, 12, 30, 0, 0, time.UTC)
+	info := newSnapshotInfo(&fsa.SubVolumeSnapshotInfo{
+		CreatedAt:        fsa.TimeStamp{Time: created},
+		HasPendingClones: "no",
+		Size:             10 * 1024 * 1024,
+	})
+
+	require.Equal(t, created, info.CreatedAt)
+	require.Equal(t, "no", info.HasPendingClones)
+	require.Equal(t, int64(10*1024*1024), info.Size)
+}
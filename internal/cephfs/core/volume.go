@@ -80,6 +80,8 @@ type SubVolumeClient interface {
 	CreateCloneFromSnapshot(ctx context.Context, snap Snapshot) error
 	// CleanupSnapshotFromSubvolume removes the snapshot from the subvolume.
 	CleanupSnapshotFromSubvolume(ctx context.Context, parentVol *SubVolume) error
+	// ListSnapshots returns the names of the snapshots of the subvolume.
+	ListSnapshots(ctx context.Context) ([]string, error)
 
 	// SetAllMetadata set all the metadata from arg parameters on Ssubvolume.
 	SetAllMetadata(parameters map[string]string) error
@@ -150,6 +152,28 @@ func (s *subVolumeClient) GetVolumeRootPathCeph(ctx context.Context) (string, er
 	return svPath, nil
 }
 
+// ListSnapshots returns the names of the snapshots of the subvolume.
+func (s *subVolumeClient) ListSnapshots(ctx context.Context) ([]string, error) {
+	fsa, err := s.conn.GetFSAdmin()
+	if err != nil {
+		log.ErrorLog(ctx, "could not get FSAdmin, can not list snapshots of %s: %v", s.VolID, err)
+
+		return nil, err
+	}
+
+	snaps, err := fsa.ListSubVolumeSnapshots(s.FsName, s.SubvolumeGroup, s.VolID)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to list snapshots of the vol %s: %v", s.VolID, err)
+		if errors.Is(err, rados.ErrNotFound) {
+			return nil, cerrors.ErrVolumeNotFound
+		}
+
+		return nil, err
+	}
+
+	return snaps, nil
+}
+
 // GetSubVolumeInfo returns the subvolume information.
 func (s *subVolumeClient) GetSubVolumeInfo(ctx context.Context) (*Subvolume, error) {
 	fsa, err := s.conn.GetFSAdmin()
@@ -526,6 +526,7 @@ func getFsNamesAndSubVolumeFromVolumeIDs(ctx context.Context,
 		volumes               []core.Volume
 		subVolumeGroupMapping map[string][]string
 		monitors              string
+		clusterID             string
 	}
 	fm := make(map[string]fs, 0)
 	for _, volID := range volIDs {
@@ -546,6 +547,7 @@ func getFsNamesAndSubVolumeFromVolumeIDs(ctx context.Context,
 				volumes:               make([]core.Volume, 0),
 				subVolumeGroupMapping: make(map[string][]string), // Initialize the map
 				monitors:              volOptions.Monitors,
+				clusterID:             volOptions.ClusterID,
 			}
 		}
 		a := core.Volume{
@@ -570,7 +572,7 @@ func getFsNamesAndSubVolumeFromVolumeIDs(ctx context.Context,
 	}()
 	for k, v := range fm {
 		conn := &util.ClusterConnection{}
-		if err = conn.Connect(v.monitors, cr); err != nil {
+		if err = conn.Connect(v.clusterID, v.monitors, cr); err != nil {
 			return nil, err
 		}
 		fsk[k], err = core.NewFSQuiesce(v.fsName, v.volumes, v.subVolumeGroupMapping, conn)
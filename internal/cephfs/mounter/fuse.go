@@ -48,10 +48,15 @@ var (
 type FuseMounter struct{}
 
 func mountFuse(ctx context.Context, mountPoint string, cr *util.Credentials, volOptions *store.VolumeOptions) error {
+	confFile, err := util.GetEffectiveCephConfFile(util.CsiConfigFile, volOptions.ClusterID, volOptions.Monitors)
+	if err != nil {
+		return err
+	}
+
 	args := []string{
 		mountPoint,
 		"-m", volOptions.Monitors,
-		"-c", util.CephConfigPath,
+		"-c", confFile,
 		"-n", cephEntityClientPrefix + cr.ID, "--keyfile=" + cr.KeyFile,
 		"-r", volOptions.RootPath,
 	}
@@ -65,15 +70,19 @@ func mountFuse(ctx context.Context, mountPoint string, cr *util.Credentials, vol
 	if volOptions.FsName != "" {
 		args = append(args, "--client_mds_namespace="+volOptions.FsName)
 	}
-	var (
-		stderr string
-		err    error
-	)
+	var stderr string
 
 	if volOptions.NetNamespaceFilePath != "" {
 		_, stderr, err = util.ExecuteCommandWithNSEnter(ctx, volOptions.NetNamespaceFilePath, "ceph-fuse", args[:]...)
 	} else {
-		_, stderr, err = util.ExecCommand(ctx, "ceph-fuse", args[:]...)
+		var logDir string
+		logDir, err = util.GetClusterLogDir(util.CsiConfigFile, volOptions.ClusterID)
+		if err != nil {
+			return err
+		}
+
+		env := util.CephLogEnv(logDir, "ceph-fuse-"+volOptions.ClusterID)
+		_, stderr, err = util.ExecCommandWithEnv(ctx, env, "ceph-fuse", args[:]...)
 	}
 
 	if err != nil {
@@ -250,6 +250,13 @@ func (ns *NodeServer) NodeStageVolume(
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	err = checkForceKernelClient(mnt, volOptions, util.CsiConfigFile)
+	if err != nil {
+		log.ErrorLog(ctx, "cannot stage volume %s: %v", volID, err)
+
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
 	err = maybeInitializeFileEncryption(ctx, mnt, volOptions)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -826,6 +833,27 @@ func (ns *NodeServer) NodeGetVolumeStats(
 	return nil, status.Errorf(codes.InvalidArgument, "targetpath %q is not a directory or device", targetPath)
 }
 
+// checkForceKernelClient returns an error when mnt is the FUSE mounter, and
+// the cluster of the volume sets cephFS.forceKernelClient in the CSI config
+// file. Pre-provisioned volumes without clusterID are not checked.
+func checkForceKernelClient(mnt mounter.VolumeMounter, volOptions *store.VolumeOptions, csiConfigFile string) error {
+	if _, isFuse := mnt.(*mounter.FuseMounter); !isFuse || volOptions.ClusterID == "" {
+		return nil
+	}
+
+	force, err := util.GetCephFSForceKernelClient(csiConfigFile, volOptions.ClusterID)
+	if err != nil {
+		return err
+	}
+	if force {
+		return fmt.Errorf("cluster %q only allows the kernel client (cephFS.forceKernelClient), "+
+			"but the volume would be mounted with %s (requested mounter %q)",
+			volOptions.ClusterID, mnt.Name(), volOptions.Mounter)
+	}
+
+	return nil
+}
+
 // setMountOptions updates the kernel/fuse mount options from CSI config file if it exists.
 // If not, it falls back to returning the kernelMountOptions/fuseMountOptions from the command line.
 func (ns *NodeServer) setMountOptions(
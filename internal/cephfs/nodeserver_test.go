@@ -169,3 +169,73 @@ func Test_setMountOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckForceKernelClient(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "forced",
+			CephFS:    cephcsi.CephFS{ForceKernelClient: true},
+		},
+		{
+			ClusterID: "not-forced",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", tmpConfPath, err)
+	}
+
+	tests := []struct {
+		name      string
+		mnt       mounter.VolumeMounter
+		clusterID string
+		wantErr   bool
+	}{
+		{
+			name:      "fuse refused when forced",
+			mnt:       &mounter.FuseMounter{},
+			clusterID: "forced",
+			wantErr:   true,
+		},
+		{
+			name:      "kernel allowed when forced",
+			mnt:       mounter.NewKernelMounter(),
+			clusterID: "forced",
+		},
+		{
+			name:      "fuse allowed when not forced",
+			mnt:       &mounter.FuseMounter{},
+			clusterID: "not-forced",
+		},
+		{
+			name: "pre-provisioned volume without clusterID",
+			mnt:  &mounter.FuseMounter{},
+		},
+		{
+			name:      "unknown cluster",
+			mnt:       &mounter.FuseMounter{},
+			clusterID: "unknown",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			volOptions := &store.VolumeOptions{
+				ClusterID: tt.clusterID,
+				Mounter:   "fuse",
+			}
+			err := checkForceKernelClient(tt.mnt, volOptions, tmpConfPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkForceKernelClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -81,7 +81,7 @@ func (vo *VolumeOptions) Connect(cr *util.Credentials) error {
 	}
 
 	conn := &util.ClusterConnection{}
-	if err := conn.Connect(vo.Monitors, cr); err != nil {
+	if err := conn.Connect(vo.ClusterID, vo.Monitors, cr); err != nil {
 		return err
 	}
 
@@ -201,12 +201,20 @@ func GetClusterInformation(options map[string]string) (*cephcsi.ClusterInfo, err
 
 		return nil, err
 	}
+
+	fsName, err := util.GetCephFSFsName(util.CsiConfigFile, clusterID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch fsName using clusterID (%s): %w", clusterID, err)
+
+		return nil, err
+	}
 	clusterData := &cephcsi.ClusterInfo{
 		ClusterID: clusterID,
 		Monitors:  strings.Split(monitors, ","),
 	}
 	clusterData.CephFS.SubvolumeGroup = subvolumeGroup
 	clusterData.CephFS.RadosNamespace = radosNamespace
+	clusterData.CephFS.FsName = fsName
 
 	return clusterData, nil
 }
@@ -226,7 +234,7 @@ func fmtBackingSnapshotOptionMismatch(optName, expected, actual string) error {
 // It contains the following checks:
 // - clusterID must be set
 // - monitors must be set
-// - fsName must be set.
+// - fsName must be set, either in the parameters or in the cluster config.
 func getVolumeOptions(vo map[string]string) (*VolumeOptions, error) {
 	opts := VolumeOptions{}
 	clusterData, err := GetClusterInformation(vo)
@@ -238,8 +246,14 @@ func getVolumeOptions(vo map[string]string) (*VolumeOptions, error) {
 	opts.Monitors = strings.Join(clusterData.Monitors, ",")
 	opts.SubvolumeGroup = clusterData.CephFS.SubvolumeGroup
 	opts.RadosNamespace = clusterData.CephFS.RadosNamespace
+	opts.FsName = clusterData.CephFS.FsName
 
-	if err = extractOption(&opts.FsName, "fsName", vo); err != nil {
+	if opts.FsName == "" {
+		err = extractOption(&opts.FsName, "fsName", vo)
+	} else {
+		err = extractOptionalOption(&opts.FsName, "fsName", vo)
+	}
+	if err != nil {
 		return nil, err
 	}
 
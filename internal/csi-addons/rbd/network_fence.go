@@ -139,7 +139,7 @@ func (fcs *FenceControllerServer) GetFenceClients(
 
 	// Get the cluster ID of the ceph cluster.
 	conn := &util.ClusterConnection{}
-	err = conn.Connect(monitors, cr)
+	err = conn.Connect(clusterID, monitors, cr)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to connect to MONs %q: %s", monitors, err)
 	}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
@@ -162,6 +163,10 @@ type Config struct {
 	// backingSnapshotIDKey ID of the snapshot on which the CephFS snapshot-backed volume is based
 	backingSnapshotIDKey string
 
+	// csiCreationTimeKey is the key for the time a snapshot was created,
+	// it is only set for snapshots
+	csiCreationTimeKey string
+
 	// commonPrefix is the prefix common to all omap keys for this Config
 	commonPrefix string
 }
@@ -203,6 +208,7 @@ func NewCSISnapshotJournal(suffix string) *Config {
 		encryptKMSKey:           "csi.volume.encryptKMS",
 		encryptionType:          "csi.volume.encryptionType",
 		ownerKey:                "csi.volume.owner",
+		csiCreationTimeKey:      "csi.creationtime",
 		commonPrefix:            "csi.",
 	}
 }
@@ -261,7 +267,7 @@ type Connection struct {
 func (cj *Config) Connect(monitors, namespace string, cr *util.Credentials) (*Connection, error) {
 	cj.namespace = namespace
 	cc := &util.ClusterConnection{}
-	if err := cc.Connect(monitors, cr); err != nil {
+	if err := cc.Connect("", monitors, cr); err != nil {
 		return nil, fmt.Errorf("failed to establish the connection: %w", err)
 	}
 	conn := &Connection{
@@ -695,6 +701,7 @@ type ImageAttributes struct {
 	GroupID           string              // Contains the group id of the image
 	JournalPoolID     int64               // Pool ID of the CSI journal pool, stored in big endian format (on-disk data)
 	BackingSnapshotID string              // ID of the snapshot on which the CephFS snapshot-backed volume is based
+	CreationTime      *time.Time          // Time the snapshot was created, if it was stored
 }
 
 // GetImageAttributes fetches all keys and their values, from a UUID directory, returning ImageAttributes structure.
@@ -727,6 +734,9 @@ func (conn *Connection) GetImageAttributes(
 		cj.backingSnapshotIDKey,
 		cj.csiGroupIDKey,
 	}
+	if cj.csiCreationTimeKey != "" {
+		fetchKeys = append(fetchKeys, cj.csiCreationTimeKey)
+	}
 	values, err := getOMapValues(
 		ctx, conn, pool, cj.namespace, cj.cephUUIDDirectoryPrefix+objectUUID,
 		cj.commonPrefix, fetchKeys)
@@ -746,6 +756,14 @@ func (conn *Connection) GetImageAttributes(
 	imageAttributes.BackingSnapshotID = values[cj.backingSnapshotIDKey]
 	imageAttributes.GroupID = values[cj.csiGroupIDKey]
 
+	// the creation time was added at a later point, and is only a cache
+	if creationTime, ok := values[cj.csiCreationTimeKey]; ok {
+		t := &time.Time{}
+		if t.UnmarshalText([]byte(creationTime)) == nil {
+			imageAttributes.CreationTime = t
+		}
+	}
+
 	// image key was added at a later point, so not all volumes will have this
 	// key set when ceph-csi was upgraded
 	imageAttributes.ImageName, found = values[cj.csiImageKey]
@@ -781,6 +799,22 @@ func (conn *Connection) GetImageAttributes(
 	return imageAttributes, nil
 }
 
+// StoreCreationTime stores the time the snapshot was created in omap. It is
+// only supported by the snapshot journal.
+func (conn *Connection) StoreCreationTime(ctx context.Context, pool, reservedUUID string, t time.Time) error {
+	if conn.config.csiCreationTimeKey == "" {
+		return errors.New("invalid request, csiCreationTimeKey is not set")
+	}
+
+	value, err := t.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	return setOMapKeys(ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID,
+		map[string]string{conn.config.csiCreationTimeKey: string(value)})
+}
+
 // StoreImageID stores the image ID in omap.
 func (conn *Connection) StoreImageID(ctx context.Context, pool, reservedUUID, imageID string) error {
 	err := setOMapKeys(ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID,
@@ -815,6 +849,18 @@ func (conn *Connection) StoreGroupID(ctx context.Context, pool, reservedUUID, gr
 	return nil
 }
 
+// RemoveGroupID removes the groupID from omap. Removing a groupID that is
+// not set is not an error.
+func (conn *Connection) RemoveGroupID(ctx context.Context, pool, reservedUUID string) error {
+	err := removeMapKeys(ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID,
+		[]string{conn.config.csiGroupIDKey})
+	if err != nil {
+		return fmt.Errorf("failed to remove groupID %w", err)
+	}
+
+	return nil
+}
+
 // FetchAttribute fetches an attribute (key) in omap.
 func (conn *Connection) FetchAttribute(ctx context.Context, pool, reservedUUID, attribute string) (string, error) {
 	key := conn.config.commonPrefix + attribute
@@ -95,7 +95,7 @@ func (nv *NFSVolume) Connect(cr *util.Credentials) error {
 		return fmt.Errorf("failed to get MONs for cluster (%s): %w", nv.clusterID, err)
 	}
 
-	err = nv.conn.Connect(nv.mons, cr)
+	err = nv.conn.Connect(nv.clusterID, nv.mons, cr)
 	if err != nil {
 		return fmt.Errorf("failed to connect to cluster: %w", err)
 	}
@@ -121,6 +121,15 @@ func (nv *NFSVolume) GetExportPath() string {
 	return "/" + nv.volumeID
 }
 
+// squashModes maps the squash modes of the CSI config to the ones of the
+// NFS-admin API.
+var squashModes = map[string]nfs.SquashMode{
+	"none":   nfs.NoneSquash,
+	"root":   nfs.RootSquash,
+	"rootid": nfs.RootIDSquash,
+	"all":    nfs.AllSquash,
+}
+
 // CreateExport takes the (CephFS) CSI-volume and instructs Ceph Mgr to create
 // a new NFS-export for the volume on the Ceph managed NFS-server.
 func (nv *NFSVolume) CreateExport(backend *csi.Volume) error {
@@ -158,8 +167,19 @@ func (nv *NFSVolume) CreateExport(backend *csi.Volume) error {
 		}
 	}
 
+	opts, err := util.GetNFSExportOptions(util.CsiConfigFile, nv.clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get export options: %w", err)
+	}
+	export.Squash = squashModes[opts.Squash]
+	export.ReadOnly = opts.AccessType == "RO"
+
 	if clients != "" {
 		export.ClientAddr = strings.Split(clients, ",")
+	} else if len(opts.Clients) != 0 {
+		// use the clients of the cluster, in case the StorageClass does not
+		// set them
+		export.ClientAddr = opts.Clients
 	}
 
 	_, err = nfsa.CreateCephFSExport(export)
@@ -231,6 +231,18 @@ func (cs *ControllerServer) parseVolCreateRequest(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	// fall back to the topology constrained pools from the cluster config
+	if rbdVol.TopologyPools == nil && req.GetAccessibilityRequirements() != nil {
+		topologyPools, tErr := util.GetTopologyConstrainedPools(util.CsiConfigFile, rbdVol.ClusterID)
+		if tErr != nil {
+			return nil, status.Error(codes.Internal, tErr.Error())
+		}
+		if len(topologyPools) != 0 {
+			rbdVol.TopologyPools = &topologyPools
+			rbdVol.TopologyRequirement = req.GetAccessibilityRequirements()
+		}
+	}
+
 	err = rbdVol.Connect(cr)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to connect to volume %v: %v", rbdVol.RbdImageName, err)
@@ -407,7 +419,9 @@ func (cs *ControllerServer) CreateVolume(
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	defer func() {
-		if err != nil {
+		// keep the reservation of a volume that is still being flattened,
+		// the next request continues with it
+		if err != nil && !errors.Is(err, ErrFlattenInProgress) {
 			errDefer := undoVolReservation(ctx, rbdVol, cr)
 			if errDefer != nil {
 				log.WarningLog(ctx, "failed undoing reservation of volume: %s (%s)", req.GetName(), errDefer)
@@ -536,6 +550,16 @@ func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.C
 			return nil, err
 		}
 
+		// a previous request may have timed out while flattening
+		if rbdVol.FlattenOnClone {
+			err = rbdVol.flattenAndWait(ctx)
+			if err != nil {
+				log.ErrorLog(ctx, "failed to flatten volume %s: %v", rbdVol, err)
+
+				return nil, getGRPCErrorForCreateVolume(err)
+			}
+		}
+
 	// rbdVol is a clone from parentVol
 	case vcs.GetVolume() != nil:
 		// expand the image if the requested size is greater than the current size
@@ -566,6 +590,55 @@ func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.C
 	return buildCreateVolumeResponse(ctx, req, rbdVol)
 }
 
+// checkSnapshotLimit returns a ResourceExhausted error when the volume
+// already has the maximum number of snapshots that is configured for the
+// cluster. The snapshots are counted by the clones of the volume that are
+// named like a snapshot with the namePrefix. A snapshot that has been
+// flattened is not a clone of the volume anymore, and is not counted.
+func checkSnapshotLimit(ctx context.Context, rbdVol *rbdVolume, namePrefix string) error {
+	maxSnapshots, err := util.GetRBDMaxSnapshotsPerVolume(util.CsiConfigFile, rbdVol.ClusterID)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if maxSnapshots == 0 {
+		return nil
+	}
+
+	_, children, err := rbdVol.listSnapAndChildren()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	count := countSnapshotImages(children, namePrefix)
+	if count >= maxSnapshots {
+		log.ErrorLog(ctx, "volume %q has %d snapshots, the maximum is %d", rbdVol, count, maxSnapshots)
+
+		return status.Errorf(codes.ResourceExhausted,
+			"volume has %d snapshots, the maximum for cluster %q is %d", count, rbdVol.ClusterID, maxSnapshots)
+	}
+
+	return nil
+}
+
+// countSnapshotImages returns the number of images that are named like a
+// snapshot with the namePrefix. An empty namePrefix uses the default
+// "csi-snap-" prefix.
+func countSnapshotImages(imageNames []string, namePrefix string) int {
+	if namePrefix == "" {
+		namePrefix = defaultSnapshotNamePrefix
+	}
+
+	count := 0
+	for _, name := range imageNames {
+		if _, ok := snapshotUUID(name, namePrefix); ok {
+			count++
+		}
+	}
+
+	return count
+}
+
 // check snapshots on the rbd image, as we have limit from krbd that an image
 // cannot have more than 510 snapshot at a given point of time. If the
 // snapshots are more than the `maxSnapshotsOnImage` Add a task to flatten all
@@ -691,7 +764,7 @@ func (cs *ControllerServer) createVolumeFromSnapshot(
 	}
 
 	defer func() {
-		if err != nil {
+		if err != nil && !errors.Is(err, ErrFlattenInProgress) {
 			log.DebugLog(ctx, "Removing clone image %q", rbdVol)
 			errDefer := rbdVol.Delete(ctx)
 			if errDefer != nil {
@@ -723,6 +796,17 @@ func (cs *ControllerServer) createVolumeFromSnapshot(
 		return err
 	}
 
+	if rbdVol.FlattenOnClone {
+		// the clone is kept when flattening does not finish in time, the
+		// next request waits for flattening again in repairExistingVolume()
+		err = rbdVol.flattenAndWait(ctx)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to flatten volume %s: %v", rbdVol, err)
+
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1177,6 +1261,11 @@ func (cs *ControllerServer) CreateSnapshot(
 		return cloneFromSnapshot(ctx, rbdVol, rbdSnap, cr, req.GetParameters())
 	}
 
+	err = checkSnapshotLimit(ctx, rbdVol, rbdSnap.NamePrefix)
+	if err != nil {
+		return nil, err
+	}
+
 	err = rbdVol.PrepareVolumeForSnapshot(ctx, cr)
 	if err != nil {
 		return nil, err
@@ -1195,7 +1284,7 @@ func (cs *ControllerServer) CreateSnapshot(
 		}
 	}()
 
-	vol, err := cs.doSnapshotClone(ctx, rbdVol, rbdSnap, cr)
+	vol, err := doSnapshotClone(ctx, rbdVol, rbdSnap, cr)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -1226,6 +1315,18 @@ func (cs *ControllerServer) CreateSnapshot(
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	err = storeProvenance(rbdVol, newSnapshotProvenance(rbdSnap.ClusterID, provenanceSourceCreateSnapshot))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if mode, ok := req.GetParameters()[checksumParameter]; ok {
+		err = rbdSnap.StoreChecksum(ctx, cr, mode == checksumModeSampled)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
 	csiSnap, err := vol.toSnapshot().ToCSI(ctx)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -1318,11 +1419,15 @@ func (cs *ControllerServer) validateSnapshotReq(ctx context.Context, req *csi.Cr
 	if value, ok := options["pool"]; ok && value == "" {
 		return status.Error(codes.InvalidArgument, "empty pool name in which rbd image will be created")
 	}
+	if value, ok := options[checksumParameter]; ok && value != checksumModeFull && value != checksumModeSampled {
+		return status.Errorf(codes.InvalidArgument, "invalid %s %q, valid options are %q and %q",
+			checksumParameter, value, checksumModeFull, checksumModeSampled)
+	}
 
 	return nil
 }
 
-func (cs *ControllerServer) doSnapshotClone(
+func doSnapshotClone(
 	ctx context.Context,
 	parentVol *rbdVolume,
 	rbdSnap *rbdSnapshot,
@@ -1396,6 +1501,16 @@ func (cs *ControllerServer) doSnapshotClone(
 		return cloneRbd, err
 	}
 
+	// the creation time in the journal is only a cache, failing to store
+	// it does not fail the snapshot
+	created, err := cloneRbd.GetCreationTime(ctx)
+	if err == nil {
+		err = j.StoreCreationTime(ctx, rbdSnap.JournalPool, rbdSnap.ReservedID, *created)
+	}
+	if err != nil {
+		log.WarningLog(ctx, "failed to store creation time of snapshot %s: %v", rbdSnap, err)
+	}
+
 	return cloneRbd, nil
 }
 
@@ -85,3 +85,42 @@ func TestValidateStriping(t *testing.T) {
 		})
 	}
 }
+
+func TestCountSnapshotImages(t *testing.T) {
+	t.Parallel()
+	children := []string{
+		"csi-snap-4f5b6e2a-8d6b-4c1e-9a3f-0b2c4d6e8f10",
+		"csi-snap-5a6b7c8d-9e0f-4a1b-8c2d-3e4f5a6b7c8d",
+		"csi-vol-8d6b2c1e-2f4a-4b6c-8d0e-1f3a5b7c9d2e-temp",
+		"csi-snap-not-a-uuid",
+		"backup-snap-6b7c8d9e-0f1a-4b2c-9d3e-4f5a6b7c8d9e",
+	}
+	tests := []struct {
+		name       string
+		namePrefix string
+		want       int
+	}{
+		{
+			name: "default prefix",
+			want: 2,
+		},
+		{
+			name:       "custom prefix",
+			namePrefix: "backup-snap-",
+			want:       1,
+		},
+		{
+			name:       "no matching clones",
+			namePrefix: "other-",
+			want:       0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := countSnapshotImages(children, tt.namePrefix); got != tt.want {
+				t.Errorf("countSnapshotImages() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ package rbd
 
 import (
 	"fmt"
+
+	librbd "github.com/ceph/go-ceph/rbd"
 )
 
 // Sparsify checks the size of the objects in the RBD image and calls
@@ -53,3 +55,70 @@ func (ri *rbdImage) Sparsify() error {
 
 	return nil
 }
+
+// diskUsageCounter accumulates the allocated bytes that are reported by
+// librbd.Image.DiffIterate().
+type diskUsageCounter struct {
+	used uint64
+}
+
+// add is a librbd.DiffIterateCallback that counts the length of all extents
+// that contain data.
+func (duc *diskUsageCounter) add(_, length uint64, exists int, _ interface{}) int {
+	if exists != 0 {
+		duc.used += length
+	}
+
+	return 0
+}
+
+// diskUsage returns the number of bytes that are allocated by the image
+// imageName at the given snapshot, without the data of the parent image. The
+// image is opened in the pool and rados namespace of ri. When exact is
+// false, allocations are counted per RADOS object which is much quicker on
+// images with the fast-diff feature, but partially used objects are counted
+// as complete objects.
+func (ri *rbdImage) diskUsage(imageName, snapName string, exact bool) (int64, error) {
+	err := ri.openIoctx()
+	if err != nil {
+		return 0, err
+	}
+
+	image, err := librbd.OpenImageReadOnly(ri.ioctx, imageName, snapName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open image %q at snapshot %q: %w", imageName, snapName, err)
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of image %q: %w", imageName, err)
+	}
+
+	counter := &diskUsageCounter{}
+	err = image.DiffIterate(librbd.DiffIterateConfig{
+		SnapName:      librbd.NoSnapshot,
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.ExcludeParent,
+		WholeObject:   diffWholeObject(exact),
+		Callback:      counter.add,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate disk usage of image %q: %w", imageName, err)
+	}
+
+	return int64(counter.used), nil
+}
+
+// diffWholeObject returns the librbd.DiffWholeObject for a disk usage
+// calculation. Like `rbd du`, the fast (not exact) calculation reports
+// complete objects, which uses the object-map when the image has the
+// fast-diff feature, instead of reading the extents of every object.
+func diffWholeObject(exact bool) librbd.DiffWholeObject {
+	if exact {
+		return librbd.DisableWholeObject
+	}
+
+	return librbd.EnableWholeObject
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// diffExtent is an extent as reported by librbd.Image.DiffIterate().
+type diffExtent struct {
+	offset uint64
+	length uint64
+	exists int
+}
+
+func TestDiskUsageCounter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		extents []diffExtent
+		want    uint64
+	}{
+		{
+			name:    "no extents",
+			extents: []diffExtent{},
+			want:    0,
+		},
+		{
+			// exact mode reports the written extents within objects
+			name: "exact extents",
+			extents: []diffExtent{
+				{offset: 0, length: 4096, exists: 1},
+				{offset: 8192, length: 512, exists: 1},
+				{offset: 4 << 20, length: 1 << 20, exists: 1},
+			},
+			want: 4096 + 512 + (1 << 20),
+		},
+		{
+			// fast mode reports complete objects (4MiB by default)
+			name: "whole object extents",
+			extents: []diffExtent{
+				{offset: 0, length: 4 << 20, exists: 1},
+				{offset: 4 << 20, length: 4 << 20, exists: 1},
+			},
+			want: 8 << 20,
+		},
+		{
+			name: "discarded extents are not counted",
+			extents: []diffExtent{
+				{offset: 0, length: 4 << 20, exists: 1},
+				{offset: 4 << 20, length: 4 << 20, exists: 0},
+			},
+			want: 4 << 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			counter := &diskUsageCounter{}
+			for _, e := range tt.extents {
+				if ret := counter.add(e.offset, e.length, e.exists, nil); ret != 0 {
+					t.Errorf("diskUsageCounter.add() = %d, want 0", ret)
+				}
+			}
+			if counter.used != tt.want {
+				t.Errorf("diskUsageCounter.used = %d, want %d", counter.used, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffWholeObject(t *testing.T) {
+	t.Parallel()
+
+	if got := diffWholeObject(true); got != librbd.DisableWholeObject {
+		t.Errorf("diffWholeObject(exact) = %v, want %v", got, librbd.DisableWholeObject)
+	}
+	if got := diffWholeObject(false); got != librbd.EnableWholeObject {
+		t.Errorf("diffWholeObject(fast) = %v, want %v", got, librbd.EnableWholeObject)
+	}
+}
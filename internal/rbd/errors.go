@@ -16,7 +16,12 @@ limitations under the License.
 
 package rbd
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	librados "github.com/ceph/go-ceph/rados"
+)
 
 var (
 	// ErrImageNotFound is returned when image name is not found in the cluster on the given pool and/or namespace.
@@ -57,4 +62,10 @@ var (
 	ErrInvalidArgument = errors.New("invalid arguments provided")
 	// ErrImageInUse is returned when the image is in use.
 	ErrImageInUse = errors.New("image is in use")
+	// ErrSnapHasChildren is returned when an operation on a snapshot is not
+	// possible because clones still depend on it.
+	ErrSnapHasChildren = errors.New("snapshot has dependent clones")
+	// ErrSnapshotNotConnected is returned when an operation on a snapshot
+	// needs a connection to the cluster, but the snapshot is not connected.
+	ErrSnapshotNotConnected = fmt.Errorf("%w: snapshot is not connected", librados.ErrNotConnected)
 )
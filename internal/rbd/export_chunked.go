@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// readChunks reads size bytes from r in chunks of chunkSize, and calls fn
+// for each chunk. Every chunk is passed in a new buffer, so that fn can keep
+// a reference to the data, for example while it is being uploaded. The
+// context is checked before each chunk is read.
+func readChunks(
+	ctx context.Context,
+	r io.ReaderAt,
+	size, chunkSize int64,
+	fn func(offset int64, data []byte) error,
+) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("%w: chunk size %d must be positive", ErrInvalidArgument, chunkSize)
+	}
+
+	for offset := int64(0); offset < size; offset += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("export stopped at offset %d: %w", offset, err)
+		}
+
+		data := make([]byte, min(chunkSize, size-offset))
+		n, err := r.ReadAt(data, offset)
+		if err != nil && !(err == io.EOF && n == len(data)) {
+			return fmt.Errorf("failed to read %d bytes at offset %d: %w", len(data), offset, err)
+		}
+
+		err = fn(offset, data)
+		if err != nil {
+			return fmt.Errorf("failed to export %d bytes at offset %d: %w", len(data), offset, err)
+		}
+	}
+
+	return nil
+}
+
+// ExportChunked reads all data of the snapshot in chunks of chunkSize bytes,
+// and calls fn for each chunk. This makes it possible to upload a snapshot
+// in parts, like with the multipart upload of an object store.
+func (rbdSnap *rbdSnapshot) ExportChunked(
+	ctx context.Context,
+	cr *util.Credentials,
+	chunkSize int64,
+	fn func(offset int64, data []byte) error,
+) error {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get size of snapshot %q: %w", rbdSnap, err)
+	}
+
+	err = readChunks(ctx, image, int64(size), chunkSize, fn)
+	if err != nil {
+		return fmt.Errorf("failed to export snapshot %q: %w", rbdSnap, err)
+	}
+
+	log.DebugLog(ctx, "exported %d bytes of snapshot %q in chunks of %d bytes", size, rbdSnap, chunkSize)
+
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestReadChunks(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	tests := []struct {
+		name      string
+		size      int64
+		chunkSize int64
+		offsets   []int64
+	}{
+		{
+			name:      "size is a multiple of the chunk size",
+			size:      100,
+			chunkSize: 25,
+			offsets:   []int64{0, 25, 50, 75},
+		},
+		{
+			name:      "short last chunk",
+			size:      100,
+			chunkSize: 30,
+			offsets:   []int64{0, 30, 60, 90},
+		},
+		{
+			name:      "chunk larger than the size",
+			size:      100,
+			chunkSize: 1000,
+			offsets:   []int64{0},
+		},
+		{
+			name:      "empty snapshot",
+			size:      0,
+			chunkSize: 10,
+			offsets:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var offsets []int64
+			out := &bytes.Buffer{}
+			err := readChunks(context.TODO(), bytes.NewReader(data[:tt.size]), tt.size, tt.chunkSize,
+				func(offset int64, chunk []byte) error {
+					if int64(out.Len()) != offset {
+						t.Errorf("chunk at offset %d, want %d", offset, out.Len())
+					}
+					if int64(len(chunk)) > tt.chunkSize {
+						t.Errorf("chunk of %d bytes, larger than %d", len(chunk), tt.chunkSize)
+					}
+					offsets = append(offsets, offset)
+					out.Write(chunk)
+
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("readChunks() failed: %v", err)
+			}
+			if !slices.Equal(offsets, tt.offsets) {
+				t.Errorf("readChunks() offsets = %v, want %v", offsets, tt.offsets)
+			}
+			if !bytes.Equal(out.Bytes(), data[:tt.size]) {
+				t.Errorf("readChunks() exported %d bytes, want %d", out.Len(), tt.size)
+			}
+		})
+	}
+}
+
+func TestReadChunksErrors(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 100)
+	r := bytes.NewReader(data)
+	noop := func(int64, []byte) error { return nil }
+
+	t.Run("invalid chunk size", func(t *testing.T) {
+		t.Parallel()
+		err := readChunks(context.TODO(), r, 100, 0, noop)
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("readChunks() error = %v, want %v", err, ErrInvalidArgument)
+		}
+	})
+
+	t.Run("callback fails", func(t *testing.T) {
+		t.Parallel()
+		errUpload := errors.New("upload failed")
+		calls := 0
+		err := readChunks(context.TODO(), r, 100, 10, func(offset int64, _ []byte) error {
+			calls++
+			if offset == 20 {
+				return errUpload
+			}
+
+			return nil
+		})
+		if !errors.Is(err, errUpload) {
+			t.Errorf("readChunks() error = %v, want %v", err, errUpload)
+		}
+		if calls != 3 {
+			t.Errorf("callback called %d times, want 3", calls)
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.TODO())
+		calls := 0
+		err := readChunks(ctx, r, 100, 10, func(int64, []byte) error {
+			calls++
+			if calls == 2 {
+				cancel()
+			}
+
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("readChunks() error = %v, want %v", err, context.Canceled)
+		}
+		if calls != 2 {
+			t.Errorf("callback called %d times, want 2", calls)
+		}
+	})
+
+	t.Run("short read", func(t *testing.T) {
+		t.Parallel()
+		err := readChunks(context.TODO(), bytes.NewReader(data[:50]), 100, 30, noop)
+		if err == nil {
+			t.Error("readChunks() should fail when the data is shorter than the size")
+		}
+	})
+}
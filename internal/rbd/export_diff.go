@@ -0,0 +1,431 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// rbdDiffHeader is the banner of the "rbd diff v1" format, as written by
+// `rbd export-diff`.
+const rbdDiffHeader = "rbd diff v1\n"
+
+// record tags of the "rbd diff v1" format.
+const (
+	diffTagFromSnap = 'f'
+	diffTagToSnap   = 't'
+	diffTagSize     = 's'
+	diffTagWrite    = 'w'
+	diffTagZero     = 'z'
+	diffTagEnd      = 'e'
+)
+
+// diffCompareChunkSize is the maximum number of bytes of the two snapshots
+// that are read and compared at once, while calculating the diff between
+// them.
+const diffCompareChunkSize = 4 * 1024 * 1024
+
+// diffWriter writes the changed extents of an image in the "rbd diff v1"
+// format, so that the stream can be applied with `rbd import-diff`.
+type diffWriter struct {
+	// ctx is checked before each extent is written
+	ctx context.Context
+	w   io.Writer
+	// r is used to read the data of the changed extents
+	r io.ReaderAt
+	// err is the first error that occurred while writing the stream
+	err error
+}
+
+// writeRecord writes a record with the given tag and fields. Fields are
+// either uint64 values that are encoded in little-endian, or raw bytes.
+func (dw *diffWriter) writeRecord(tag byte, fields ...interface{}) error {
+	if dw.err != nil {
+		return dw.err
+	}
+
+	buf := []byte{tag}
+	for _, field := range fields {
+		switch f := field.(type) {
+		case uint64:
+			buf = binary.LittleEndian.AppendUint64(buf, f)
+		case []byte:
+			buf = append(buf, f...)
+		default:
+			return fmt.Errorf("unsupported field type %T", field)
+		}
+	}
+
+	_, dw.err = dw.w.Write(buf)
+
+	return dw.err
+}
+
+// writeSnapName writes a record with a snapshot name, which is prefixed by
+// its length encoded as uint32.
+func (dw *diffWriter) writeSnapName(tag byte, name string) error {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(name)))
+
+	return dw.writeRecord(tag, append(buf, name...))
+}
+
+// writeHeader writes the banner and the metadata records of the stream. An
+// empty fromSnap is not written, which makes the stream a full export.
+func (dw *diffWriter) writeHeader(fromSnap, toSnap string, size uint64) error {
+	_, dw.err = io.WriteString(dw.w, rbdDiffHeader)
+	if fromSnap != "" {
+		_ = dw.writeSnapName(diffTagFromSnap, fromSnap)
+	}
+	_ = dw.writeSnapName(diffTagToSnap, toSnap)
+
+	return dw.writeRecord(diffTagSize, size)
+}
+
+// checkContext sets the error of the diffWriter when the context is done.
+func (dw *diffWriter) checkContext() error {
+	if dw.err == nil {
+		dw.err = dw.ctx.Err()
+	}
+
+	return dw.err
+}
+
+// writeExtent is a librbd.DiffIterateCallback that writes the data of the
+// changed extent, or a zero record when the extent was discarded.
+func (dw *diffWriter) writeExtent(offset, length uint64, exists int, _ interface{}) int {
+	if dw.checkContext() != nil {
+		return -1
+	}
+
+	if exists == 0 {
+		if dw.writeRecord(diffTagZero, offset, length) != nil {
+			return -1
+		}
+
+		return 0
+	}
+
+	data := make([]byte, length)
+	err := readAtSnapshot(dw.r, data, offset)
+	if err != nil {
+		dw.err = err
+
+		return -1
+	}
+
+	if dw.writeRecord(diffTagWrite, offset, length, data) != nil {
+		return -1
+	}
+
+	return 0
+}
+
+// writeChanges compares the extent of the snapshot that dw reads from with
+// the same extent of the snapshot that is read from base, and writes the
+// parts that differ. Parts that only contain zeros in the snapshot of dw are
+// written as zero records.
+func (dw *diffWriter) writeChanges(base io.ReaderAt, extent imageExtent) error {
+	chunk := min(extent.length, diffCompareChunkSize)
+	data := make([]byte, chunk)
+	baseData := make([]byte, chunk)
+
+	end := extent.offset + extent.length
+	for offset := extent.offset; offset < end; offset += chunk {
+		if dw.checkContext() != nil {
+			return dw.err
+		}
+
+		length := min(chunk, end-offset)
+		err := readAtSnapshot(dw.r, data[:length], offset)
+		if err != nil {
+			return err
+		}
+		err = readAtSnapshot(base, baseData[:length], offset)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case bytes.Equal(data[:length], baseData[:length]):
+			continue
+		case isZero(data[:length]):
+			err = dw.writeRecord(diffTagZero, offset, length)
+		default:
+			err = dw.writeRecord(diffTagWrite, offset, length, data[:length])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeEnd terminates the stream.
+func (dw *diffWriter) writeEnd() error {
+	return dw.writeRecord(diffTagEnd)
+}
+
+// readAtSnapshot fills data with the contents of r at offset. Data past the
+// end of r is read as zeros, which is the case when the snapshot is smaller
+// than the snapshot it is compared with.
+func readAtSnapshot(r io.ReaderAt, data []byte, offset uint64) error {
+	n, err := r.ReadAt(data, int64(offset))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read %d bytes at offset %d: %w", len(data), offset, err)
+	}
+	clear(data[n:])
+
+	return nil
+}
+
+// isZero returns true when data only contains zeros.
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// imageExtent is a range of bytes in an image.
+type imageExtent struct {
+	offset uint64
+	length uint64
+}
+
+// extentCollector is a librbd.DiffIterateCallback that records all extents
+// that are reported, until the context is done.
+type extentCollector struct {
+	ctx     context.Context
+	extents []imageExtent
+	err     error
+}
+
+func (ec *extentCollector) add(offset, length uint64, _ int, _ interface{}) int {
+	ec.err = ec.ctx.Err()
+	if ec.err != nil {
+		return -1
+	}
+
+	ec.extents = append(ec.extents, imageExtent{offset: offset, length: length})
+
+	return 0
+}
+
+// collectExtents returns the extents of the image that contain data,
+// including the data of its parent images, up to size bytes.
+func collectExtents(ctx context.Context, image *librbd.Image, size uint64) ([]imageExtent, error) {
+	ec := &extentCollector{ctx: ctx}
+	err := image.DiffIterate(librbd.DiffIterateConfig{
+		SnapName:      librbd.NoSnapshot,
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.IncludeParent,
+		WholeObject:   librbd.DisableWholeObject,
+		Callback:      ec.add,
+	})
+	if ec.err != nil {
+		err = ec.err
+	}
+
+	return ec.extents, err
+}
+
+// mergeExtents sorts the extents, merges the ones that overlap or are
+// adjacent, and cuts them off at limit.
+func mergeExtents(extents []imageExtent, limit uint64) []imageExtent {
+	slices.SortFunc(extents, func(a, b imageExtent) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+
+	merged := []imageExtent{}
+	for _, extent := range extents {
+		if extent.offset >= limit {
+			break
+		}
+		end := min(extent.offset+extent.length, limit)
+
+		last := len(merged) - 1
+		if last >= 0 && extent.offset <= merged[last].offset+merged[last].length {
+			merged[last].length = max(merged[last].length, end-merged[last].offset)
+
+			continue
+		}
+		merged = append(merged, imageExtent{offset: extent.offset, length: end - extent.offset})
+	}
+
+	return merged
+}
+
+// validateDiffBase checks that the diff of the snapshot to can be exported
+// relative to the snapshot base. Both need to be different snapshots of the
+// same volume.
+func validateDiffBase(base, to *rbdSnapshot) error {
+	if base.VolID == to.VolID {
+		return fmt.Errorf("%w: can not export the diff of snapshot %q to itself", ErrInvalidArgument, to.VolID)
+	}
+
+	if base.ClusterID != to.ClusterID || base.Pool != to.Pool ||
+		base.RadosNamespace != to.RadosNamespace || base.RbdImageName != to.RbdImageName {
+		return fmt.Errorf("%w: snapshot %q to export the diff from is not a snapshot of volume %q",
+			ErrInvalidArgument, base.VolID, to.RbdImageName)
+	}
+
+	return nil
+}
+
+// ExportDiff writes the changes between the snapshot fromSnap and this
+// snapshot to w, in the format of `rbd export-diff`. fromSnap is the CSI
+// snapshot ID of another snapshot of the same volume. When fromSnap is empty,
+// all data of the snapshot is exported.
+//
+// Every CSI snapshot is stored on its own clone of the volume, so librbd can
+// not calculate the diff between them. Instead, the extents that contain
+// data in either of the snapshots are read and compared, and only the parts
+// that differ are written.
+func (rbdSnap *rbdSnapshot) ExportDiff(
+	ctx context.Context,
+	cr *util.Credentials,
+	fromSnap string,
+	w io.Writer,
+) error {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get size of snapshot %q: %w", rbdSnap, err)
+	}
+
+	dw := &diffWriter{ctx: ctx, w: w, r: image}
+	if fromSnap == "" {
+		err = rbdSnap.exportFull(dw, image, size)
+	} else {
+		err = rbdSnap.exportChanges(ctx, cr, dw, image, fromSnap, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = dw.writeEnd()
+	if err != nil {
+		return fmt.Errorf("failed to write end of diff: %w", err)
+	}
+
+	log.DebugLog(ctx, "exported diff from snapshot %q to %q", fromSnap, rbdSnap)
+
+	return nil
+}
+
+// exportFull writes all data of the snapshot, opened as image, to dw.
+func (rbdSnap *rbdSnapshot) exportFull(dw *diffWriter, image *librbd.Image, size uint64) error {
+	err := dw.writeHeader("", rbdSnap.RbdSnapName, size)
+	if err != nil {
+		return fmt.Errorf("failed to write diff header: %w", err)
+	}
+
+	err = image.DiffIterate(librbd.DiffIterateConfig{
+		SnapName:      librbd.NoSnapshot,
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.IncludeParent,
+		WholeObject:   librbd.DisableWholeObject,
+		Callback:      dw.writeExtent,
+	})
+	if dw.err != nil {
+		err = dw.err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export snapshot %q: %w", rbdSnap, err)
+	}
+
+	return nil
+}
+
+// exportChanges writes the changes between the snapshot with the CSI
+// snapshot ID fromSnap and this snapshot, opened as image, to dw.
+func (rbdSnap *rbdSnapshot) exportChanges(
+	ctx context.Context,
+	cr *util.Credentials,
+	dw *diffWriter,
+	image *librbd.Image,
+	fromSnap string,
+	size uint64,
+) error {
+	base, err := genSnapFromSnapID(ctx, fromSnap, cr, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot %q to export the diff from: %w", fromSnap, err)
+	}
+	defer base.Destroy(ctx)
+
+	err = validateDiffBase(base, rbdSnap)
+	if err != nil {
+		return err
+	}
+
+	baseImage, err := base.openAtSnapshot(cr)
+	if err != nil {
+		return err
+	}
+	defer baseImage.Close()
+
+	baseSize, err := baseImage.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get size of snapshot %q: %w", base, err)
+	}
+
+	extents, err := collectExtents(ctx, image, size)
+	if err != nil {
+		return fmt.Errorf("failed to list extents of snapshot %q: %w", rbdSnap, err)
+	}
+	baseExtents, err := collectExtents(ctx, baseImage, baseSize)
+	if err != nil {
+		return fmt.Errorf("failed to list extents of snapshot %q: %w", base, err)
+	}
+
+	err = dw.writeHeader(base.RbdSnapName, rbdSnap.RbdSnapName, size)
+	if err != nil {
+		return fmt.Errorf("failed to write diff header: %w", err)
+	}
+
+	for _, extent := range mergeExtents(append(extents, baseExtents...), size) {
+		err = dw.writeChanges(baseImage, extent)
+		if err != nil {
+			return fmt.Errorf("failed to export diff of snapshot %q: %w", rbdSnap, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiffWriter(t *testing.T) {
+	t.Parallel()
+
+	data := bytes.Repeat([]byte{'x'}, 16)
+	out := &bytes.Buffer{}
+	dw := &diffWriter{ctx: context.TODO(), w: out, r: bytes.NewReader(data)}
+
+	err := dw.writeHeader("snap-1", "snap-2", uint64(len(data)))
+	if err != nil {
+		t.Fatalf("writeHeader() failed: %v", err)
+	}
+	if ret := dw.writeExtent(4, 8, 1, nil); ret != 0 {
+		t.Fatalf("writeExtent() returned %d: %v", ret, dw.err)
+	}
+	if ret := dw.writeExtent(12, 4, 0, nil); ret != 0 {
+		t.Fatalf("writeExtent() returned %d: %v", ret, dw.err)
+	}
+	err = dw.writeEnd()
+	if err != nil {
+		t.Fatalf("writeEnd() failed: %v", err)
+	}
+
+	expected := []byte(rbdDiffHeader)
+	expected = append(expected, 'f', 6, 0, 0, 0)
+	expected = append(expected, "snap-1"...)
+	expected = append(expected, 't', 6, 0, 0, 0)
+	expected = append(expected, "snap-2"...)
+	expected = append(expected, 's')
+	expected = binary.LittleEndian.AppendUint64(expected, 16)
+	expected = append(expected, 'w')
+	expected = binary.LittleEndian.AppendUint64(expected, 4)
+	expected = binary.LittleEndian.AppendUint64(expected, 8)
+	expected = append(expected, data[4:12]...)
+	expected = append(expected, 'z')
+	expected = binary.LittleEndian.AppendUint64(expected, 12)
+	expected = binary.LittleEndian.AppendUint64(expected, 4)
+	expected = append(expected, 'e')
+
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("unexpected diff stream:\n got: %q\nwant: %q", out.Bytes(), expected)
+	}
+}
+
+func TestDiffWriterFullExport(t *testing.T) {
+	t.Parallel()
+
+	out := &bytes.Buffer{}
+	dw := &diffWriter{ctx: context.TODO(), w: out, r: bytes.NewReader(nil)}
+
+	err := dw.writeHeader("", "snap-1", 0)
+	if err != nil {
+		t.Fatalf("writeHeader() failed: %v", err)
+	}
+
+	if out.Len() <= len(rbdDiffHeader) {
+		t.Fatalf("diff stream only contains %q", out.Bytes())
+	}
+	if out.Bytes()[len(rbdDiffHeader)] != diffTagToSnap {
+		t.Errorf("full export should not contain a from-snapshot record: %q", out.Bytes())
+	}
+}
+
+func TestDiffWriterChanges(t *testing.T) {
+	t.Parallel()
+
+	base := bytes.Repeat([]byte{'a'}, 12)
+	data := append(bytes.Repeat([]byte{'a'}, 4), bytes.Repeat([]byte{'b'}, 4)...)
+	data = append(data, make([]byte, 8)...)
+
+	out := &bytes.Buffer{}
+	dw := &diffWriter{ctx: context.TODO(), w: out, r: bytes.NewReader(data)}
+
+	// the unchanged first 4 bytes are skipped, the last 4 bytes are only
+	// part of the newer snapshot, which is larger
+	for _, extent := range []imageExtent{{0, 8}, {8, 8}} {
+		err := dw.writeChanges(bytes.NewReader(base), extent)
+		if err != nil {
+			t.Fatalf("writeChanges(%v) failed: %v", extent, err)
+		}
+	}
+
+	expected := []byte{'w'}
+	expected = binary.LittleEndian.AppendUint64(expected, 0)
+	expected = binary.LittleEndian.AppendUint64(expected, 8)
+	expected = append(expected, data[:8]...)
+	expected = append(expected, 'z')
+	expected = binary.LittleEndian.AppendUint64(expected, 8)
+	expected = binary.LittleEndian.AppendUint64(expected, 8)
+
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("unexpected diff stream:\n got: %q\nwant: %q", out.Bytes(), expected)
+	}
+}
+
+func TestDiffWriterCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	out := &bytes.Buffer{}
+	dw := &diffWriter{ctx: ctx, w: out, r: bytes.NewReader(make([]byte, 8))}
+
+	if ret := dw.writeExtent(0, 8, 1, nil); ret == 0 {
+		t.Errorf("writeExtent() succeeded with a canceled context")
+	}
+	if !errors.Is(dw.err, context.Canceled) {
+		t.Errorf("writeExtent() error = %v, want %v", dw.err, context.Canceled)
+	}
+	if out.Len() != 0 {
+		t.Errorf("writeExtent() wrote %q with a canceled context", out.Bytes())
+	}
+}
+
+func TestMergeExtents(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		extents []imageExtent
+		limit   uint64
+		want    []imageExtent
+	}{
+		{
+			name:    "no extents",
+			extents: nil,
+			limit:   16,
+			want:    []imageExtent{},
+		},
+		{
+			name:    "unsorted and overlapping",
+			extents: []imageExtent{{8, 4}, {0, 4}, {2, 4}, {10, 4}},
+			limit:   16,
+			want:    []imageExtent{{0, 6}, {8, 6}},
+		},
+		{
+			name:    "adjacent",
+			extents: []imageExtent{{0, 4}, {4, 4}},
+			limit:   16,
+			want:    []imageExtent{{0, 8}},
+		},
+		{
+			name:    "contained",
+			extents: []imageExtent{{0, 8}, {2, 2}},
+			limit:   16,
+			want:    []imageExtent{{0, 8}},
+		},
+		{
+			name:    "beyond the limit",
+			extents: []imageExtent{{0, 4}, {6, 8}, {12, 4}},
+			limit:   8,
+			want:    []imageExtent{{0, 4}, {6, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := mergeExtents(tt.extents, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeExtents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDiffBase(t *testing.T) {
+	t.Parallel()
+
+	snapshot := func(id, image string) *rbdSnapshot {
+		snap := newResolvedTestSnapshot("")
+		snap.VolID = id
+		snap.RbdImageName = image
+
+		return snap
+	}
+
+	tests := []struct {
+		name    string
+		base    *rbdSnapshot
+		wantErr error
+	}{
+		{"same volume", snapshot("snap-1", "csi-vol-8d6b2c1e"), nil},
+		{"other volume", snapshot("snap-1", "csi-vol-0a1b2c3d"), ErrInvalidArgument},
+		{"same snapshot", snapshot("snap-2", "csi-vol-8d6b2c1e"), ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateDiffBase(tt.base, snapshot("snap-2", "csi-vol-8d6b2c1e"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateDiffBase() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
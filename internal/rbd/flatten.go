@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ceph/go-ceph/rbd/admin"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// flattenPollInterval is the interval for checking if flattening an image
+// finished.
+const flattenPollInterval = 2 * time.Second
+
+// flattenStatus reports if flattening an image finished. While flattening is
+// in progress, the progress is returned as a fraction between 0 and 1.
+type flattenStatus func() (bool, float64, error)
+
+// waitForFlatten calls status every interval, until flattening finished or
+// the context is done. In case the context is done before flattening
+// finished, an error wrapping ErrFlattenInProgress with the last reported
+// progress is returned.
+func waitForFlatten(ctx context.Context, status flattenStatus, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		done, progress, err := status()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %.0f%% done when aborted (%w)", ErrFlattenInProgress, progress*100, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// flattenAndWait flattens the image, and waits until flattening finished or
+// the context is done. The flattening is done by a Ceph manager task, which
+// keeps running when the context is done. The returned error wraps
+// ErrFlattenInProgress in that case, and calling flattenAndWait again waits
+// for the same task, as the Ceph manager does not add a duplicate task for
+// the image.
+func (rv *rbdVolume) flattenAndWait(ctx context.Context) error {
+	// a previous request may have finished flattening the image already
+	_, err := rv.getParentName()
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get parent of image %q: %w", rv, err)
+	}
+
+	ta, err := rv.conn.GetTaskAdmin()
+	if err != nil {
+		return err
+	}
+
+	task, err := ta.AddFlatten(admin.NewImageSpec(rv.Pool, rv.RadosNamespace, rv.RbdImageName))
+	if !isCephMgrSupported(ctx, rv.ClusterID, err) {
+		log.DebugLog(ctx, "flattening image %q without the task manager", rv)
+
+		// flatten() blocks until flattening finished, and can not be aborted
+		return rv.flatten()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add task to flatten image %q: %w", rv, err)
+	}
+
+	log.DebugLog(ctx, "waiting for task %q to flatten image %q", task.ID, rv)
+
+	status := func() (bool, float64, error) {
+		t, tErr := ta.GetTaskByID(task.ID)
+		if tErr == nil {
+			return false, t.Progress, nil
+		}
+
+		// the task is removed once it finished, check if the image still
+		// has a parent
+		parent, pErr := rv.getParentName()
+		if errors.Is(pErr, librbd.ErrNotFound) {
+			return true, 1, nil
+		} else if pErr != nil {
+			return false, 0, fmt.Errorf("failed to get parent of image %q: %w", rv, pErr)
+		}
+
+		return false, 0, fmt.Errorf("flatten task %q is gone (%w), but image %q still has parent %q",
+			task.ID, tErr, rv, parent)
+	}
+
+	return waitForFlatten(ctx, status, flattenPollInterval)
+}
+
+// flattenTaskAction is the action of Ceph manager tasks that flatten an
+// image.
+const flattenTaskAction = "flatten"
+
+// isFlattenTask returns true when task flattens the image with the given
+// pool, rados namespace and name.
+func isFlattenTask(task *admin.TaskResponse, pool, namespace, image string) bool {
+	return task.Refs.Action == flattenTaskAction &&
+		task.Refs.PoolName == pool &&
+		task.Refs.PoolNamespace == namespace &&
+		task.Refs.ImageName == image
+}
+
+// hasFlattenTask returns true when a Ceph manager task to flatten the image
+// is queued or running. Clusters that do not support Ceph manager tasks
+// never have a flatten task.
+func (ri *rbdImage) hasFlattenTask(ctx context.Context) (bool, error) {
+	ta, err := ri.conn.GetTaskAdmin()
+	if err != nil {
+		return false, err
+	}
+
+	tasks, err := ta.List()
+	if !isCephMgrSupported(ctx, ri.ClusterID, err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	return slices.ContainsFunc(tasks, func(task admin.TaskResponse) bool {
+		return isFlattenTask(&task, ri.Pool, ri.RadosNamespace, ri.RbdImageName)
+	}), nil
+}
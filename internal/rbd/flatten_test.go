@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ceph/go-ceph/rbd/admin"
+)
+
+func TestWaitForFlatten(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flatten complete", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		status := func() (bool, float64, error) {
+			calls++
+
+			return calls == 3, float64(calls) / 3, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := waitForFlatten(ctx, status, time.Millisecond)
+		if err != nil {
+			t.Errorf("waitForFlatten() failed: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 status calls, got %d", calls)
+		}
+	})
+
+	t.Run("flatten timeout", func(t *testing.T) {
+		t.Parallel()
+
+		status := func() (bool, float64, error) {
+			return false, 0.42, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := waitForFlatten(ctx, status, time.Millisecond)
+		if !errors.Is(err, ErrFlattenInProgress) {
+			t.Errorf("waitForFlatten() error = %v, want %v", err, ErrFlattenInProgress)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("waitForFlatten() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if err != nil && !strings.Contains(err.Error(), "42%") {
+			t.Errorf("waitForFlatten() error = %v, should contain the progress", err)
+		}
+	})
+
+	t.Run("status error", func(t *testing.T) {
+		t.Parallel()
+
+		errStatus := errors.New("status failed")
+		status := func() (bool, float64, error) {
+			return false, 0, errStatus
+		}
+
+		err := waitForFlatten(context.Background(), status, time.Millisecond)
+		if !errors.Is(err, errStatus) {
+			t.Errorf("waitForFlatten() error = %v, want %v", err, errStatus)
+		}
+	})
+}
+
+func TestIsFlattenTask(t *testing.T) {
+	t.Parallel()
+
+	refs := admin.TaskRefs{
+		Action:        "flatten",
+		PoolName:      "replicapool",
+		PoolNamespace: "ns",
+		ImageName:     "csi-snap-1",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(refs *admin.TaskRefs)
+		want   bool
+	}{
+		{
+			name:   "flatten task of the image",
+			modify: func(_ *admin.TaskRefs) {},
+			want:   true,
+		},
+		{
+			name:   "remove task of the image",
+			modify: func(refs *admin.TaskRefs) { refs.Action = "remove" },
+		},
+		{
+			name:   "flatten task of another image",
+			modify: func(refs *admin.TaskRefs) { refs.ImageName = "csi-snap-2" },
+		},
+		{
+			name:   "flatten task in another namespace",
+			modify: func(refs *admin.TaskRefs) { refs.PoolNamespace = "" },
+		},
+		{
+			name:   "flatten task in another pool",
+			modify: func(refs *admin.TaskRefs) { refs.PoolName = "otherpool" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			task := admin.TaskResponse{Refs: refs}
+			tt.modify(&task.Refs)
+			if got := isFlattenTask(&task, "replicapool", "ns", "csi-snap-1"); got != tt.want {
+				t.Errorf("isFlattenTask() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
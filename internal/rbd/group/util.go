@@ -231,7 +231,7 @@ func (cvg *commonVolumeGroup) getConnection(ctx context.Context) (*util.ClusterC
 	}
 
 	conn := &util.ClusterConnection{}
-	err := conn.Connect(cvg.monitors, cvg.credentials)
+	err := conn.Connect(cvg.clusterID, cvg.monitors, cvg.credentials)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MONs %q: %w", cvg.monitors, err)
 	}
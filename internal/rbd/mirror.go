@@ -148,6 +148,11 @@ func (ri *rbdImage) Promote(_ context.Context, force bool) error {
 // timeout. If there is no response within 2 minutes,the rbd CLI process will be
 // killed and an error is returned.
 func (rv *rbdVolume) ForcePromote(ctx context.Context, cr *util.Credentials) error {
+	confFile, err := util.GetEffectiveCephConfFile(util.CsiConfigFile, rv.ClusterID, rv.Monitors)
+	if err != nil {
+		return err
+	}
+
 	promoteArgs := []string{
 		"mirror", "image", "promote",
 		rv.String(),
@@ -155,6 +160,7 @@ func (rv *rbdVolume) ForcePromote(ctx context.Context, cr *util.Credentials) err
 		"--id", cr.ID,
 		"-m", rv.Monitors,
 		"--keyfile=" + cr.KeyFile,
+		"-c", confFile,
 	}
 	_, stderr, err := util.ExecCommandWithTimeout(
 		ctx,
@@ -204,9 +204,11 @@ func (ns *NodeServer) populateRbdVol(
 			return nil, status.Errorf(codes.Internal, "error generating volume %s: %v", volID, err)
 		}
 		rv.DataPool = req.GetVolumeContext()["dataPool"]
-		var ok bool
-		if rv.Mounter, ok = req.GetVolumeContext()["mounter"]; !ok {
-			rv.Mounter = rbdDefaultMounter
+		rv.Mounter, err = getMounter(req.GetVolumeContext(), rv.ClusterID)
+		if err != nil {
+			rv.Destroy(ctx)
+
+			return nil, status.Error(codes.Internal, err.Error())
 		}
 	}
 
@@ -264,6 +266,12 @@ func (ns *NodeServer) populateRbdVol(
 	rv.VolID = volID
 
 	rv.LogDir = req.GetVolumeContext()["cephLogDir"]
+	if rv.LogDir == "" {
+		rv.LogDir, err = util.GetClusterLogDir(util.CsiConfigFile, rv.ClusterID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
 	if rv.LogDir == "" {
 		rv.LogDir = defaultLogDir
 	}
@@ -288,6 +296,31 @@ func (rv *rbdVolume) appendReadAffinityMapOptions(readAffinityMapOptions string)
 	}
 }
 
+// appendReadBalancingMapOptions appends the map option that balances the
+// reads over the replicas of the objects, when readBalancing is enabled for
+// the cluster. krbd and rbd-nbd do not use the connection of the driver, so
+// the option needs to be passed to the mapping. It is not appended when the
+// mapOptions already contain a read_from_replica policy, like the one of
+// read affinity.
+func (rv *rbdVolume) appendReadBalancingMapOptions(enabled bool) {
+	var option string
+	switch rv.Mounter {
+	case rbdDefaultMounter:
+		option = krbdReadBalancingOption
+	case rbdNbdMounter:
+		option = nbdReadBalancingOption
+	}
+
+	switch {
+	case !enabled || option == "" || strings.Contains(rv.MapOptions, "read_from_replica"):
+		return
+	case rv.MapOptions != "":
+		rv.MapOptions += "," + option
+	default:
+		rv.MapOptions = option
+	}
+}
+
 // NodeStageVolume mounts the volume to a staging path on the node.
 // Implementation notes:
 // - stagingTargetPath is the directory passed in the request where the volume needs to be staged
@@ -851,6 +884,26 @@ func (ns *NodeServer) mountVolumeToStagePath(
 	return err
 }
 
+// isClusterReadOnly checks if the cluster of the volume is configured to
+// publish all volumes read-only. The clusterID is taken from the volume
+// handle like NodeStageVolume does, static volumes use the clusterID of the
+// volume context.
+func isClusterReadOnly(volID string, volumeContext map[string]string) (bool, error) {
+	clusterID := volumeContext[util.ClusterIDKey]
+
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(volID); err == nil {
+		clusterID = vi.ClusterID
+	}
+
+	// the volume context of older static volumes may not contain the clusterID
+	if clusterID == "" {
+		return false, nil
+	}
+
+	return util.IsClusterReadOnly(util.CsiConfigFile, clusterID)
+}
+
 func (ns *NodeServer) mountVolume(ctx context.Context, stagingPath string, req *csi.NodePublishVolumeRequest) error {
 	// Publish Path
 	fsType := req.GetVolumeCapability().GetMount().GetFsType()
@@ -859,6 +912,14 @@ func (ns *NodeServer) mountVolume(ctx context.Context, stagingPath string, req *
 	isBlock := req.GetVolumeCapability().GetBlock() != nil
 	targetPath := req.GetTargetPath()
 
+	if !readOnly {
+		var err error
+		readOnly, err = isClusterReadOnly(req.GetVolumeId(), req.GetVolumeContext())
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+
 	mountOptions = csicommon.ConstructMountOptions(mountOptions, req.GetVolumeCapability())
 
 	log.DebugLog(ctx, "target %v\nisBlock %v\nfstype %v\nstagingPath %v\nreadonly %v\nmountflags %v\n",
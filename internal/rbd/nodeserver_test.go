@@ -199,6 +199,62 @@ func TestNodeServer_appendReadAffinityMapOptions(t *testing.T) {
 	}
 }
 
+func TestNodeServer_appendReadBalancingMapOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		mapOptions string
+		mounter    string
+		enabled    bool
+		want       string
+	}{
+		{
+			name:       "disabled",
+			mapOptions: "notrim",
+			mounter:    rbdDefaultMounter,
+			want:       "notrim",
+		},
+		{
+			name:    "enabled with krbd",
+			mounter: rbdDefaultMounter,
+			enabled: true,
+			want:    "read_from_replica=balance",
+		},
+		{
+			name:       "enabled with krbd and mapOptions",
+			mapOptions: "notrim",
+			mounter:    rbdDefaultMounter,
+			enabled:    true,
+			want:       "notrim,read_from_replica=balance",
+		},
+		{
+			name:       "enabled with rbd-nbd",
+			mapOptions: "try-netlink",
+			mounter:    rbdNbdMounter,
+			enabled:    true,
+			want:       "try-netlink,rbd_read_from_replica_policy=balance",
+		},
+		{
+			name:       "enabled with read affinity",
+			mapOptions: "read_from_replica=localize,crush_location=region:west",
+			mounter:    rbdDefaultMounter,
+			enabled:    true,
+			want:       "read_from_replica=localize,crush_location=region:west",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rv := &rbdVolume{
+				MapOptions: tt.mapOptions,
+				Mounter:    tt.mounter,
+			}
+			rv.appendReadBalancingMapOptions(tt.enabled)
+			require.Equal(t, tt.want, rv.MapOptions)
+		})
+	}
+}
+
 func TestReadAffinity_GetReadAffinityMapOptions(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// journalLookup returns true when the snapshot with the UUID is reserved in
+// the journal.
+type journalLookup func(ctx context.Context, uuid string) (bool, error)
+
+// findOrphanedSnapshots returns the names of the images that are named like
+// a snapshot with the namePrefix, but for which lookup does not find a
+// reservation in the journal.
+func findOrphanedSnapshots(
+	ctx context.Context,
+	imageNames []string,
+	namePrefix string,
+	lookup journalLookup,
+) ([]string, error) {
+	var orphans []string
+	for _, name := range imageNames {
+		id, ok := snapshotUUID(name, namePrefix)
+		if !ok {
+			continue
+		}
+
+		found, err := lookup(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup snapshot for image %q in the journal: %w", name, err)
+		}
+
+		if !found {
+			orphans = append(orphans, name)
+		}
+	}
+
+	return orphans, nil
+}
+
+// FindOrphanedSnapshots returns the names of the RBD images in the pool that
+// back a snapshot, but have no entry in the CSI journal anymore. The journal
+// is stored in journalPool, which is the pool of the StorageClass when
+// snapshots are created in a pool of the topology. An empty journalPool
+// means that the journal is in the same pool as the images. Only images with
+// namePrefix, the snapshotNamePrefix of the VolumeSnapshotClass, are
+// checked. An empty namePrefix uses the default "csi-snap-" prefix.
+func FindOrphanedSnapshots(
+	ctx context.Context,
+	cr *util.Credentials,
+	clusterID, pool, journalPool, namePrefix string,
+) ([]string, error) {
+	if journalPool == "" {
+		journalPool = pool
+	}
+	if namePrefix == "" {
+		namePrefix = defaultSnapshotNamePrefix
+	}
+
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find MONs for cluster %q: %w", clusterID, err)
+	}
+
+	ns, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the RADOS namespace for cluster %q: %w", clusterID, err)
+	}
+
+	// rbdImage without an image name, only used for the connection to the pool
+	poolImage := &rbdImage{
+		Monitors:       monitors,
+		Pool:           pool,
+		RadosNamespace: ns,
+	}
+	defer poolImage.Destroy(ctx)
+
+	err = poolImage.Connect(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = poolImage.openIoctx()
+	if err != nil {
+		return nil, err
+	}
+
+	imageNames, err := librbd.GetImageNames(poolImage.ioctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images in pool %q: %w", pool, err)
+	}
+
+	j, err := snapJournal.Connect(monitors, ns, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	lookup := func(ctx context.Context, id string) (bool, error) {
+		_, err := j.GetImageAttributes(ctx, journalPool, id, true)
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrObjectNotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	return findOrphanedSnapshots(ctx, imageNames, namePrefix, lookup)
+}
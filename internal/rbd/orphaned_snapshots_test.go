@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindOrphanedSnapshots(t *testing.T) {
+	t.Parallel()
+
+	const (
+		journalled = "7d7a5a3e-5a5c-4a5f-9d3a-4b0d1c2e3f40"
+		orphaned   = "0f4f2a1b-1c2d-4e3f-8a9b-0c1d2e3f4a5b"
+	)
+
+	// the backend contains volumes, snapshots and unrelated images
+	imageNames := []string{
+		"csi-vol-" + journalled,
+		"csi-snap-" + journalled,
+		"csi-snap-" + orphaned,
+		"csi-snap-not-a-uuid",
+		"manually-created",
+	}
+
+	t.Run("orphaned snapshots", func(t *testing.T) {
+		t.Parallel()
+
+		journal := map[string]bool{journalled: true}
+		var lookups []string
+		lookup := func(_ context.Context, id string) (bool, error) {
+			lookups = append(lookups, id)
+
+			return journal[id], nil
+		}
+
+		orphans, err := findOrphanedSnapshots(context.TODO(), imageNames, defaultSnapshotNamePrefix, lookup)
+		require.NoError(t, err)
+		require.Equal(t, []string{"csi-snap-" + orphaned}, orphans)
+		// only snapshots are looked up in the journal
+		require.Equal(t, []string{journalled, orphaned}, lookups)
+	})
+
+	t.Run("no orphaned snapshots", func(t *testing.T) {
+		t.Parallel()
+
+		lookup := func(_ context.Context, _ string) (bool, error) {
+			return true, nil
+		}
+
+		orphans, err := findOrphanedSnapshots(context.TODO(), imageNames, defaultSnapshotNamePrefix, lookup)
+		require.NoError(t, err)
+		require.Empty(t, orphans)
+	})
+
+	t.Run("journal failure", func(t *testing.T) {
+		t.Parallel()
+
+		errJournal := errors.New("connection refused")
+		lookup := func(_ context.Context, _ string) (bool, error) {
+			return false, errJournal
+		}
+
+		_, err := findOrphanedSnapshots(context.TODO(), imageNames, defaultSnapshotNamePrefix, lookup)
+		require.ErrorIs(t, err, errJournal)
+	})
+
+	t.Run("custom prefix", func(t *testing.T) {
+		t.Parallel()
+
+		images := append([]string{"backup-snap-" + orphaned}, imageNames...)
+		var lookups []string
+		lookup := func(_ context.Context, id string) (bool, error) {
+			lookups = append(lookups, id)
+
+			return false, nil
+		}
+
+		orphans, err := findOrphanedSnapshots(context.TODO(), images, "backup-snap-", lookup)
+		require.NoError(t, err)
+		require.Equal(t, []string{"backup-snap-" + orphaned}, orphans)
+		// snapshots with the default prefix are not checked
+		require.Equal(t, []string{orphaned}, lookups)
+	})
+}
@@ -65,6 +65,12 @@ const (
 	// `io-timeout` of rbd-nbd is to tweak NBD_ATTR_TIMEOUT. It specifies
 	// how long the IO should wait to get handled before bailing out.
 	setNbdIOTimeout = "io-timeout"
+
+	// krbdReadBalancingOption and nbdReadBalancingOption balance the reads
+	// of a mapped image over the replicas of the objects. rbd-nbd uses
+	// librbd, which takes the option from its configuration.
+	krbdReadBalancingOption = "read_from_replica=balance"
+	nbdReadBalancingOption  = "rbd_read_from_replica_policy=balance"
 )
 
 var (
@@ -306,14 +312,44 @@ func parseMapOptions(mapOptions string) (string, string, error) {
 	return krbdMapOptions, nbdMapOptions, nil
 }
 
+// mergeMapOptions parses the formatted map options from the CSI config and
+// the StorageClass, and returns the combined mounter specific options. The
+// options from the StorageClass are appended after the options from the CSI
+// config, so that they take precedence.
+func mergeMapOptions(configOptions, scOptions string) (string, string, error) {
+	krbdConfigOptions, nbdConfigOptions, err := parseMapOptions(configOptions)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse options from the CSI config: %w", err)
+	}
+	krbdSCOptions, nbdSCOptions, err := parseMapOptions(scOptions)
+	if err != nil {
+		return "", "", err
+	}
+
+	krbdOptions := util.MountOptionsAdd(krbdConfigOptions, strings.Split(krbdSCOptions, ",")...)
+	nbdOptions := util.MountOptionsAdd(nbdConfigOptions, strings.Split(nbdSCOptions, ",")...)
+
+	return krbdOptions, nbdOptions, nil
+}
+
 // getMapOptions is a wrapper func, calls parse map/unmap funcs and feeds the
-// rbdVolume object.
+// rbdVolume object. The map/unmap options from the CSI config of the cluster
+// are merged with the options from the StorageClass.
 func (ns *NodeServer) getMapOptions(req *csi.NodeStageVolumeRequest, rv *rbdVolume) error {
-	krbdMapOptions, nbdMapOptions, err := parseMapOptions(req.GetVolumeContext()["mapOptions"])
+	configMapOptions, err := util.GetRBDMapOptions(util.CsiConfigFile, rv.ClusterID)
+	if err != nil {
+		return err
+	}
+	configUnmapOptions, err := util.GetRBDUnmapOptions(util.CsiConfigFile, rv.ClusterID)
 	if err != nil {
 		return err
 	}
-	krbdUnmapOptions, nbdUnmapOptions, err := parseMapOptions(req.GetVolumeContext()["unmapOptions"])
+
+	krbdMapOptions, nbdMapOptions, err := mergeMapOptions(configMapOptions, req.GetVolumeContext()["mapOptions"])
+	if err != nil {
+		return err
+	}
+	krbdUnmapOptions, nbdUnmapOptions, err := mergeMapOptions(configUnmapOptions, req.GetVolumeContext()["unmapOptions"])
 	if err != nil {
 		return err
 	}
@@ -333,6 +369,12 @@ func (ns *NodeServer) getMapOptions(req *csi.NodeStageVolumeRequest, rv *rbdVolu
 	}
 	rv.appendReadAffinityMapOptions(readAffinityMapOptions)
 
+	readBalancing, err := util.IsReadBalancingEnabled(util.CsiConfigFile, rv.ClusterID)
+	if err != nil {
+		return err
+	}
+	rv.appendReadBalancingMapOptions(readBalancing)
+
 	return nil
 }
 
@@ -436,10 +478,16 @@ func createPath(ctx context.Context, volOpt *rbdVolume, device string, cr *util.
 
 	log.TraceLog(ctx, "rbd: map mon %s", volOpt.Monitors)
 
+	confFile, err := util.GetEffectiveCephConfFile(util.CsiConfigFile, volOpt.ClusterID, volOpt.Monitors)
+	if err != nil {
+		return "", err
+	}
+
 	mapArgs := []string{
 		"--id", cr.ID,
 		"-m", volOpt.Monitors,
 		"--keyfile=" + cr.KeyFile,
+		"-c", confFile,
 	}
 
 	// Choose access protocol
@@ -474,7 +522,6 @@ func createPath(ctx context.Context, volOpt *rbdVolume, device string, cr *util.
 	var (
 		stdout string
 		stderr string
-		err    error
 	)
 
 	if volOpt.NetNamespaceFilePath != "" {
@@ -103,3 +103,69 @@ func TestParseMapOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeMapOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		configOptions     string
+		scOptions         string
+		expectKrbdOptions string
+		expectNbdOptions  string
+		expectErr         string
+	}{
+		{
+			name:              "only options from the CSI config",
+			configOptions:     "krbd:exclusive;nbd:try-netlink",
+			scOptions:         "",
+			expectKrbdOptions: "exclusive",
+			expectNbdOptions:  "try-netlink",
+		},
+		{
+			name:              "only options from the StorageClass",
+			configOptions:     "",
+			scOptions:         "lock_on_read,queue_depth=1024",
+			expectKrbdOptions: "lock_on_read,queue_depth=1024",
+			expectNbdOptions:  "",
+		},
+		{
+			name:              "StorageClass options are appended to the CSI config options",
+			configOptions:     "exclusive,queue_depth=128",
+			scOptions:         "krbd:queue_depth=1024;nbd:try-netlink",
+			expectKrbdOptions: "exclusive,queue_depth=128,queue_depth=1024",
+			expectNbdOptions:  "try-netlink",
+		},
+		{
+			name:              "duplicate options are not repeated",
+			configOptions:     "exclusive,lock_on_read",
+			scOptions:         "lock_on_read",
+			expectKrbdOptions: "exclusive,lock_on_read",
+			expectNbdOptions:  "",
+		},
+		{
+			name:          "invalid options in the CSI config",
+			configOptions: "xyz:xOp1",
+			scOptions:     "lock_on_read",
+			expectErr:     "failed to parse options from the CSI config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			krbdOpts, nbdOpts, err := mergeMapOptions(tt.configOptions, tt.scOptions)
+			if (err != nil) != (tt.expectErr != "") || err != nil && !strings.Contains(err.Error(), tt.expectErr) {
+				t.Errorf("mergeMapOptions(%s, %s) returned error, expected: %v, got: %v",
+					tt.configOptions, tt.scOptions, tt.expectErr, err)
+			}
+			if krbdOpts != tt.expectKrbdOptions {
+				t.Errorf("mergeMapOptions(%s, %s) returned unexpected krbd options, expected: %q, got: %q",
+					tt.configOptions, tt.scOptions, tt.expectKrbdOptions, krbdOpts)
+			}
+			if nbdOpts != tt.expectNbdOptions {
+				t.Errorf("mergeMapOptions(%s, %s) returned unexpected nbd options, expected: %q, got: %q",
+					tt.configOptions, tt.scOptions, tt.expectNbdOptions, nbdOpts)
+			}
+		})
+	}
+}
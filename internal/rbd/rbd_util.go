@@ -180,7 +180,10 @@ type rbdVolume struct {
 	// this value will not be updated when doing getImageInfo() on rbdVolume.
 	RequestedVolSize   int64
 	DisableInUseChecks bool
-	readOnly           bool
+	// FlattenOnClone flattens the volume when it is created from a
+	// snapshot, so that it does not depend on the snapshot
+	FlattenOnClone bool
+	readOnly       bool
 }
 
 // rbdSnapshot represents a CSI snapshot and its RBD snapshot specifics.
@@ -194,6 +197,10 @@ type rbdSnapshot struct {
 
 	// groupID is the CSI volume group ID where this snapshot belongs to
 	groupID string
+
+	// journalCreatedAt is the creation time that was stored in the journal,
+	// nil for snapshots that were created before it was stored
+	journalCreatedAt *time.Time
 }
 
 // imageFeature represents required image features and value.
@@ -378,7 +385,7 @@ func (ri *rbdImage) Connect(cr *util.Credentials) error {
 	}
 
 	conn := &util.ClusterConnection{}
-	if err := conn.Connect(ri.Monitors, cr); err != nil {
+	if err := conn.Connect(ri.ClusterID, ri.Monitors, cr); err != nil {
 		return err
 	}
 
@@ -1031,6 +1038,7 @@ func genSnapFromSnapID(
 	rbdSnap.RbdSnapName = imageAttributes.ImageName
 	rbdSnap.ReservedID = vi.ObjectUUID
 	rbdSnap.Owner = imageAttributes.Owner
+	rbdSnap.journalCreatedAt = imageAttributes.CreationTime
 	// convert the journal pool ID to name, for use in DeleteSnapshot cases
 	if imageAttributes.JournalPoolID != util.InvalidPoolID {
 		rbdSnap.JournalPool, err = util.GetPoolName(rbdSnap.Monitors, cr, imageAttributes.JournalPoolID)
@@ -1316,6 +1324,25 @@ func shouldRetryVolumeGeneration(err error) bool {
 		errors.Is(err, rados.ErrPermissionDenied))
 }
 
+// getMounter returns the "mounter" from the volume options. When the
+// StorageClass does not set the mounter, the mounter from the cluster
+// configuration is used, and otherwise the default krbd mounter.
+func getMounter(volOptions map[string]string, clusterID string) (string, error) {
+	if mounter, ok := volOptions["mounter"]; ok {
+		return mounter, nil
+	}
+
+	mounter, err := util.GetRBDMounter(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return "", err
+	}
+	if mounter == "" {
+		mounter = rbdDefaultMounter
+	}
+
+	return mounter, nil
+}
+
 func genVolFromVolumeOptions(
 	ctx context.Context,
 	volOptions map[string]string,
@@ -1356,12 +1383,22 @@ func genVolFromVolumeOptions(
 	if err != nil {
 		return nil, err
 	}
-	if rbdVol.Mounter, ok = volOptions["mounter"]; !ok {
-		rbdVol.Mounter = rbdDefaultMounter
+	rbdVol.Mounter, err = getMounter(volOptions, rbdVol.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	imageFeatures, ok := volOptions["imageFeatures"]
+	if !ok {
+		// use the default image features of the cluster, in case the
+		// StorageClass does not set them
+		imageFeatures, err = util.GetRBDImageFeatures(util.CsiConfigFile, rbdVol.ClusterID)
+		if err != nil {
+			return nil, err
+		}
 	}
 	// if no image features is provided, it results in empty string
 	// which disable all RBD image features as we expected
-	if err = rbdVol.validateImageFeatures(volOptions["imageFeatures"]); err != nil {
+	if err = rbdVol.validateImageFeatures(imageFeatures); err != nil {
 		log.ErrorLog(ctx, "failed to validate image features %v", err)
 
 		return nil, err
@@ -1374,15 +1411,38 @@ func genVolFromVolumeOptions(
 		rbdVol.ImageFeatureSet.Names(),
 		rbdVol.Mounter)
 	rbdVol.DisableInUseChecks = disableInUseChecks
+	rbdVol.FlattenOnClone = parseBoolOption(ctx, volOptions, "flattenOnClone", false)
 
 	err = rbdVol.setStripeConfiguration(volOptions)
 	if err != nil {
 		return nil, err
 	}
+	if rbdVol.StripeUnit == 0 && rbdVol.StripeCount == 0 {
+		// use the striping of the cluster, in case the StorageClass does
+		// not set it
+		err = rbdVol.setClusterStripeConfiguration()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return rbdVol, nil
 }
 
+// setClusterStripeConfiguration sets the stripe unit and count from the CSI
+// config of the cluster of the image.
+func (ri *rbdImage) setClusterStripeConfiguration() error {
+	unit, count, err := util.GetRBDStripeConfig(util.CsiConfigFile, ri.ClusterID)
+	if err != nil {
+		return err
+	}
+
+	ri.StripeUnit = uint64(unit)
+	ri.StripeCount = uint64(count)
+
+	return nil
+}
+
 func (ri *rbdImage) setStripeConfiguration(options map[string]string) error {
 	var err error
 	if val, ok := options["stripeUnit"]; ok {
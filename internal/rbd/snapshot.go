@@ -19,6 +19,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -125,6 +126,25 @@ func (rv *rbdVolume) toSnapshot() *rbdSnapshot {
 	}
 }
 
+// snapImageName returns the name of the RBD image that holds the RBD snapshot.
+// The RBD snapshot is not created on the source volume (RbdImageName), but on
+// a clone of it that has the same name as the RBD snapshot.
+func (rbdSnap *rbdSnapshot) snapImageName() string {
+	return rbdSnap.RbdSnapName
+}
+
+// snapSpec returns the snap-spec (pool/{namespace/}image@snap) of the RBD
+// snapshot on the image that holds it. Unlike String(), which contains the
+// source volume, the snap-spec can be passed to rbd commands.
+func (rbdSnap *rbdSnapshot) snapSpec() string {
+	if rbdSnap.RadosNamespace != "" {
+		return fmt.Sprintf("%s/%s/%s@%s", rbdSnap.Pool, rbdSnap.RadosNamespace, rbdSnap.snapImageName(),
+			rbdSnap.RbdSnapName)
+	}
+
+	return fmt.Sprintf("%s/%s@%s", rbdSnap.Pool, rbdSnap.snapImageName(), rbdSnap.RbdSnapName)
+}
+
 func (rbdSnap *rbdSnapshot) toVolume() *rbdVolume {
 	return &rbdVolume{
 		rbdImage: rbdImage{
@@ -134,7 +154,7 @@ func (rbdSnap *rbdSnapshot) toVolume() *rbdVolume {
 			Pool:           rbdSnap.Pool,
 			JournalPool:    rbdSnap.JournalPool,
 			RadosNamespace: rbdSnap.RadosNamespace,
-			RbdImageName:   rbdSnap.RbdSnapName,
+			RbdImageName:   rbdSnap.snapImageName(),
 			ImageID:        rbdSnap.ImageID,
 			CreatedAt:      rbdSnap.CreatedAt,
 			// copyEncryptionConfig cannot be used here because the volume and the
@@ -146,6 +166,8 @@ func (rbdSnap *rbdSnapshot) toVolume() *rbdVolume {
 	}
 }
 
+// ToCSI returns the CSI Snapshot for the rbdSnapshot. The snapshot is not
+// inspected in the backend, use GetStatus() for the state of the snapshot.
 func (rbdSnap *rbdSnapshot) ToCSI(ctx context.Context) (*csi.Snapshot, error) {
 	created, err := rbdSnap.GetCreationTime(ctx)
 	if err != nil {
@@ -162,6 +184,178 @@ func (rbdSnap *rbdSnapshot) ToCSI(ctx context.Context) (*csi.Snapshot, error) {
 	}, nil
 }
 
+// snapshotConditions contains the results of inspecting the RBD image that
+// backs a snapshot.
+type snapshotConditions struct {
+	// imageErr is the error from opening the image of the snapshot
+	imageErr error
+	// snapErr is the error from checking the RBD snapshot on the image
+	snapErr error
+	// flattening is set when a task to flatten the image is queued or
+	// running
+	flattening bool
+}
+
+// snapshotStatus maps the conditions of the image that backs the snapshot
+// name to the state of the snapshot. An error is returned when inspecting
+// the image or the RBD snapshot failed, the state is unknown then.
+func snapshotStatus(name string, cond snapshotConditions) (types.SnapshotState, string, error) {
+	switch {
+	case errors.Is(cond.imageErr, ErrImageNotFound):
+		// the image is moved to the trash when the snapshot is deleted
+		return types.SnapshotStateDeleting, fmt.Sprintf("image of snapshot %s does not exist", name), nil
+	case cond.imageErr != nil:
+		return "", "", fmt.Errorf("failed to inspect image of snapshot %s: %w", name, cond.imageErr)
+	case errors.Is(cond.snapErr, ErrSnapNotFound):
+		// the RBD snapshot is created after the image was cloned
+		return types.SnapshotStateCreating, fmt.Sprintf("snapshot %s is not created on its image yet", name), nil
+	case cond.snapErr != nil:
+		return "", "", fmt.Errorf("failed to inspect snapshot %s: %w", name, cond.snapErr)
+	case cond.flattening:
+		return types.SnapshotStateFlattening, fmt.Sprintf("image of snapshot %s is being flattened", name), nil
+	}
+
+	return types.SnapshotStateReady, fmt.Sprintf("snapshot %s is ready", name), nil
+}
+
+// GetStatus inspects the RBD image that backs the snapshot, and returns the
+// state of the snapshot. The snapshot is reported as flattening while a task
+// to flatten its image is queued or running, independent of the clone depth
+// that caused the flattening.
+func (rbdSnap *rbdSnapshot) GetStatus(ctx context.Context) (types.SnapshotState, string, error) {
+	if rbdSnap.conn == nil {
+		return "", "", fmt.Errorf("can not get status of snapshot %q: %w", rbdSnap, ErrSnapshotNotConnected)
+	}
+
+	vol := rbdSnap.toVolume()
+
+	err := vol.Connect(rbdSnap.conn.Creds)
+	if err != nil {
+		return "", "", err
+	}
+	defer vol.Destroy(ctx)
+
+	cond := snapshotConditions{}
+	cond.imageErr = vol.getImageInfo()
+	if cond.imageErr == nil {
+		cond.snapErr = vol.checkSnapExists(rbdSnap)
+	}
+	if cond.imageErr == nil && cond.snapErr == nil {
+		cond.flattening, err = vol.hasFlattenTask(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to check for a task to flatten snapshot %q: %w", rbdSnap, err)
+		}
+	}
+
+	state, msg, err := snapshotStatus(rbdSnap.String(), cond)
+	if err != nil {
+		return "", "", err
+	}
+	log.DebugLog(ctx, "state of snapshot %s is %q: %s", rbdSnap, state, msg)
+
+	return state, msg, nil
+}
+
+// WaitReady polls the status of the snapshot until it is ready to use, or
+// the context is done.
+func (rbdSnap *rbdSnapshot) WaitReady(ctx context.Context, pollInterval time.Duration) error {
+	return types.WaitSnapshotReady(ctx, rbdSnap, pollInterval)
+}
+
+// GetCreationTimeCached returns the creation time from the journal, or calls
+// GetCreationTime() when the journal does not contain it.
+func (rbdSnap *rbdSnapshot) GetCreationTimeCached(ctx context.Context) (*time.Time, error) {
+	return cachedCreationTime(rbdSnap.journalCreatedAt, func() (*time.Time, error) {
+		return rbdSnap.GetCreationTime(ctx)
+	})
+}
+
+// cachedCreationTime returns cached when it is set, otherwise the result of
+// query.
+func cachedCreationTime(cached *time.Time, query func() (*time.Time, error)) (*time.Time, error) {
+	if cached != nil {
+		return cached, nil
+	}
+
+	return query()
+}
+
+// GetSourceVolumeID returns the CSI volume ID of the image that the snapshot
+// was taken from.
+func (rbdSnap *rbdSnapshot) GetSourceVolumeID(_ context.Context) (string, error) {
+	return rbdSnap.SourceVolumeID, nil
+}
+
+// GetJournalID returns the UUID that was reserved for the snapshot in the
+// journal. The journal stores the attributes of the snapshot in the omap
+// "csi.snap.<UUID>" in the journal pool.
+func (rbdSnap *rbdSnapshot) GetJournalID(_ context.Context) (string, error) {
+	if rbdSnap.ReservedID == "" {
+		return "", fmt.Errorf("snapshot %q is not reserved in the journal", rbdSnap)
+	}
+
+	return rbdSnap.ReservedID, nil
+}
+
+// GetPoolName returns the pool that holds the image of the snapshot, like
+// rbdImage.GetPoolName(). The rados namespace is returned by
+// GetRadosNamespace().
+func (rbdSnap *rbdSnapshot) GetPoolName(_ context.Context) (string, error) {
+	if rbdSnap.Pool == "" {
+		return "", fmt.Errorf("pool of snapshot %q is not set", rbdSnap)
+	}
+
+	return rbdSnap.Pool, nil
+}
+
+// GetRadosNamespace returns the rados namespace of the image that holds the
+// snapshot, or an empty string for the default namespace.
+func (rbdSnap *rbdSnapshot) GetRadosNamespace(_ context.Context) (string, error) {
+	return rbdSnap.RadosNamespace, nil
+}
+
+// GetImageName returns the name of the rbd image that holds the snapshot.
+// That is the clone of the source volume that the RBD snapshot was created
+// on, not the source volume itself.
+func (rbdSnap *rbdSnapshot) GetImageName(_ context.Context) (string, error) {
+	if rbdSnap.snapImageName() == "" {
+		return "", fmt.Errorf("image name of snapshot %q is not set", rbdSnap)
+	}
+
+	return rbdSnap.snapImageName(), nil
+}
+
+// GetQuotaUsage returns the number of bytes that are referenced by the
+// snapshot, excluding the data that is shared with the parent image. The
+// usage is calculated exactly, like `rbd du --exact`, which requires walking
+// all extents of the image and can be expensive for large images.
+func (rbdSnap *rbdSnapshot) GetQuotaUsage(ctx context.Context) (int64, error) {
+	return rbdSnap.quotaUsage(ctx, true)
+}
+
+// GetQuotaUsageEstimate returns the number of bytes that are referenced by
+// the snapshot like GetQuotaUsage, but counts complete RADOS objects, like
+// `rbd du` without --exact. With the fast-diff feature this only reads the
+// object-map of the image. Partially written objects are counted as
+// complete objects, so the usage can be larger than the exact usage.
+func (rbdSnap *rbdSnapshot) GetQuotaUsageEstimate(ctx context.Context) (int64, error) {
+	return rbdSnap.quotaUsage(ctx, false)
+}
+
+// quotaUsage implements GetQuotaUsage and GetQuotaUsageEstimate. The usage
+// is calculated on the clone that holds the RBD snapshot, not on the source
+// volume.
+func (rbdSnap *rbdSnapshot) quotaUsage(ctx context.Context, exact bool) (int64, error) {
+	used, err := rbdSnap.diskUsage(rbdSnap.snapImageName(), rbdSnap.RbdSnapName, exact)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get disk usage of snapshot %q: %v", rbdSnap, err)
+
+		return 0, err
+	}
+
+	return used, nil
+}
+
 // Delete removes the snapshot from the RBD image and then
 // the RBD image itself. If the backing RBD snapshot and image is removed
 // successfully, the reservation for the snapshot is removed from the journal.
@@ -357,7 +551,290 @@ func (rv *rbdVolume) NewSnapshotByID(
 	return snap, nil
 }
 
+// snapProtector contains the functions of librbd.Snapshot that are needed to
+// protect and unprotect a snapshot.
+type snapProtector interface {
+	IsProtected() (bool, error)
+	Protect() error
+	Unprotect() error
+}
+
+// protectSnapshot protects the snapshot, in case it is not protected yet.
+func protectSnapshot(snap snapProtector) error {
+	protected, err := snap.IsProtected()
+	if err != nil {
+		return fmt.Errorf("failed to check if snapshot is protected: %w", err)
+	}
+
+	if protected {
+		return nil
+	}
+
+	return snap.Protect()
+}
+
+// unprotectSnapshot removes the protection of the snapshot, in case it is
+// protected. ErrSnapHasChildren is returned when the snapshot has children.
+func unprotectSnapshot(snap snapProtector, children []string) error {
+	protected, err := snap.IsProtected()
+	if err != nil {
+		return fmt.Errorf("failed to check if snapshot is protected: %w", err)
+	}
+
+	if !protected {
+		return nil
+	}
+
+	if len(children) != 0 {
+		return fmt.Errorf("%w: %d clone(s) depend on it: %v", ErrSnapHasChildren, len(children), children)
+	}
+
+	return snap.Unprotect()
+}
+
+// openAtSnapshot opens the RBD image that holds the snapshot, with the RBD
+// snapshot as the source of readable data. The returned image must be closed
+// by the caller.
+func (rbdSnap *rbdSnapshot) openAtSnapshot(cr *util.Credentials) (*librbd.Image, error) {
+	err := rbdSnap.Connect(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rbdSnap.openIoctx()
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := librbd.OpenImage(rbdSnap.ioctx, rbdSnap.snapImageName(), rbdSnap.RbdSnapName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			err = fmt.Errorf("Failed as %w (internal %w)", ErrSnapNotFound, err)
+		}
+
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// Protect protects the snapshot so that it can be cloned. In case the
+// snapshot is already protected, nothing is done.
+func (rbdSnap *rbdSnapshot) Protect(ctx context.Context, cr *util.Credentials) error {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	err = protectSnapshot(image.GetSnapshot(rbdSnap.RbdSnapName))
+	if err != nil {
+		return fmt.Errorf("failed to protect snapshot %q: %w", rbdSnap, err)
+	}
+
+	log.DebugLog(ctx, "snapshot %q is protected", rbdSnap)
+
+	return nil
+}
+
+// Unprotect removes the protection of the snapshot. In case clones still
+// depend on the snapshot, an error wrapping ErrSnapHasChildren is returned.
+func (rbdSnap *rbdSnapshot) Unprotect(ctx context.Context, cr *util.Credentials) error {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	// ListChildren() returns pools, images, err.
+	_, children, err := image.ListChildren()
+	if err != nil {
+		return fmt.Errorf("failed to list children of snapshot %q: %w", rbdSnap, err)
+	}
+
+	err = unprotectSnapshot(image.GetSnapshot(rbdSnap.RbdSnapName), children)
+	if err != nil {
+		return fmt.Errorf("failed to unprotect snapshot %q: %w", rbdSnap, err)
+	}
+
+	log.DebugLog(ctx, "snapshot %q is unprotected", rbdSnap)
+
+	return nil
+}
+
+// flattenChildren calls flatten for each of the clones, identified by the
+// pool and image name. Flattening stops at the first failure, or when the
+// context is done.
+func flattenChildren(
+	ctx context.Context,
+	pools, images []string,
+	flatten func(ctx context.Context, pool, image string) error,
+) error {
+	for i := range images {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("aborted before flattening clone %s/%s: %w", pools[i], images[i], err)
+		}
+
+		err = flatten(ctx, pools[i], images[i])
+		if err != nil {
+			return fmt.Errorf("failed to flatten clone %s/%s: %w", pools[i], images[i], err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteWithForce flattens all clones that depend on the snapshot, and then
+// deletes the snapshot. Flattening copies all data from the snapshot into
+// the clones, which needs additional capacity in the cluster and can take a
+// long time for large images. When the context is done before all clones
+// are flattened, the snapshot is not deleted; clones that were flattened
+// remain flattened, and the flattening of the current clone is aborted.
+func (rbdSnap *rbdSnapshot) DeleteWithForce(ctx context.Context, cr *util.Credentials) error {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return err
+	}
+
+	pools, children, err := image.ListChildren()
+	image.Close()
+	if err != nil {
+		return fmt.Errorf("failed to list children of snapshot %q: %w", rbdSnap, err)
+	}
+
+	err = flattenChildren(ctx, pools, children, func(ctx context.Context, pool, name string) error {
+		child := &rbdVolume{}
+		child.conn = rbdSnap.conn.Copy()
+		child.ClusterID = rbdSnap.ClusterID
+		child.Monitors = rbdSnap.Monitors
+		child.Pool = pool
+		child.RadosNamespace = rbdSnap.RadosNamespace
+		child.RbdImageName = name
+		defer child.Destroy(ctx)
+
+		log.DebugLog(ctx, "flattening clone %q of snapshot %q", child, rbdSnap)
+
+		return child.flattenAndWait(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to force delete snapshot %q: %w", rbdSnap, err)
+	}
+
+	return rbdSnap.Delete(ctx)
+}
+
+// lastTouchedKey is the metadata key on the image of the snapshot that
+// contains the time the snapshot was last touched.
+const lastTouchedKey = "rbd.csi.ceph.com/last-touched"
+
+// metadataStore gets and sets the metadata of an image.
+type metadataStore interface {
+	GetMetadata(key string) (string, error)
+	SetMetadata(key, value string) error
+}
+
+// touchImage stores the time now in the metadata of the image.
+func touchImage(ms metadataStore, now time.Time) error {
+	return ms.SetMetadata(lastTouchedKey, now.UTC().Format(time.RFC3339Nano))
+}
+
+// getLastTouched returns the time that was stored by touchImage(), or nil in
+// case the image was never touched.
+func getLastTouched(ms metadataStore) (*time.Time, error) {
+	value, err := ms.GetMetadata(lastTouchedKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	touched, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q metadata %q: %w", lastTouchedKey, value, err)
+	}
+
+	return &touched, nil
+}
+
+// Touch records the current time in the metadata of the snapshot, which can
+// be used to track when the snapshot was last verified or accessed.
+func (rbdSnap *rbdSnapshot) Touch(ctx context.Context, cr *util.Credentials) error {
+	vol := rbdSnap.toVolume()
+	err := vol.Connect(cr)
+	if err != nil {
+		return err
+	}
+	defer vol.Destroy(ctx)
+
+	err = touchImage(vol, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to touch snapshot %q: %w", rbdSnap, err)
+	}
+
+	return nil
+}
+
+// GetLastTouched returns the time that was recorded by Touch(). In case the
+// snapshot was never touched, nil is returned.
+func (rbdSnap *rbdSnapshot) GetLastTouched(ctx context.Context) (*time.Time, error) {
+	if rbdSnap.conn == nil {
+		return nil, fmt.Errorf("can not get last touched time of unconnected snapshot %q", rbdSnap)
+	}
+
+	vol := rbdSnap.toVolume()
+	vol.conn = rbdSnap.conn.Copy()
+	defer vol.Destroy(ctx)
+
+	touched, err := getLastTouched(vol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last touched time of snapshot %q: %w", rbdSnap, err)
+	}
+
+	return touched, nil
+}
+
+// groupIDStore stores the volume group ID of a snapshot, it is implemented
+// by the journal.
+type groupIDStore interface {
+	StoreGroupID(ctx context.Context, pool, reservedUUID, groupID string) error
+	RemoveGroupID(ctx context.Context, pool, reservedUUID string) error
+}
+
+// SetVolumeGroup sets the CSI volume group ID in the journal of the snapshot.
+// Setting the group ID that is already set is a no-op, an empty groupID
+// clears the group like ClearVolumeGroup() does.
 func (rbdSnap *rbdSnapshot) SetVolumeGroup(ctx context.Context, cr *util.Credentials, groupID string) error {
+	if groupID == rbdSnap.groupID {
+		log.DebugLog(ctx, "snapshot %q is already in volume group %q", rbdSnap, groupID)
+
+		return nil
+	}
+
+	return rbdSnap.withGroupIDStore(cr, func(store groupIDStore, uuid string) error {
+		return rbdSnap.setVolumeGroup(ctx, store, uuid, groupID)
+	})
+}
+
+// ClearVolumeGroup removes the CSI volume group ID from the journal of the
+// snapshot. Clearing the group of a snapshot that is not in a group is a
+// no-op.
+func (rbdSnap *rbdSnapshot) ClearVolumeGroup(ctx context.Context, cr *util.Credentials) error {
+	return rbdSnap.SetVolumeGroup(ctx, cr, "")
+}
+
+// GetVolumeGroup returns the CSI volume group ID of the snapshot, or an empty
+// string when the snapshot is not in a group.
+func (rbdSnap *rbdSnapshot) GetVolumeGroup(_ context.Context) (string, error) {
+	return rbdSnap.groupID, nil
+}
+
+// withGroupIDStore connects to the snapshot journal, and calls fn with the
+// journal and the UUID of the snapshot in the journal.
+func (rbdSnap *rbdSnapshot) withGroupIDStore(
+	cr *util.Credentials,
+	fn func(store groupIDStore, uuid string) error,
+) error {
 	vi := util.CSIIdentifier{}
 	err := vi.DecomposeCSIID(rbdSnap.VolID)
 	if err != nil {
@@ -370,9 +847,24 @@ func (rbdSnap *rbdSnapshot) SetVolumeGroup(ctx context.Context, cr *util.Credent
 	}
 	defer j.Destroy()
 
-	err = j.StoreGroupID(ctx, rbdSnap.Pool, vi.ObjectUUID, groupID)
+	return fn(j, vi.ObjectUUID)
+}
+
+// setVolumeGroup stores groupID in store, or removes it when groupID is
+// empty, and caches it in the snapshot.
+func (rbdSnap *rbdSnapshot) setVolumeGroup(ctx context.Context, store groupIDStore, uuid, groupID string) error {
+	if groupID == rbdSnap.groupID {
+		return nil
+	}
+
+	var err error
+	if groupID == "" {
+		err = store.RemoveGroupID(ctx, rbdSnap.Pool, uuid)
+	} else {
+		err = store.StoreGroupID(ctx, rbdSnap.Pool, uuid, groupID)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to set volume group ID for snapshot %q: %w", rbdSnap, err)
+		return fmt.Errorf("failed to set volume group ID %q for snapshot %q: %w", groupID, rbdSnap, err)
 	}
 
 	rbdSnap.groupID = groupID
@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// childLister lists the clones of a snapshot, like librbd.Image does for the
+// snapshot that the image was opened at.
+type childLister interface {
+	ListChildren() (pools []string, images []string, err error)
+}
+
+// countChildren returns the number of clones that cl lists.
+func countChildren(cl childLister) (int, error) {
+	_, children, err := cl.ListChildren()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(children), nil
+}
+
+// GetChildCount returns the number of clones that depend on the snapshot.
+// Unlike ListClones(), the clones are not resolved to their volume IDs, so
+// the journal is not needed. This makes it cheap to check if the snapshot
+// can be deleted.
+func (rbdSnap *rbdSnapshot) GetChildCount(_ context.Context, cr *util.Credentials) (int, error) {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return 0, err
+	}
+	defer image.Close()
+
+	count, err := countChildren(image)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list children of snapshot %q: %w", rbdSnap, err)
+	}
+
+	return count, nil
+}
+
+// cloneResolver returns the CSI volume ID of the clone with the given pool
+// and image name.
+type cloneResolver func(ctx context.Context, pool, image string) (string, error)
+
+// cloneVolumeIDs resolves the clones, identified by the pool and image name,
+// to their CSI volume IDs. An empty slice is returned when there are no
+// clones.
+func cloneVolumeIDs(ctx context.Context, pools, images []string, resolve cloneResolver) ([]string, error) {
+	volIDs := make([]string, 0, len(images))
+	for i := range images {
+		volID, err := resolve(ctx, pools[i], images[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve clone %s/%s: %w", pools[i], images[i], err)
+		}
+
+		volIDs = append(volIDs, volID)
+	}
+
+	return volIDs, nil
+}
+
+// ListClones returns the CSI volume IDs of the volumes that were cloned from
+// the snapshot. The names of the cloned images are resolved to their volume
+// IDs with the journal, an error is returned for clones that were not
+// created by Ceph-CSI.
+func (rbdSnap *rbdSnapshot) ListClones(ctx context.Context, cr *util.Credentials) ([]string, error) {
+	image, err := rbdSnap.openAtSnapshot(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	pools, children, err := image.ListChildren()
+	image.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children of snapshot %q: %w", rbdSnap, err)
+	}
+
+	if len(children) == 0 {
+		return []string{}, nil
+	}
+
+	j, err := volJournal.Connect(rbdSnap.Monitors, rbdSnap.RadosNamespace, cr)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %q failed to connect to journal: %w", rbdSnap, err)
+	}
+	defer j.Destroy()
+
+	return cloneVolumeIDs(ctx, pools, children, func(ctx context.Context, pool, name string) (string, error) {
+		return rbdSnap.cloneVolumeID(ctx, j, cr, pool, name)
+	})
+}
+
+// cloneVolumeID returns the CSI volume ID of the clone with the given pool
+// and image name. The UUID at the end of the image name needs to be reserved
+// in the journal for the same image.
+func (rbdSnap *rbdSnapshot) cloneVolumeID(
+	ctx context.Context,
+	j *journal.Connection,
+	cr *util.Credentials,
+	pool, name string,
+) (string, error) {
+	id, ok := snapshotUUID(name, "")
+	if !ok {
+		return "", fmt.Errorf("image name %q does not contain a UUID", name)
+	}
+
+	attrs, err := j.GetImageAttributes(ctx, pool, id, false)
+	if err != nil {
+		return "", err
+	}
+	if attrs.ImageName != name {
+		return "", fmt.Errorf("UUID %q is reserved for image %q in the journal", id, attrs.ImageName)
+	}
+
+	return util.GenerateVolID(ctx, rbdSnap.Monitors, cr, util.InvalidPoolID, pool, rbdSnap.ClusterID, id)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneVolumeIDs(t *testing.T) {
+	t.Parallel()
+
+	resolve := func(_ context.Context, pool, image string) (string, error) {
+		return "vol-" + pool + "-" + image, nil
+	}
+
+	tests := []struct {
+		name   string
+		pools  []string
+		images []string
+		want   []string
+	}{
+		{
+			name: "no clones",
+			want: []string{},
+		},
+		{
+			name:   "one clone",
+			pools:  []string{"replicapool"},
+			images: []string{"csi-vol-1"},
+			want:   []string{"vol-replicapool-csi-vol-1"},
+		},
+		{
+			name:   "multiple clones",
+			pools:  []string{"replicapool", "ecpool", "replicapool"},
+			images: []string{"csi-vol-1", "csi-vol-2", "csi-vol-3"},
+			want: []string{
+				"vol-replicapool-csi-vol-1",
+				"vol-ecpool-csi-vol-2",
+				"vol-replicapool-csi-vol-3",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := cloneVolumeIDs(context.TODO(), tt.pools, tt.images, resolve)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("unresolvable clone", func(t *testing.T) {
+		t.Parallel()
+		errNotJournalled := errors.New("not in the journal")
+		_, err := cloneVolumeIDs(context.TODO(),
+			[]string{"replicapool", "replicapool"},
+			[]string{"csi-vol-1", "manual-image"},
+			func(_ context.Context, _, image string) (string, error) {
+				if image == "manual-image" {
+					return "", errNotJournalled
+				}
+
+				return "vol-1", nil
+			})
+		require.ErrorIs(t, err, errNotJournalled)
+		require.ErrorContains(t, err, "replicapool/manual-image")
+	})
+}
+
+// fakeChildLister implements the childLister interface.
+type fakeChildLister struct {
+	pools  []string
+	images []string
+	err    error
+}
+
+func (fcl *fakeChildLister) ListChildren() ([]string, []string, error) {
+	return fcl.pools, fcl.images, fcl.err
+}
+
+func TestCountChildren(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		lister  *fakeChildLister
+		want    int
+		wantErr bool
+	}{
+		{
+			name:   "no children",
+			lister: &fakeChildLister{},
+			want:   0,
+		},
+		{
+			name: "several children",
+			lister: &fakeChildLister{
+				pools:  []string{"replicapool", "ecpool", "replicapool"},
+				images: []string{"csi-vol-1", "csi-vol-2", "manual-image"},
+			},
+			want: 3,
+		},
+		{
+			name:    "listing fails",
+			lister:  &fakeChildLister{err: errors.New("connection lost")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := countChildren(tt.lister)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// copyPipelineTimeout is the timeout for streaming a snapshot to another
+// cluster with `rbd export | rbd import`.
+const copyPipelineTimeout = 2 * time.Hour
+
+// pipeFunc runs a pipeline of commands, like util.ExecPipe.
+type pipeFunc func(ctx context.Context, timeout time.Duration, cmds [][]string) (string, string, error)
+
+// copyDestination is the pool and cluster that a snapshot is copied to.
+type copyDestination struct {
+	clusterID string
+	pool      string
+}
+
+// parseCopyDestination splits destPool in the optional cluster ID and the
+// pool. destPool is either "<pool>", for a pool in the cluster of the
+// snapshot, or "<clusterID>/<pool>" for a pool in another cluster from the
+// CSI configuration.
+func parseCopyDestination(clusterID, destPool string) (*copyDestination, error) {
+	dest := &copyDestination{clusterID: clusterID, pool: destPool}
+	if before, after, found := strings.Cut(destPool, "/"); found {
+		dest.clusterID = before
+		dest.pool = after
+	}
+
+	if dest.clusterID == "" || dest.pool == "" || strings.Contains(dest.pool, "/") {
+		return nil, fmt.Errorf("%w: invalid destination pool %q, expected <pool> or <clusterID>/<pool>",
+			ErrInvalidArgument, destPool)
+	}
+
+	return dest, nil
+}
+
+// exportImportCommands returns the `rbd export | rbd import` pipeline that
+// streams the data of the snapshot src to the image dst in another cluster.
+// srcConf and dstConf are the ceph.conf files of the two clusters.
+func exportImportCommands(
+	src *rbdSnapshot,
+	srcCreds *util.Credentials,
+	srcConf string,
+	dst *rbdVolume,
+	dstCreds *util.Credentials,
+	dstConf string,
+) [][]string {
+	return [][]string{
+		{
+			"rbd", "export",
+			"--id", srcCreds.ID,
+			"-m", src.Monitors,
+			"--keyfile=" + srcCreds.KeyFile,
+			"-c", srcConf,
+			src.snapSpec(), "-",
+		},
+		{
+			"rbd", "import",
+			"--id", dstCreds.ID,
+			"-m", dst.Monitors,
+			"--keyfile=" + dstCreds.KeyFile,
+			"-c", dstConf,
+			"-", dst.String(),
+		},
+	}
+}
+
+// CopyTo copies the data of the snapshot to a new image in destPool, and
+// returns the CSI volume ID of the new image. destName is used as request
+// name to reserve the image in the journal, the name of the image is
+// generated like for other volumes. destPool is either "<pool>" to copy
+// within the cluster of the snapshot, or "<clusterID>/<pool>" to copy the
+// snapshot to another cluster, in which case the data is streamed with `rbd
+// export | rbd import`.
+func (rbdSnap *rbdSnapshot) CopyTo(
+	ctx context.Context,
+	destCreds *util.Credentials,
+	destPool, destName string,
+) (string, error) {
+	return rbdSnap.copyTo(ctx, destCreds, destPool, destName, util.ExecPipe)
+}
+
+// copyTo implements CopyTo(), pipe runs the pipeline of commands for copying
+// the snapshot to another cluster.
+func (rbdSnap *rbdSnapshot) copyTo(
+	ctx context.Context,
+	destCreds *util.Credentials,
+	destPool, destName string,
+	pipe pipeFunc,
+) (string, error) {
+	if destName == "" {
+		return "", fmt.Errorf("%w: destination name is empty", ErrInvalidArgument)
+	}
+	if rbdSnap.conn == nil {
+		return "", fmt.Errorf("snapshot %q is not connected to the cluster", rbdSnap)
+	}
+
+	dest, err := parseCopyDestination(rbdSnap.ClusterID, destPool)
+	if err != nil {
+		return "", err
+	}
+
+	dstVol, err := newCopyDestinationVolume(ctx, dest, destName)
+	if err != nil {
+		return "", err
+	}
+	defer dstVol.Destroy(ctx)
+
+	err = reserveVol(ctx, dstVol, destCreds)
+	if err != nil {
+		return "", fmt.Errorf("failed to reserve destination for %q: %w", destName, err)
+	}
+
+	err = rbdSnap.copyData(ctx, dstVol, destCreds, pipe)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to copy snapshot %q to %q: %v", rbdSnap, dstVol, err)
+		undoCopy(ctx, dstVol,
+			func() error {
+				return deleteCopyDestination(ctx, dstVol)
+			},
+			func() error {
+				return undoVolReservation(ctx, dstVol, destCreds)
+			})
+
+		return "", err
+	}
+
+	log.DebugLog(ctx, "copied snapshot %q to image %q with volume ID %q", rbdSnap, dstVol, dstVol.VolID)
+
+	return dstVol.VolID, nil
+}
+
+// undoCopy cleans up after a failed copy to dst. The image that the copy may
+// have created partially is deleted before the reservation of the image in
+// the journal is undone. When deleting the image fails, the reservation is
+// kept, so that the image is not leaked.
+func undoCopy(ctx context.Context, dst *rbdVolume, deleteImage, undoReservation func() error) {
+	err := deleteImage()
+	if err != nil {
+		log.ErrorLog(ctx, "failed to delete partially copied image %q, keeping its reservation: %v", dst, err)
+
+		return
+	}
+
+	err = undoReservation()
+	if err != nil {
+		log.ErrorLog(ctx, "failed to undo reservation for %q: %v", dst, err)
+	}
+}
+
+// deleteCopyDestination deletes the image of dst, in case the failed copy
+// created it.
+func deleteCopyDestination(ctx context.Context, dst *rbdVolume) error {
+	if dst.conn == nil {
+		// the copy failed before connecting, no image was created
+		return nil
+	}
+
+	err := dst.Delete(ctx)
+	if err != nil && !errors.Is(err, ErrImageNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// newCopyDestinationVolume returns the rbdVolume for the image that a
+// snapshot is copied to, with the monitors and rados namespace of the
+// destination cluster.
+func newCopyDestinationVolume(ctx context.Context, dest *copyDestination, destName string) (*rbdVolume, error) {
+	monitors, clusterID, err := util.GetMonsAndClusterID(ctx, dest.clusterID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monitors of cluster %q: %w", dest.clusterID, err)
+	}
+
+	radosNamespace, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	vol := &rbdVolume{}
+	vol.ClusterID = clusterID
+	vol.Monitors = monitors
+	vol.Pool = dest.pool
+	vol.JournalPool = dest.pool
+	vol.RadosNamespace = radosNamespace
+	vol.RequestName = destName
+
+	return vol, nil
+}
+
+// copyData copies the data of the snapshot to the reserved image of dst, and
+// stores the ID of the new image in the journal.
+func (rbdSnap *rbdSnapshot) copyData(
+	ctx context.Context,
+	dst *rbdVolume,
+	destCreds *util.Credentials,
+	pipe pipeFunc,
+) error {
+	err := dst.Connect(destCreds)
+	if err != nil {
+		return err
+	}
+
+	if dst.ClusterID == rbdSnap.ClusterID {
+		err = rbdSnap.copyWithinCluster(dst)
+	} else {
+		err = rbdSnap.copyAcrossClusters(ctx, dst, destCreds, pipe)
+	}
+	if err != nil {
+		return err
+	}
+
+	j, err := volJournal.Connect(dst.Monitors, dst.RadosNamespace, destCreds)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return dst.storeImageID(ctx, j)
+}
+
+// copyWithinCluster copies the data of the snapshot to the image of dst,
+// which is in the same cluster as the snapshot.
+func (rbdSnap *rbdSnapshot) copyWithinCluster(dst *rbdVolume) error {
+	image, err := rbdSnap.openAtSnapshot(rbdSnap.conn.Creds)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	err = dst.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	err = image.Copy(dst.ioctx, dst.RbdImageName)
+	if err != nil {
+		return fmt.Errorf("failed to copy snapshot %q to %q: %w", rbdSnap, dst, err)
+	}
+
+	return nil
+}
+
+// copyAcrossClusters streams the data of the snapshot to the image of dst in
+// another cluster with `rbd export | rbd import`.
+func (rbdSnap *rbdSnapshot) copyAcrossClusters(
+	ctx context.Context,
+	dst *rbdVolume,
+	destCreds *util.Credentials,
+	pipe pipeFunc,
+) error {
+	srcConf, err := util.GetEffectiveCephConfFile(util.CsiConfigFile, rbdSnap.ClusterID, rbdSnap.Monitors)
+	if err != nil {
+		return err
+	}
+	dstConf, err := util.GetEffectiveCephConfFile(util.CsiConfigFile, dst.ClusterID, dst.Monitors)
+	if err != nil {
+		return err
+	}
+
+	cmds := exportImportCommands(rbdSnap, rbdSnap.conn.Creds, srcConf, dst, destCreds, dstConf)
+	_, stderr, err := pipe(ctx, copyPipelineTimeout, cmds)
+	if err != nil {
+		return fmt.Errorf("failed to stream snapshot %q to %q: %w (stderr: %s)", rbdSnap, dst, err, stderr)
+	}
+
+	return nil
+}
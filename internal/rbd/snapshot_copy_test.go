@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCopyDestination(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		destPool string
+		want     *copyDestination
+		wantErr  bool
+	}{
+		{
+			name:     "same cluster",
+			destPool: "replicapool",
+			want:     &copyDestination{clusterID: "cluster-1", pool: "replicapool"},
+		},
+		{
+			name:     "other cluster",
+			destPool: "cluster-2/backup",
+			want:     &copyDestination{clusterID: "cluster-2", pool: "backup"},
+		},
+		{
+			name:     "empty pool",
+			destPool: "",
+			wantErr:  true,
+		},
+		{
+			name:     "empty cluster",
+			destPool: "/backup",
+			wantErr:  true,
+		},
+		{
+			name:     "too many components",
+			destPool: "cluster-2/backup/ns",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseCopyDestination("cluster-1", tt.destPool)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidArgument)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCopyAcrossClusters(t *testing.T) {
+	t.Parallel()
+
+	srcCreds := &util.Credentials{ID: "src-user", KeyFile: "/tmp/src-key"}
+	dstCreds := &util.Credentials{ID: "dst-user", KeyFile: "/tmp/dst-key"}
+
+	// the RBD snapshot is on the clone image csi-snap-4f5b6e2a, not on the
+	// source volume
+	snap := newResolvedTestSnapshot("")
+	snap.ClusterID = "cluster-1"
+	snap.Monitors = "10.0.0.1:6789"
+	snap.conn = &util.ClusterConnection{Creds: srcCreds}
+
+	dst := &rbdVolume{}
+	dst.ClusterID = "cluster-2"
+	dst.Monitors = "10.0.1.1:6789"
+	dst.Pool = "backup"
+	dst.RadosNamespace = "ns"
+	dst.RbdImageName = "csi-vol-2"
+
+	wantCmds := [][]string{
+		{
+			"rbd", "export",
+			"--id", "src-user", "-m", "10.0.0.1:6789", "--keyfile=/tmp/src-key",
+			"-c", util.CephConfigPath,
+			"replicapool/csi-snap-4f5b6e2a@csi-snap-4f5b6e2a", "-",
+		},
+		{
+			"rbd", "import",
+			"--id", "dst-user", "-m", "10.0.1.1:6789", "--keyfile=/tmp/dst-key",
+			"-c", util.CephConfigPath,
+			"-", "backup/ns/csi-vol-2",
+		},
+	}
+
+	var gotCmds [][]string
+	pipe := func(_ context.Context, _ time.Duration, cmds [][]string) (string, string, error) {
+		gotCmds = cmds
+
+		return "", "", nil
+	}
+	err := snap.copyAcrossClusters(context.TODO(), dst, dstCreds, pipe)
+	require.NoError(t, err)
+	require.Equal(t, wantCmds, gotCmds)
+
+	errPipe := errors.New("exit status 1")
+	failingPipe := func(_ context.Context, _ time.Duration, _ [][]string) (string, string, error) {
+		return "", "rbd: import failed", errPipe
+	}
+	err = snap.copyAcrossClusters(context.TODO(), dst, dstCreds, failingPipe)
+	require.ErrorIs(t, err, errPipe)
+	require.ErrorContains(t, err, "rbd: import failed")
+}
+
+func TestUndoCopy(t *testing.T) {
+	t.Parallel()
+
+	dst := &rbdVolume{}
+	dst.Pool = "backup"
+	dst.RbdImageName = "csi-vol-2"
+
+	var calls []string
+	deleteImage := func() error {
+		calls = append(calls, "delete")
+
+		return nil
+	}
+	undoReservation := func() error {
+		calls = append(calls, "undo")
+
+		return nil
+	}
+	undoCopy(context.TODO(), dst, deleteImage, undoReservation)
+	// the image is deleted before its reservation is undone
+	require.Equal(t, []string{"delete", "undo"}, calls)
+
+	calls = nil
+	failingDelete := func() error {
+		calls = append(calls, "delete")
+
+		return errors.New("image is busy")
+	}
+	undoCopy(context.TODO(), dst, failingDelete, undoReservation)
+	// the reservation is kept when the image could not be deleted
+	require.Equal(t, []string{"delete"}, calls)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// rbdSnapshotCreator creates RBD snapshots for types.NewSnapshot().
+type rbdSnapshotCreator struct{}
+
+var _ = types.RegisterSnapshotCreator(rbdSnapshotCreator{})
+
+// CreateSnapshot creates the snapshot in the same way as the CreateSnapshot
+// procedure of the ControllerServer, without updating the metadata of the
+// snapshot image. When the snapshot already exists, the existing snapshot is
+// returned.
+func (rbdSnapshotCreator) CreateSnapshot(
+	ctx context.Context,
+	cr *util.Credentials,
+	sourceVolID, name string,
+	params map[string]string,
+) (types.Snapshot, error) {
+	rbdVol, err := GenVolFromVolID(ctx, sourceVolID, cr, nil)
+	if rbdVol != nil {
+		defer rbdVol.Destroy(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source volume %q: %w", sourceVolID, err)
+	}
+
+	if !rbdVol.hasSnapshotFeature() {
+		return nil, fmt.Errorf("volume %q does not have the snapshot feature (layering)", sourceVolID)
+	}
+
+	rbdSnap, err := genSnapFromOptions(ctx, rbdVol, params)
+	if err != nil {
+		return nil, err
+	}
+	rbdSnap.RbdImageName = rbdVol.RbdImageName
+	rbdSnap.VolSize = rbdVol.VolSize
+	rbdSnap.SourceVolumeID = sourceVolID
+	rbdSnap.RequestName = name
+
+	found, err := checkSnapCloneExists(ctx, rbdVol, rbdSnap, cr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing snapshot %q: %w", name, err)
+	}
+
+	if !found {
+		err = createJournalledSnapshot(ctx, rbdVol, rbdSnap, cr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = rbdSnap.Connect(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	return rbdSnap, nil
+}
+
+// createJournalledSnapshot reserves the snapshot in the journal and creates
+// the snapshot image. The reservation is removed when creating the snapshot
+// image fails.
+func createJournalledSnapshot(
+	ctx context.Context,
+	rbdVol *rbdVolume,
+	rbdSnap *rbdSnapshot,
+	cr *util.Credentials,
+) error {
+	err := rbdVol.PrepareVolumeForSnapshot(ctx, cr)
+	if err != nil {
+		return err
+	}
+
+	err = reserveSnap(ctx, rbdSnap, rbdVol, cr)
+	if err != nil {
+		return fmt.Errorf("failed to reserve snapshot %q: %w", rbdSnap.RequestName, err)
+	}
+	defer func() {
+		if err != nil && !errors.Is(err, ErrFlattenInProgress) {
+			undoErr := undoSnapReservation(ctx, rbdSnap, cr)
+			if undoErr != nil {
+				log.WarningLog(ctx, "failed undoing reservation of snapshot %q: %v", rbdSnap.RequestName, undoErr)
+			}
+		}
+	}()
+
+	_, err = doSnapshotClone(ctx, rbdVol, rbdSnap, cr)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot %q: %w", rbdSnap.RequestName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// checksumKey is the metadata key on the image of the snapshot that
+	// contains the checksum of the data of the snapshot.
+	checksumKey = "rbd.csi.ceph.com/checksum"
+
+	// checksumParameter is the VolumeSnapshotClass parameter that enables
+	// storing a checksum when the snapshot is created. The value is the
+	// checksum mode.
+	checksumParameter = "checksum"
+
+	// checksumModeFull calculates the checksum over all data.
+	checksumModeFull = "full"
+	// checksumModeSampled calculates the checksum over one of every
+	// checksumSampleStride chunks, which is faster for large images, but
+	// only detects corruption in the sampled chunks.
+	checksumModeSampled = "sampled"
+
+	// checksumChunkSize is the size of the chunks that are read.
+	checksumChunkSize = 4 * 1024 * 1024
+	// checksumSampleStride is the distance in chunks between the sampled
+	// chunks.
+	checksumSampleStride = 16
+)
+
+// ErrNoChecksum is returned by VerifyIntegrity when no checksum was stored
+// for the snapshot.
+var ErrNoChecksum = errors.New("no checksum stored")
+
+// calculateChecksum returns the sha256 checksum of the size bytes in r. In
+// sampled mode only one of every checksumSampleStride chunks is read. The
+// size is part of the checksum, so that a resized image does not match.
+func calculateChecksum(ctx context.Context, r io.ReaderAt, size int64, mode string) (string, error) {
+	stride := int64(checksumChunkSize)
+	switch mode {
+	case checksumModeFull:
+	case checksumModeSampled:
+		stride *= checksumSampleStride
+	default:
+		return "", fmt.Errorf("%w: invalid checksum mode %q, valid options are %q and %q",
+			ErrInvalidArgument, mode, checksumModeFull, checksumModeSampled)
+	}
+
+	hash := sha256.New()
+	hash.Write(binary.LittleEndian.AppendUint64(nil, uint64(size)))
+
+	data := make([]byte, checksumChunkSize)
+	for offset := int64(0); offset < size; offset += stride {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		chunk := data[:min(checksumChunkSize, size-offset)]
+		n, err := r.ReadAt(chunk, offset)
+		if err != nil && !(errors.Is(err, io.EOF) && n == len(chunk)) {
+			return "", fmt.Errorf("failed to read %d bytes at offset %d: %w", len(chunk), offset, err)
+		}
+		hash.Write(chunk)
+	}
+
+	return mode + ":sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// storeChecksum calculates the checksum of the data in r, and stores it in
+// the metadata.
+func storeChecksum(ctx context.Context, ms metadataStore, r io.ReaderAt, size int64, mode string) error {
+	checksum, err := calculateChecksum(ctx, r, size, mode)
+	if err != nil {
+		return err
+	}
+
+	return ms.SetMetadata(checksumKey, checksum)
+}
+
+// verifyChecksum calculates the checksum of the data in r, in the same mode
+// as the checksum in the metadata was calculated, and returns true when
+// both checksums are the same.
+func verifyChecksum(ctx context.Context, ms metadataStore, r io.ReaderAt, size int64) (bool, error) {
+	stored, err := ms.GetMetadata(checksumKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return false, ErrNoChecksum
+	} else if err != nil {
+		return false, err
+	}
+
+	mode, _, found := strings.Cut(stored, ":")
+	if !found {
+		return false, fmt.Errorf("failed to parse %q metadata %q", checksumKey, stored)
+	}
+
+	checksum, err := calculateChecksum(ctx, r, size, mode)
+	if err != nil {
+		return false, err
+	}
+
+	return checksum == stored, nil
+}
+
+// openSnapshotData opens the image that holds the data of the snapshot, at
+// the RBD snapshot. The returned image must be closed by the caller.
+func (rbdSnap *rbdSnapshot) openSnapshotData(vol *rbdVolume) (*librbd.Image, int64, error) {
+	err := vol.openIoctx()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	image, err := librbd.OpenImageReadOnly(vol.ioctx, vol.RbdImageName, rbdSnap.RbdSnapName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			err = fmt.Errorf("Failed as %w (internal %w)", ErrSnapNotFound, err)
+		}
+
+		return nil, 0, err
+	}
+
+	size, err := image.GetSize()
+	if err != nil {
+		image.Close()
+
+		return nil, 0, fmt.Errorf("failed to get size of snapshot %q: %w", rbdSnap, err)
+	}
+
+	return image, int64(size), nil
+}
+
+// StoreChecksum calculates the checksum of the data of the snapshot, and
+// stores it in the metadata of the image of the snapshot. When sampled is
+// set, only a part of the data is read.
+func (rbdSnap *rbdSnapshot) StoreChecksum(ctx context.Context, cr *util.Credentials, sampled bool) error {
+	vol := rbdSnap.toVolume()
+	err := vol.Connect(cr)
+	if err != nil {
+		return err
+	}
+	defer vol.Destroy(ctx)
+
+	image, size, err := rbdSnap.openSnapshotData(vol)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	mode := checksumModeFull
+	if sampled {
+		mode = checksumModeSampled
+	}
+
+	err = storeChecksum(ctx, vol, image, size, mode)
+	if err != nil {
+		return fmt.Errorf("failed to store checksum of snapshot %q: %w", rbdSnap, err)
+	}
+
+	log.DebugLog(ctx, "stored %s checksum of snapshot %q", mode, rbdSnap)
+
+	return nil
+}
+
+// VerifyIntegrity calculates the checksum of the data of the snapshot, and
+// compares it with the checksum that was stored with StoreChecksum().
+func (rbdSnap *rbdSnapshot) VerifyIntegrity(ctx context.Context, cr *util.Credentials) (bool, error) {
+	vol := rbdSnap.toVolume()
+	err := vol.Connect(cr)
+	if err != nil {
+		return false, err
+	}
+	defer vol.Destroy(ctx)
+
+	image, size, err := rbdSnap.openSnapshotData(vol)
+	if err != nil {
+		return false, err
+	}
+	defer image.Close()
+
+	valid, err := verifyChecksum(ctx, vol, image, size)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify integrity of snapshot %q: %w", rbdSnap, err)
+	}
+
+	if !valid {
+		log.WarningLog(ctx, "checksum of snapshot %q does not match", rbdSnap)
+	}
+
+	return valid, nil
+}
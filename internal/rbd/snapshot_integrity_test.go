@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	// not a multiple of the chunk size, with more chunks than the stride
+	size := int64(checksumChunkSize*(checksumSampleStride+2) + 123)
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	for _, mode := range []string{checksumModeFull, checksumModeSampled} {
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+
+			content := bytes.Clone(data)
+			ms := fakeMetadataStore{}
+			require.NoError(t, storeChecksum(ctx, ms, bytes.NewReader(content), size, mode))
+			require.Contains(t, ms[checksumKey], mode+":sha256:")
+
+			valid, err := verifyChecksum(ctx, ms, bytes.NewReader(content), size)
+			require.NoError(t, err)
+			require.True(t, valid)
+
+			// modify data in the first chunk, which is always sampled
+			content[10]++
+			valid, err = verifyChecksum(ctx, ms, bytes.NewReader(content), size)
+			require.NoError(t, err)
+			require.False(t, valid)
+			content[10]--
+
+			// a resized image does not match
+			valid, err = verifyChecksum(ctx, ms, bytes.NewReader(content), size-1)
+			require.NoError(t, err)
+			require.False(t, valid)
+		})
+	}
+
+	t.Run("sampled skips chunks", func(t *testing.T) {
+		t.Parallel()
+
+		content := bytes.Clone(data)
+		ms := fakeMetadataStore{}
+		require.NoError(t, storeChecksum(ctx, ms, bytes.NewReader(content), size, checksumModeSampled))
+
+		// the second chunk is not sampled
+		content[checksumChunkSize+10]++
+		valid, err := verifyChecksum(ctx, ms, bytes.NewReader(content), size)
+		require.NoError(t, err)
+		require.True(t, valid)
+	})
+
+	t.Run("no checksum", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := verifyChecksum(ctx, fakeMetadataStore{}, bytes.NewReader(data), size)
+		require.ErrorIs(t, err, ErrNoChecksum)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		t.Parallel()
+
+		err := storeChecksum(ctx, fakeMetadataStore{}, bytes.NewReader(data), size, "quick")
+		require.ErrorIs(t, err, ErrInvalidArgument)
+
+		ms := fakeMetadataStore{checksumKey: "garbage"}
+		_, err = verifyChecksum(ctx, ms, bytes.NewReader(data), size)
+		require.Error(t, err)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		err := storeChecksum(canceled, fakeMetadataStore{}, bytes.NewReader(data), size, checksumModeFull)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/google/uuid"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// defaultSnapshotNamePrefix is the prefix of the RBD images that back a
+// snapshot, when the StorageClass does not set snapshotNamePrefix.
+const defaultSnapshotNamePrefix = "csi-snap-"
+
+// snapshotResolver returns the Snapshot that is backed by the RBD image with
+// the given UUID.
+type snapshotResolver func(ctx context.Context, uuid string) (types.Snapshot, error)
+
+// snapshotUUID returns the UUID of the snapshot from the name of the RBD
+// image. The name needs to start with the prefix and end with the UUID that
+// was reserved in the journal.
+func snapshotUUID(imageName, prefix string) (string, bool) {
+	if !strings.HasPrefix(imageName, prefix) || len(imageName) < len(prefix)+36 {
+		return "", false
+	}
+
+	id := imageName[len(imageName)-36:]
+	if uuid.Validate(id) != nil {
+		return "", false
+	}
+
+	return id, true
+}
+
+// matchSnapshot checks if the snapshot matches the SourceVolumeID and MinAge
+// of the filter.
+func matchSnapshot(ctx context.Context, snap types.Snapshot, filter types.SnapshotFilter, now time.Time) (bool, error) {
+	if filter.SourceVolumeID == "" && filter.MinAge == 0 {
+		return true, nil
+	}
+
+	csiSnap, err := snap.ToCSI(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if filter.SourceVolumeID != "" && csiSnap.GetSourceVolumeId() != filter.SourceVolumeID {
+		return false, nil
+	}
+
+	if filter.MinAge != 0 && csiSnap.GetCreationTime().AsTime().After(now.Add(-filter.MinAge)) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// iterateSnapshots calls fn for each of the images that is a snapshot
+// matching the filter. Snapshots are only resolved when the image name
+// matches the prefix of the filter, and are destroyed after fn returns.
+// Images that are not (or no longer) a snapshot in the journal are skipped.
+func iterateSnapshots(
+	ctx context.Context,
+	imageNames []string,
+	filter types.SnapshotFilter,
+	resolve snapshotResolver,
+	fn func(types.Snapshot) error,
+) error {
+	prefix := filter.NamePrefix
+	if prefix == "" {
+		prefix = defaultSnapshotNamePrefix
+	}
+
+	now := time.Now()
+	for _, name := range imageNames {
+		id, ok := snapshotUUID(name, prefix)
+		if !ok {
+			continue
+		}
+
+		err := func() error {
+			snap, err := resolve(ctx, id)
+			if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrObjectNotFound) {
+				log.DebugLog(ctx, "image %q is not a snapshot: %v", name, err)
+
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to resolve snapshot for image %q: %w", name, err)
+			}
+			defer snap.Destroy(ctx)
+
+			match, err := matchSnapshot(ctx, snap, filter, now)
+			if err != nil || !match {
+				return err
+			}
+
+			return fn(snap)
+		}()
+		if errors.Is(err, types.ErrStopIteration) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (mgr *rbdManager) IterateSnapshots(
+	ctx context.Context,
+	pool string,
+	filter types.SnapshotFilter,
+	fn func(types.Snapshot) error,
+) error {
+	creds, err := mgr.getCredentials()
+	if err != nil {
+		return err
+	}
+
+	clusterID, err := util.GetClusterID(mgr.parameters)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster-id: %w", err)
+	}
+
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to find MONs for cluster %q: %w", clusterID, err)
+	}
+
+	ns, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to find the RADOS namespace for cluster %q: %w", clusterID, err)
+	}
+
+	poolID, err := util.GetPoolID(monitors, creds, pool)
+	if err != nil {
+		return fmt.Errorf("failed to get the ID of pool %q: %w", pool, err)
+	}
+
+	// rbdImage without an image name, only used for the connection to the pool
+	poolImage := &rbdImage{
+		Monitors:       monitors,
+		Pool:           pool,
+		RadosNamespace: ns,
+	}
+	defer poolImage.Destroy(ctx)
+
+	err = poolImage.Connect(creds)
+	if err != nil {
+		return err
+	}
+
+	err = poolImage.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	imageNames, err := librbd.GetImageNames(poolImage.ioctx)
+	if err != nil {
+		return fmt.Errorf("failed to list images in pool %q: %w", pool, err)
+	}
+
+	resolve := func(ctx context.Context, id string) (types.Snapshot, error) {
+		snapID, err := util.GenerateVolID(ctx, monitors, creds, poolID, pool, clusterID, id)
+		if err != nil {
+			return nil, err
+		}
+
+		return mgr.GetSnapshotByID(ctx, snapID)
+	}
+
+	return iterateSnapshots(ctx, imageNames, filter, resolve, fn)
+}
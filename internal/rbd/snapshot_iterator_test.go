@@ -0,0 +1,226 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// fakeSnapshot implements the parts of types.Snapshot that are used by
+// iterateSnapshots().
+type fakeSnapshot struct {
+	types.Snapshot
+
+	id        string
+	source    string
+	created   time.Time
+	destroyed bool
+}
+
+func (fs *fakeSnapshot) ToCSI(_ context.Context) (*csi.Snapshot, error) {
+	return &csi.Snapshot{
+		SnapshotId:     fs.id,
+		SourceVolumeId: fs.source,
+		CreationTime:   timestamppb.New(fs.created),
+	}, nil
+}
+
+func (fs *fakeSnapshot) Destroy(_ context.Context) {
+	fs.destroyed = true
+}
+
+// fakeSnapshotBackend contains a large number of snapshot images, and keeps
+// track of the snapshots that were resolved.
+type fakeSnapshotBackend struct {
+	imageNames []string
+	snapshots  map[string]*fakeSnapshot
+	resolved   []*fakeSnapshot
+}
+
+func newFakeSnapshotBackend(count int) *fakeSnapshotBackend {
+	fsb := &fakeSnapshotBackend{
+		snapshots: make(map[string]*fakeSnapshot, count),
+	}
+
+	now := time.Now()
+	for i := range count {
+		id := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		// every other image is a volume
+		fsb.imageNames = append(fsb.imageNames, "csi-vol-"+id, defaultSnapshotNamePrefix+id)
+		fsb.snapshots[id] = &fakeSnapshot{
+			id:      id,
+			source:  fmt.Sprintf("volume-%d", i%10),
+			created: now.Add(-time.Duration(i) * time.Hour),
+		}
+	}
+
+	return fsb
+}
+
+func (fsb *fakeSnapshotBackend) resolve(_ context.Context, id string) (types.Snapshot, error) {
+	snap, ok := fsb.snapshots[id]
+	if !ok {
+		return nil, util.ErrKeyNotFound
+	}
+	fsb.resolved = append(fsb.resolved, snap)
+
+	return snap, nil
+}
+
+func TestIterateSnapshots(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+
+	t.Run("all snapshots", func(t *testing.T) {
+		t.Parallel()
+
+		fsb := newFakeSnapshotBackend(10000)
+		count := 0
+		err := iterateSnapshots(ctx, fsb.imageNames, types.SnapshotFilter{}, fsb.resolve, func(types.Snapshot) error {
+			count++
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("iterateSnapshots() failed: %v", err)
+		}
+		if count != 10000 {
+			t.Errorf("expected 10000 snapshots, got %d", count)
+		}
+		for _, snap := range fsb.resolved {
+			if !snap.destroyed {
+				t.Errorf("snapshot %q was not destroyed", snap.id)
+			}
+		}
+	})
+
+	t.Run("early stop", func(t *testing.T) {
+		t.Parallel()
+
+		fsb := newFakeSnapshotBackend(10000)
+		count := 0
+		err := iterateSnapshots(ctx, fsb.imageNames, types.SnapshotFilter{}, fsb.resolve, func(types.Snapshot) error {
+			count++
+			if count == 5 {
+				return types.ErrStopIteration
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("iterateSnapshots() failed: %v", err)
+		}
+		if count != 5 {
+			t.Errorf("expected 5 snapshots, got %d", count)
+		}
+		// snapshots should only be resolved until the iteration stopped
+		if len(fsb.resolved) != 5 {
+			t.Errorf("expected 5 resolved snapshots, got %d", len(fsb.resolved))
+		}
+	})
+
+	t.Run("error from callback", func(t *testing.T) {
+		t.Parallel()
+
+		fsb := newFakeSnapshotBackend(100)
+		errFailed := errors.New("failed")
+		err := iterateSnapshots(ctx, fsb.imageNames, types.SnapshotFilter{}, fsb.resolve, func(types.Snapshot) error {
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			t.Errorf("iterateSnapshots() error = %v, want %v", err, errFailed)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		t.Parallel()
+
+		fsb := newFakeSnapshotBackend(100)
+		filter := types.SnapshotFilter{
+			SourceVolumeID: "volume-3",
+			MinAge:         50 * time.Hour,
+		}
+		var ids []string
+		err := iterateSnapshots(ctx, fsb.imageNames, filter, fsb.resolve, func(snap types.Snapshot) error {
+			csiSnap, err := snap.ToCSI(ctx)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, csiSnap.GetSnapshotId())
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("iterateSnapshots() failed: %v", err)
+		}
+		// snapshots 53, 63, 73, 83 and 93 are from volume-3 and older than 50 hours
+		if len(ids) != 5 {
+			t.Errorf("expected 5 snapshots, got %v", ids)
+		}
+	})
+
+	t.Run("name prefix", func(t *testing.T) {
+		t.Parallel()
+
+		fsb := newFakeSnapshotBackend(100)
+		fsb.imageNames = append(fsb.imageNames, "custom-00000000-0000-0000-0000-000000000001")
+		count := 0
+		filter := types.SnapshotFilter{NamePrefix: "custom-"}
+		err := iterateSnapshots(ctx, fsb.imageNames, filter, fsb.resolve, func(types.Snapshot) error {
+			count++
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("iterateSnapshots() failed: %v", err)
+		}
+		if count != 1 || len(fsb.resolved) != 1 {
+			t.Errorf("expected 1 snapshot, got %d (resolved %d)", count, len(fsb.resolved))
+		}
+	})
+
+	t.Run("skip images that are not snapshots", func(t *testing.T) {
+		t.Parallel()
+
+		fsb := newFakeSnapshotBackend(10)
+		filter := types.SnapshotFilter{NamePrefix: "csi-vol-"}
+		delete(fsb.snapshots, "00000000-0000-0000-0000-000000000001")
+		count := 0
+		err := iterateSnapshots(ctx, fsb.imageNames, filter, fsb.resolve, func(types.Snapshot) error {
+			count++
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("iterateSnapshots() failed: %v", err)
+		}
+		if count != 9 {
+			t.Errorf("expected 9 snapshots, got %d", count)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+const (
+	// provenanceKey is the metadata key on the image of the snapshot that
+	// contains the types.SnapshotProvenance in JSON format.
+	provenanceKey = "rbd.csi.ceph.com/provenance"
+
+	// provenanceSourceCreateSnapshot is the source of snapshots that were
+	// created with the CreateSnapshot procedure.
+	provenanceSourceCreateSnapshot = "CreateSnapshot"
+)
+
+// newSnapshotProvenance returns the provenance of a snapshot that is created
+// by the running driver.
+func newSnapshotProvenance(clusterID, source string) *types.SnapshotProvenance {
+	return &types.SnapshotProvenance{
+		DriverVersion: util.DriverVersion,
+		ClusterID:     clusterID,
+		Source:        source,
+	}
+}
+
+// storeProvenance stores the provenance in the metadata of the image.
+func storeProvenance(ms metadataStore, provenance *types.SnapshotProvenance) error {
+	value, err := json.Marshal(provenance)
+	if err != nil {
+		return fmt.Errorf("failed to encode provenance: %w", err)
+	}
+
+	err = ms.SetMetadata(provenanceKey, string(value))
+	if err != nil {
+		return fmt.Errorf("failed to store provenance: %w", err)
+	}
+
+	return nil
+}
+
+// getProvenance returns the provenance that was stored by storeProvenance(),
+// or nil in case no provenance was stored.
+func getProvenance(ms metadataStore) (*types.SnapshotProvenance, error) {
+	value, err := ms.GetMetadata(provenanceKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	provenance := &types.SnapshotProvenance{}
+	err = json.Unmarshal([]byte(value), provenance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q metadata %q: %w", provenanceKey, value, err)
+	}
+
+	return provenance, nil
+}
+
+// GetProvenance returns the provenance that was recorded when the snapshot
+// was created. In case the snapshot was created by a version of the driver
+// that did not record it, nil is returned.
+func (rbdSnap *rbdSnapshot) GetProvenance(ctx context.Context) (*types.SnapshotProvenance, error) {
+	if rbdSnap.conn == nil {
+		return nil, fmt.Errorf("can not get provenance of unconnected snapshot %q", rbdSnap)
+	}
+
+	vol := rbdSnap.toVolume()
+	vol.conn = rbdSnap.conn.Copy()
+	defer vol.Destroy(ctx)
+
+	provenance, err := getProvenance(vol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provenance of snapshot %q: %w", rbdSnap, err)
+	}
+
+	return provenance, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+func TestProvenance(t *testing.T) {
+	t.Parallel()
+
+	ms := fakeMetadataStore{}
+
+	// no provenance recorded
+	provenance, err := getProvenance(ms)
+	require.NoError(t, err)
+	require.Nil(t, provenance)
+
+	want := newSnapshotProvenance("cluster-1", provenanceSourceCreateSnapshot)
+	require.Equal(t, util.DriverVersion, want.DriverVersion)
+	require.NoError(t, storeProvenance(ms, want))
+
+	provenance, err = getProvenance(ms)
+	require.NoError(t, err)
+	require.Equal(t, want, provenance)
+
+	// all fields round-trip
+	want = &types.SnapshotProvenance{
+		DriverVersion: "v3.12.0",
+		ClusterID:     "cluster-2",
+		Source:        "CreateVolumeGroupSnapshot",
+	}
+	require.NoError(t, storeProvenance(ms, want))
+	provenance, err = getProvenance(ms)
+	require.NoError(t, err)
+	require.Equal(t, want, provenance)
+
+	// invalid metadata
+	ms[provenanceKey] = "v3.12.0"
+	_, err = getProvenance(ms)
+	require.Error(t, err)
+}
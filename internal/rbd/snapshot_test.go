@@ -0,0 +1,553 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// fakeSnapProtector implements the snapProtector interface, and counts the
+// number of times the snapshot was (un)protected.
+type fakeSnapProtector struct {
+	protected      bool
+	protects       int
+	unprotects     int
+	protectErr     error
+	isProtectedErr error
+}
+
+func (f *fakeSnapProtector) IsProtected() (bool, error) {
+	return f.protected, f.isProtectedErr
+}
+
+func (f *fakeSnapProtector) Protect() error {
+	if f.protectErr != nil {
+		return f.protectErr
+	}
+	f.protects++
+	f.protected = true
+
+	return nil
+}
+
+func (f *fakeSnapProtector) Unprotect() error {
+	f.unprotects++
+	f.protected = false
+
+	return nil
+}
+
+func TestProtectSnapshot(t *testing.T) {
+	t.Parallel()
+
+	snap := &fakeSnapProtector{}
+	require.NoError(t, protectSnapshot(snap))
+	require.True(t, snap.protected)
+	require.Equal(t, 1, snap.protects)
+
+	// protecting an already protected snapshot is a no-op
+	require.NoError(t, protectSnapshot(snap))
+	require.True(t, snap.protected)
+	require.Equal(t, 1, snap.protects)
+
+	// failure to get the protection status is returned
+	snap = &fakeSnapProtector{isProtectedErr: errors.New("failed")}
+	require.Error(t, protectSnapshot(snap))
+	require.Equal(t, 0, snap.protects)
+}
+
+func TestUnprotectSnapshot(t *testing.T) {
+	t.Parallel()
+
+	snap := &fakeSnapProtector{protected: true}
+	require.NoError(t, unprotectSnapshot(snap, nil))
+	require.False(t, snap.protected)
+	require.Equal(t, 1, snap.unprotects)
+
+	// unprotecting a snapshot that is not protected is a no-op
+	require.NoError(t, unprotectSnapshot(snap, nil))
+	require.False(t, snap.protected)
+	require.Equal(t, 1, snap.unprotects)
+
+	// a snapshot with dependent clones can not be unprotected
+	snap = &fakeSnapProtector{protected: true}
+	err := unprotectSnapshot(snap, []string{"csi-vol-clone-1", "csi-vol-clone-2"})
+	require.ErrorIs(t, err, ErrSnapHasChildren)
+	require.Contains(t, err.Error(), "csi-vol-clone-1")
+	require.True(t, snap.protected)
+	require.Equal(t, 0, snap.unprotects)
+}
+
+// fakeMetadataStore implements the metadataStore interface with a map.
+type fakeMetadataStore map[string]string
+
+func (f fakeMetadataStore) GetMetadata(key string) (string, error) {
+	value, ok := f[key]
+	if !ok {
+		return "", librbd.ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (f fakeMetadataStore) SetMetadata(key, value string) error {
+	f[key] = value
+
+	return nil
+}
+
+// newResolvedTestSnapshot returns a snapshot with the names that
+// genSnapFromSnapID() sets from the journal: RbdImageName is the source
+// volume, and the RBD snapshot is on the clone image named RbdSnapName.
+func newResolvedTestSnapshot(radosNamespace string) *rbdSnapshot {
+	return &rbdSnapshot{
+		rbdImage: rbdImage{
+			Pool:           "replicapool",
+			RadosNamespace: radosNamespace,
+			RbdImageName:   "csi-vol-8d6b2c1e",
+		},
+		RbdSnapName: "csi-snap-4f5b6e2a",
+	}
+}
+
+func TestSnapImageName(t *testing.T) {
+	t.Parallel()
+
+	snap := newResolvedTestSnapshot("")
+	require.Equal(t, "csi-snap-4f5b6e2a", snap.snapImageName())
+	// the image that is opened for the snapshot is the same that GetStatus()
+	// and Delete() use
+	require.Equal(t, snap.toVolume().RbdImageName, snap.snapImageName())
+}
+
+func TestLastTouched(t *testing.T) {
+	t.Parallel()
+
+	ms := fakeMetadataStore{}
+
+	// never touched
+	touched, err := getLastTouched(ms)
+	require.NoError(t, err)
+	require.Nil(t, touched)
+
+	now := time.Date(2024, 3, 12, 10, 30, 15, 123456789, time.FixedZone("CET", 3600))
+	require.NoError(t, touchImage(ms, now))
+
+	touched, err = getLastTouched(ms)
+	require.NoError(t, err)
+	require.NotNil(t, touched)
+	require.True(t, now.Equal(*touched), "got %v, want %v", *touched, now)
+
+	// touching again updates the time
+	later := now.Add(time.Hour)
+	require.NoError(t, touchImage(ms, later))
+
+	touched, err = getLastTouched(ms)
+	require.NoError(t, err)
+	require.True(t, later.Equal(*touched), "got %v, want %v", *touched, later)
+
+	// invalid metadata
+	ms[lastTouchedKey] = "yesterday"
+	_, err = getLastTouched(ms)
+	require.Error(t, err)
+}
+
+func TestGetSourceVolumeID(t *testing.T) {
+	t.Parallel()
+
+	created := time.Now()
+	snap := &rbdSnapshot{
+		rbdImage: rbdImage{
+			VolID:     "0001-0009-rook-ceph-0000000000000001-snapshot",
+			CreatedAt: &created,
+		},
+		SourceVolumeID: "0001-0009-rook-ceph-0000000000000001-volume",
+	}
+
+	id, err := snap.GetSourceVolumeID(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, snap.SourceVolumeID, id)
+
+	csiSnap, err := snap.ToCSI(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, csiSnap.GetSourceVolumeId(), id)
+}
+
+func TestGetJournalID(t *testing.T) {
+	t.Parallel()
+
+	vi := util.CSIIdentifier{
+		LocationID: 7,
+		ClusterID:  "rook-ceph",
+		ObjectUUID: "4f5b6e2a-1f44-11ef-9d6a-0242ac110002",
+	}
+	snapID, err := vi.ComposeCSIID()
+	require.NoError(t, err)
+
+	snap := &rbdSnapshot{
+		rbdImage: rbdImage{
+			VolID:      snapID,
+			ReservedID: vi.ObjectUUID,
+		},
+	}
+	id, err := snap.GetJournalID(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, vi.ObjectUUID, id)
+
+	// loading the snapshot again from its SnapshotId returns the same ID
+	var reloaded util.CSIIdentifier
+	require.NoError(t, reloaded.DecomposeCSIID(snapID))
+	again := &rbdSnapshot{
+		rbdImage: rbdImage{
+			VolID:      snapID,
+			ReservedID: reloaded.ObjectUUID,
+		},
+	}
+	againID, err := again.GetJournalID(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, id, againID)
+
+	_, err = (&rbdSnapshot{}).GetJournalID(context.TODO())
+	require.Error(t, err)
+}
+
+func TestSnapshotPlacement(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		snap          *rbdSnapshot
+		wantPool      string
+		wantNamespace string
+		wantImage     string
+		wantErr       bool
+	}{
+		{
+			name:      "default namespace",
+			snap:      newResolvedTestSnapshot(""),
+			wantPool:  "replicapool",
+			wantImage: "csi-snap-4f5b6e2a",
+		},
+		{
+			name:          "rados namespace",
+			snap:          newResolvedTestSnapshot("tenant-a"),
+			wantPool:      "replicapool",
+			wantNamespace: "tenant-a",
+			wantImage:     "csi-snap-4f5b6e2a",
+		},
+		{
+			name:    "not set",
+			snap:    &rbdSnapshot{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pool, err := tt.snap.GetPoolName(context.TODO())
+			if tt.wantErr {
+				require.Error(t, err)
+				_, err = tt.snap.GetImageName(context.TODO())
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantPool, pool)
+
+			namespace, err := tt.snap.GetRadosNamespace(context.TODO())
+			require.NoError(t, err)
+			require.Equal(t, tt.wantNamespace, namespace)
+
+			// the image is the clone, not the source volume
+			image, err := tt.snap.GetImageName(context.TODO())
+			require.NoError(t, err)
+			require.Equal(t, tt.wantImage, image)
+			require.NotEqual(t, tt.snap.RbdImageName, image)
+
+			// the pool, namespace and image point to the snapshot that was
+			// created
+			spec := pool + "/"
+			if namespace != "" {
+				spec += namespace + "/"
+			}
+			require.Equal(t, tt.snap.snapSpec(), spec+image+"@"+tt.snap.RbdSnapName)
+		})
+	}
+}
+
+func TestSnapshotStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cond    snapshotConditions
+		state   types.SnapshotState
+		wantErr bool
+	}{
+		{
+			name:  "image does not exist",
+			cond:  snapshotConditions{imageErr: ErrImageNotFound},
+			state: types.SnapshotStateDeleting,
+		},
+		{
+			name:    "image can not be opened",
+			cond:    snapshotConditions{imageErr: errors.New("permission denied")},
+			wantErr: true,
+		},
+		{
+			name:  "snapshot does not exist on the image",
+			cond:  snapshotConditions{snapErr: ErrSnapNotFound},
+			state: types.SnapshotStateCreating,
+		},
+		{
+			name:    "snapshot can not be checked",
+			cond:    snapshotConditions{snapErr: errors.New("connection reset")},
+			wantErr: true,
+		},
+		{
+			name:  "image is being flattened",
+			cond:  snapshotConditions{flattening: true},
+			state: types.SnapshotStateFlattening,
+		},
+		{
+			name:  "image without flatten task",
+			cond:  snapshotConditions{},
+			state: types.SnapshotStateReady,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			state, msg, err := snapshotStatus("replicapool/csi-snap-1", tt.cond)
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "replicapool/csi-snap-1")
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.state, state)
+			require.Contains(t, msg, "replicapool/csi-snap-1")
+		})
+	}
+}
+
+func TestGetStatusNotConnected(t *testing.T) {
+	t.Parallel()
+
+	snap := &rbdSnapshot{}
+	_, _, err := snap.GetStatus(context.TODO())
+	require.ErrorIs(t, err, ErrSnapshotNotConnected)
+
+	err = snap.WaitReady(context.TODO(), time.Millisecond)
+	require.ErrorIs(t, err, ErrSnapshotNotConnected)
+}
+
+func TestFlattenChildren(t *testing.T) {
+	t.Parallel()
+
+	t.Run("snapshot without children", func(t *testing.T) {
+		t.Parallel()
+
+		err := flattenChildren(context.TODO(), nil, nil, func(_ context.Context, _, _ string) error {
+			t.Error("flatten should not be called")
+
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("snapshot with children", func(t *testing.T) {
+		t.Parallel()
+
+		var flattened []string
+		err := flattenChildren(context.TODO(),
+			[]string{"replicapool", "ecpool"},
+			[]string{"csi-vol-1", "csi-vol-2"},
+			func(_ context.Context, pool, image string) error {
+				flattened = append(flattened, pool+"/"+image)
+
+				return nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, []string{"replicapool/csi-vol-1", "ecpool/csi-vol-2"}, flattened)
+	})
+
+	t.Run("failure to flatten a child", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		err := flattenChildren(context.TODO(),
+			[]string{"replicapool", "replicapool"},
+			[]string{"csi-vol-1", "csi-vol-2"},
+			func(_ context.Context, _, _ string) error {
+				calls++
+
+				return ErrFlattenInProgress
+			})
+		require.ErrorIs(t, err, ErrFlattenInProgress)
+		require.ErrorContains(t, err, "replicapool/csi-vol-1")
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := flattenChildren(ctx, []string{"replicapool"}, []string{"csi-vol-1"},
+			func(_ context.Context, _, _ string) error {
+				t.Error("flatten should not be called")
+
+				return nil
+			})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestCachedCreationTime(t *testing.T) {
+	t.Parallel()
+
+	journalTime := time.Date(2024, 3, 12, 10, 30, 15, 0, time.UTC)
+	backendTime := journalTime.Add(time.Second)
+	errBackend := errors.New("backend unavailable")
+
+	tests := []struct {
+		name       string
+		cached     *time.Time
+		backendErr error
+		want       *time.Time
+		wantCalls  int
+		wantErr    error
+	}{
+		{
+			name:      "recorded in the journal",
+			cached:    &journalTime,
+			want:      &journalTime,
+			wantCalls: 0,
+		},
+		{
+			name:      "not recorded in the journal",
+			want:      &backendTime,
+			wantCalls: 1,
+		},
+		{
+			name:       "backend fails",
+			backendErr: errBackend,
+			wantCalls:  1,
+			wantErr:    errBackend,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			calls := 0
+			got, err := cachedCreationTime(tt.cached, func() (*time.Time, error) {
+				calls++
+				if tt.backendErr != nil {
+					return nil, tt.backendErr
+				}
+
+				return &backendTime, nil
+			})
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+// fakeGroupIDStore implements the groupIDStore interface, and counts the
+// number of times the group ID was stored or removed.
+type fakeGroupIDStore struct {
+	groupIDs map[string]string
+	stores   int
+	removes  int
+}
+
+func (f *fakeGroupIDStore) StoreGroupID(_ context.Context, _, reservedUUID, groupID string) error {
+	f.groupIDs[reservedUUID] = groupID
+	f.stores++
+
+	return nil
+}
+
+func (f *fakeGroupIDStore) RemoveGroupID(_ context.Context, _, reservedUUID string) error {
+	delete(f.groupIDs, reservedUUID)
+	f.removes++
+
+	return nil
+}
+
+func TestSetVolumeGroup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	store := &fakeGroupIDStore{groupIDs: map[string]string{}}
+	snap := &rbdSnapshot{}
+	snap.RbdSnapName = "csi-snap-1"
+
+	// get without group
+	groupID, err := snap.GetVolumeGroup(ctx)
+	require.NoError(t, err)
+	require.Empty(t, groupID)
+
+	// set
+	require.NoError(t, snap.setVolumeGroup(ctx, store, "uuid-1", "group-1"))
+	groupID, err = snap.GetVolumeGroup(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "group-1", groupID)
+	require.Equal(t, map[string]string{"uuid-1": "group-1"}, store.groupIDs)
+
+	// re-set is a no-op
+	require.NoError(t, snap.setVolumeGroup(ctx, store, "uuid-1", "group-1"))
+	require.Equal(t, 1, store.stores)
+
+	// set another group
+	require.NoError(t, snap.setVolumeGroup(ctx, store, "uuid-1", "group-2"))
+	require.Equal(t, 2, store.stores)
+	require.Equal(t, map[string]string{"uuid-1": "group-2"}, store.groupIDs)
+
+	// clear
+	require.NoError(t, snap.setVolumeGroup(ctx, store, "uuid-1", ""))
+	groupID, err = snap.GetVolumeGroup(ctx)
+	require.NoError(t, err)
+	require.Empty(t, groupID)
+	require.Empty(t, store.groupIDs)
+	require.Equal(t, 1, store.removes)
+
+	// clearing again is a no-op
+	require.NoError(t, snap.setVolumeGroup(ctx, store, "uuid-1", ""))
+	require.Equal(t, 1, store.removes)
+
+	// ClearVolumeGroup without group does not connect to the journal
+	require.NoError(t, snap.ClearVolumeGroup(ctx, nil))
+}
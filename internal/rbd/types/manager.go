@@ -18,8 +18,30 @@ package types
 
 import (
 	"context"
+	"errors"
+	"time"
 )
 
+// ErrStopIteration can be returned by the callback of
+// Manager.IterateSnapshots() to stop the iteration without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// SnapshotFilter selects the snapshots that are passed to the callback of
+// Manager.IterateSnapshots(). Empty fields match all snapshots.
+type SnapshotFilter struct {
+	// NamePrefix is the prefix of the name of the RBD image that backs the
+	// snapshot (the snapshotNamePrefix StorageClass parameter). When
+	// empty, the default prefix "csi-snap-" is used.
+	NamePrefix string
+
+	// SourceVolumeID is the CSI VolumeId of the volume that the snapshot
+	// was taken from.
+	SourceVolumeID string
+
+	// MinAge selects the snapshots that were created at least MinAge ago.
+	MinAge time.Duration
+}
+
 // VolumeResolver can be used to construct a Volume from a CSI VolumeId.
 type VolumeResolver interface {
 	// GetVolumeByID uses the CSI VolumeId to resolve the returned Volume.
@@ -61,6 +83,13 @@ type Manager interface {
 	// name (like the request-id).
 	GetVolumeGroupSnapshotByName(ctx context.Context, name string) (VolumeGroupSnapshot, error)
 
+	// IterateSnapshots walks the snapshots in the pool and calls fn for
+	// each Snapshot that matches the filter. The Snapshots are resolved
+	// one at a time, and are destroyed once fn returns. When fn returns
+	// ErrStopIteration, the iteration stops and nil is returned, any other
+	// error is returned as is.
+	IterateSnapshots(ctx context.Context, pool string, filter SnapshotFilter, fn func(Snapshot) error) error
+
 	// CreateVolumeGroupSnapshot instructs the Manager to create a
 	// VolumeGroupSnapshot from the VolumeGroup. All snapshots in the
 	// returned VolumeGroupSnapshot have been taken while I/O on the
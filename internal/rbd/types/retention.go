@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// now returns the current time, tests can replace it with a fake clock.
+var now = time.Now
+
+// GetSnapshotAge returns the time that passed since the snapshot was created.
+func GetSnapshotAge(ctx context.Context, snap Snapshot) (time.Duration, error) {
+	created, err := snap.GetCreationTime(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get creation time of snapshot: %w", err)
+	}
+
+	return now().Sub(*created), nil
+}
+
+// EvaluateSnapshotRetention partitions the snapshots of a source volume in
+// the snapshots to keep and the snapshots to prune. The newest maxCount
+// snapshots that are not older than maxAge are kept, the other snapshots are
+// pruned. A maxCount or maxAge of 0 disables the limit.
+//
+// The keep set is sorted newest first, and the prune set oldest first, so
+// that the snapshots can be deleted in order. An error is returned when the
+// creation time of a snapshot can not be read.
+func EvaluateSnapshotRetention(
+	ctx context.Context,
+	snaps []Snapshot,
+	maxCount int,
+	maxAge time.Duration,
+) ([]Snapshot, []Snapshot, error) {
+	type snapshotTime struct {
+		snap    Snapshot
+		created time.Time
+	}
+
+	if maxCount < 0 || maxAge < 0 {
+		return nil, nil, fmt.Errorf("invalid retention limits: maxCount %d, maxAge %s", maxCount, maxAge)
+	}
+
+	sorted := make([]snapshotTime, 0, len(snaps))
+	for _, snap := range snaps {
+		created, err := snap.GetCreationTime(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get creation time of snapshot: %w", err)
+		}
+
+		sorted = append(sorted, snapshotTime{snap: snap, created: *created})
+	}
+
+	// newest snapshots first
+	slices.SortStableFunc(sorted, func(a, b snapshotTime) int {
+		return b.created.Compare(a.created)
+	})
+
+	current := now()
+	keep := make([]Snapshot, 0, len(sorted))
+	prune := make([]Snapshot, 0, len(sorted))
+	for i, st := range sorted {
+		switch {
+		case maxCount != 0 && i >= maxCount:
+			prune = append(prune, st.snap)
+		case maxAge != 0 && current.Sub(st.created) > maxAge:
+			prune = append(prune, st.snap)
+		default:
+			keep = append(keep, st.snap)
+		}
+	}
+
+	// oldest snapshots first
+	slices.Reverse(prune)
+
+	return keep, prune, nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSnapshot implements the parts of the Snapshot interface that are
+// needed for the tests.
+type fakeSnapshot struct {
+	Snapshot
+
+	clusterID string
+	pool      string
+	name      string
+	created   time.Time
+	err       error
+}
+
+func (fs *fakeSnapshot) GetCreationTime(_ context.Context) (*time.Time, error) {
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	return &fs.created, nil
+}
+
+func snapshotNames(snaps []Snapshot) []string {
+	names := make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		fs, ok := snap.(*fakeSnapshot)
+		if !ok {
+			panic("unexpected snapshot type")
+		}
+		names = append(names, fs.name)
+	}
+
+	return names
+}
+
+func TestEvaluateSnapshotRetention(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	snaps := []Snapshot{
+		&fakeSnapshot{name: "two-hours", created: now.Add(-2 * time.Hour)},
+		&fakeSnapshot{name: "one-minute", created: now.Add(-time.Minute)},
+		&fakeSnapshot{name: "one-day", created: now.Add(-24 * time.Hour)},
+		&fakeSnapshot{name: "one-hour", created: now.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name      string
+		maxCount  int
+		maxAge    time.Duration
+		wantKeep  []string
+		wantPrune []string
+	}{
+		{
+			name:      "no limits",
+			wantKeep:  []string{"one-minute", "one-hour", "two-hours", "one-day"},
+			wantPrune: []string{},
+		},
+		{
+			name:      "count limit",
+			maxCount:  2,
+			wantKeep:  []string{"one-minute", "one-hour"},
+			wantPrune: []string{"one-day", "two-hours"},
+		},
+		{
+			name:      "count limit above the number of snapshots",
+			maxCount:  10,
+			wantKeep:  []string{"one-minute", "one-hour", "two-hours", "one-day"},
+			wantPrune: []string{},
+		},
+		{
+			name:      "age limit",
+			maxAge:    90 * time.Minute,
+			wantKeep:  []string{"one-minute", "one-hour"},
+			wantPrune: []string{"one-day", "two-hours"},
+		},
+		{
+			name:      "count and age limit",
+			maxCount:  3,
+			maxAge:    3 * time.Hour,
+			wantKeep:  []string{"one-minute", "one-hour", "two-hours"},
+			wantPrune: []string{"one-day"},
+		},
+		{
+			name:      "count limit stricter than age limit",
+			maxCount:  1,
+			maxAge:    3 * time.Hour,
+			wantKeep:  []string{"one-minute"},
+			wantPrune: []string{"one-day", "two-hours", "one-hour"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			keep, prune, err := EvaluateSnapshotRetention(context.TODO(), snaps, tt.maxCount, tt.maxAge)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantKeep, snapshotNames(keep))
+			require.Equal(t, tt.wantPrune, snapshotNames(prune))
+		})
+	}
+}
+
+func TestEvaluateSnapshotRetentionErrors(t *testing.T) {
+	t.Parallel()
+
+	errCreationTime := errors.New("image not found")
+	snaps := []Snapshot{
+		&fakeSnapshot{name: "one-hour", created: time.Now().Add(-time.Hour)},
+		&fakeSnapshot{name: "broken", err: errCreationTime},
+	}
+
+	_, _, err := EvaluateSnapshotRetention(context.TODO(), snaps, 1, 0)
+	require.ErrorIs(t, err, errCreationTime)
+
+	_, _, err = EvaluateSnapshotRetention(context.TODO(), snaps[:1], -1, 0)
+	require.Error(t, err)
+}
+
+//nolint:paralleltest // the test replaces the package clock
+func TestGetSnapshotAge(t *testing.T) {
+	fakeNow := time.Date(2024, time.March, 12, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		return fakeNow
+	}
+	t.Cleanup(func() {
+		now = time.Now
+	})
+
+	snap := &fakeSnapshot{name: "snap", created: fakeNow.Add(-90 * time.Minute)}
+	age, err := GetSnapshotAge(context.TODO(), snap)
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Minute, age)
+
+	errCreationTime := errors.New("image not found")
+	_, err = GetSnapshotAge(context.TODO(), &fakeSnapshot{name: "broken", err: errCreationTime})
+	require.ErrorIs(t, err, errCreationTime)
+}
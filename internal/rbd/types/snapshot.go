@@ -18,6 +18,9 @@ package types
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -25,6 +28,41 @@ import (
 	"github.com/ceph/ceph-csi/internal/util"
 )
 
+// SnapshotState is the state of a snapshot in the storage backend.
+type SnapshotState string
+
+const (
+	// SnapshotStateCreating indicates that the snapshot is not completely
+	// created yet.
+	SnapshotStateCreating SnapshotState = "creating"
+	// SnapshotStateReady indicates that the snapshot can be used.
+	SnapshotStateReady SnapshotState = "ready"
+	// SnapshotStateFlattening indicates that the snapshot can only be used
+	// once flattening its image has finished.
+	SnapshotStateFlattening SnapshotState = "flattening"
+	// SnapshotStateDeleting indicates that the snapshot is being removed.
+	SnapshotStateDeleting SnapshotState = "deleting"
+	// SnapshotStateErrored indicates that the snapshot is broken.
+	SnapshotStateErrored SnapshotState = "errored"
+)
+
+// ReadyToUse returns true when a snapshot in this state can be used, as
+// reported with ReadyToUse in the CSI Snapshot.
+func (state SnapshotState) ReadyToUse() bool {
+	return state == SnapshotStateReady
+}
+
+// SnapshotProvenance describes which driver created a snapshot, and how.
+type SnapshotProvenance struct {
+	// DriverVersion is the version of Ceph-CSI that created the snapshot
+	DriverVersion string `json:"driverVersion"`
+	// ClusterID is the ID of the cluster in the CSI config
+	ClusterID string `json:"clusterID"`
+	// Source is the operation that created the snapshot, like
+	// "CreateSnapshot"
+	Source string `json:"source"`
+}
+
 type Snapshot interface {
 	journalledObject
 
@@ -34,10 +72,219 @@ type Snapshot interface {
 	// Delete removes the snapshot from the storage backend.
 	Delete(ctx context.Context) error
 
+	// DeleteWithForce flattens the clones that depend on the snapshot, and
+	// then removes the snapshot from the storage backend. Flattening copies
+	// the data of the snapshot into each clone, which consumes capacity and
+	// can take a long time. Clones that were flattened before the context
+	// is done stay flattened, even when the snapshot is not removed.
+	DeleteWithForce(ctx context.Context, creds *util.Credentials) error
+
 	ToCSI(ctx context.Context) (*csi.Snapshot, error)
 
+	// GetStatus returns the state of the snapshot in the storage backend,
+	// together with a message that describes the state. An error is only
+	// returned when the state could not be determined.
+	GetStatus(ctx context.Context) (SnapshotState, string, error)
+
+	// WaitReady checks the state of the snapshot every pollInterval, until
+	// the snapshot is ready to use or the context is done.
+	WaitReady(ctx context.Context, pollInterval time.Duration) error
+
 	GetCreationTime(ctx context.Context) (*time.Time, error)
 
-	// SetVolumeGroup sets the CSI volume group ID in the snapshot.
+	// GetCreationTimeCached returns the creation time that was recorded in
+	// the journal when the snapshot was created, without querying the
+	// storage backend. Only when the journal has no creation time, the
+	// backend is queried like GetCreationTime() does. This makes listing
+	// many snapshots cheaper.
+	GetCreationTimeCached(ctx context.Context) (*time.Time, error)
+
+	// GetSourceVolumeID returns the CSI volume ID of the volume that the
+	// snapshot was created from. It is the same ID that ToCSI() returns as
+	// SourceVolumeId, without building the complete csi.Snapshot.
+	GetSourceVolumeID(ctx context.Context) (string, error)
+
+	// GetJournalID returns the ID that the snapshot was reserved with in the
+	// journal. It does not change when the snapshot is loaded again from
+	// its CSI SnapshotId, so that it can be used to find the journal
+	// entries of the snapshot.
+	GetJournalID(ctx context.Context) (string, error)
+
+	// GetPoolName returns the pool that holds the snapshot in the storage
+	// backend, without the rados namespace.
+	GetPoolName(ctx context.Context) (string, error)
+
+	// GetRadosNamespace returns the rados namespace in the pool that holds
+	// the snapshot, or an empty string when no namespace is used.
+	GetRadosNamespace(ctx context.Context) (string, error)
+
+	// GetImageName returns the name of the image that holds the snapshot in
+	// the storage backend, without the pool and rados namespace.
+	GetImageName(ctx context.Context) (string, error)
+
+	// GetQuotaUsage returns the number of bytes that the snapshot consumes,
+	// not counting the data that is shared with its parent. Calculating the
+	// usage can be expensive, and is an approximation for some backends.
+	GetQuotaUsage(ctx context.Context) (int64, error)
+
+	// GetQuotaUsageEstimate returns a quick estimate of the number of bytes
+	// that the snapshot consumes, which can be larger than the usage that
+	// GetQuotaUsage returns.
+	GetQuotaUsageEstimate(ctx context.Context) (int64, error)
+
+	// Protect protects the snapshot so that it can be cloned. Protecting an
+	// already protected snapshot is not an error.
+	Protect(ctx context.Context, creds *util.Credentials) error
+
+	// Unprotect removes the protection from the snapshot. Unprotecting a
+	// snapshot that is not protected is not an error, but the snapshot can
+	// not be unprotected while clones depend on it.
+	Unprotect(ctx context.Context, creds *util.Credentials) error
+
+	// ExportDiff writes the changes between the snapshot fromSnap and this
+	// snapshot to w. fromSnap is the CSI snapshot ID of another snapshot of
+	// the same volume. An empty fromSnap exports all data of the snapshot.
+	ExportDiff(ctx context.Context, creds *util.Credentials, fromSnap string, w io.Writer) error
+
+	// ExportChunked reads the data of the snapshot in chunks of chunkSize
+	// bytes, and calls fn with the offset and data of each chunk. The last
+	// chunk is shorter when the size of the snapshot is not a multiple of
+	// chunkSize. Exporting stops when fn returns an error, or when the
+	// context is done.
+	ExportChunked(
+		ctx context.Context,
+		creds *util.Credentials,
+		chunkSize int64,
+		fn func(offset int64, data []byte) error,
+	) error
+
+	// Touch records the current time in the metadata of the snapshot.
+	Touch(ctx context.Context, creds *util.Credentials) error
+
+	// GetLastTouched returns the time that was recorded with Touch(), or
+	// nil when the snapshot was never touched.
+	GetLastTouched(ctx context.Context) (*time.Time, error)
+
+	// StoreChecksum calculates a checksum of the data of the snapshot, and
+	// stores it in the metadata of the snapshot. When sampled is set, only
+	// a part of the data is read, which is faster for large snapshots, but
+	// does not detect changes in the data that was not read.
+	StoreChecksum(ctx context.Context, creds *util.Credentials, sampled bool) error
+
+	// VerifyIntegrity calculates the checksum of the data of the snapshot
+	// again, in the same way as StoreChecksum() did, and returns true when
+	// it matches the stored checksum. An error is returned when no
+	// checksum was stored.
+	VerifyIntegrity(ctx context.Context, creds *util.Credentials) (bool, error)
+
+	// CopyTo copies the data of the snapshot to a new image in destPool,
+	// and returns the CSI volume ID of the new image. destName is the
+	// request name that the new image is reserved with. destPool can be
+	// prefixed with "<clusterID>/" to copy the snapshot to another cluster.
+	CopyTo(ctx context.Context, destCreds *util.Credentials, destPool, destName string) (string, error)
+
+	// ListClones returns the CSI volume IDs of the volumes that were cloned
+	// from the snapshot, or an empty slice when there are none.
+	ListClones(ctx context.Context, creds *util.Credentials) ([]string, error)
+
+	// GetChildCount returns the number of clones that depend on the
+	// snapshot. It is cheaper than ListClones(), as the clones are not
+	// resolved to their volume IDs.
+	GetChildCount(ctx context.Context, creds *util.Credentials) (int, error)
+
+	// GetProvenance returns the driver version, cluster and operation that
+	// created the snapshot, or nil for snapshots that were created by a
+	// version of the driver that did not record it.
+	GetProvenance(ctx context.Context) (*SnapshotProvenance, error)
+
+	// SetVolumeGroup sets the CSI volume group ID in the snapshot. Setting
+	// the group ID that is already set is a no-op.
 	SetVolumeGroup(ctx context.Context, creds *util.Credentials, vgID string) error
+
+	// ClearVolumeGroup removes the CSI volume group ID from the snapshot.
+	// Clearing the group of a snapshot without group is a no-op.
+	ClearVolumeGroup(ctx context.Context, creds *util.Credentials) error
+
+	// GetVolumeGroup returns the CSI volume group ID of the snapshot, or an
+	// empty string when the snapshot is not in a group.
+	GetVolumeGroup(ctx context.Context) (string, error)
+}
+
+// ErrSnapshotErrored is returned by WaitSnapshotReady when the snapshot is in
+// the SnapshotStateErrored state, and will not become ready.
+var ErrSnapshotErrored = errors.New("snapshot is in an errored state")
+
+// WaitSnapshotReady calls GetStatus() of the snapshot every pollInterval,
+// until the state of the snapshot is ReadyToUse. When the context is done
+// before that, the error contains the state and message that GetStatus()
+// returned last. Backends can use it to implement Snapshot.WaitReady().
+func WaitSnapshotReady(ctx context.Context, snap Snapshot, pollInterval time.Duration) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		state, msg, err := snap.GetStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the status of the snapshot: %w", err)
+		}
+
+		switch {
+		case state.ReadyToUse():
+			return nil
+		case state == SnapshotStateErrored:
+			return fmt.Errorf("%w: %s", ErrSnapshotErrored, msg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("snapshot is not ready, state %q: %s: %w", state, msg, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// SameSnapshot returns true when both snapshots refer to the same object in
+// the backend storage. The snapshots are compared by their cluster, pool and
+// name, so that different instances of the same snapshot are considered
+// equal. Snapshots with an incomplete identity are never the same.
+func SameSnapshot(ctx context.Context, a, b Snapshot) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	if a == b {
+		return true
+	}
+
+	idA, err := snapshotIdentity(ctx, a)
+	if err != nil {
+		return false
+	}
+
+	idB, err := snapshotIdentity(ctx, b)
+	if err != nil {
+		return false
+	}
+
+	return idA == idB
+}
+
+// snapshotIdentity returns the cluster, pool and name of the snapshot.
+func snapshotIdentity(ctx context.Context, snap Snapshot) ([3]string, error) {
+	clusterID, err := snap.GetClusterID(ctx)
+	if err != nil {
+		return [3]string{}, err
+	}
+
+	pool, err := snap.GetPool(ctx)
+	if err != nil {
+		return [3]string{}, err
+	}
+
+	name, err := snap.GetName(ctx)
+	if err != nil {
+		return [3]string{}, err
+	}
+
+	return [3]string{clusterID, pool, name}, nil
 }
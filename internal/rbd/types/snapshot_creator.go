@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// ErrNoSnapshotCreator is returned by NewSnapshot when no SnapshotCreator
+// has been registered.
+var ErrNoSnapshotCreator = errors.New("no snapshot creator registered")
+
+// SnapshotCreator creates Snapshots in a storage backend.
+type SnapshotCreator interface {
+	// CreateSnapshot creates the snapshot name of the volume with the CSI
+	// VolumeId sourceVolID, and records it in the journal. When the
+	// snapshot name already exists for the volume, the existing Snapshot
+	// is returned.
+	CreateSnapshot(
+		ctx context.Context,
+		creds *util.Credentials,
+		sourceVolID, name string,
+		params map[string]string,
+	) (Snapshot, error)
+}
+
+// snapshotCreator is the SnapshotCreator that is used by NewSnapshot.
+var snapshotCreator SnapshotCreator
+
+// RegisterSnapshotCreator sets the SnapshotCreator that NewSnapshot uses. A
+// backend registers its SnapshotCreator once, from a package variable:
+//
+//	var _ = types.RegisterSnapshotCreator(creator)
+func RegisterSnapshotCreator(creator SnapshotCreator) bool {
+	if creator == nil {
+		panic("a SnapshotCreator MUST not be nil")
+	}
+	if snapshotCreator != nil {
+		panic("duplicate registration of a SnapshotCreator")
+	}
+
+	snapshotCreator = creator
+
+	return true
+}
+
+// NewSnapshot creates a new Snapshot with the given name of the volume with
+// the CSI VolumeId sourceVolID, with the SnapshotCreator of the backend. The
+// params are the parameters of the VolumeSnapshotClass. Creating a snapshot
+// with a name that already exists for the volume returns the existing
+// Snapshot.
+//
+// NOTE: Callers should hold a lock against the name of the snapshot, to
+// prevent parallel operations from modifying the journal for the name.
+func NewSnapshot(
+	ctx context.Context,
+	creds *util.Credentials,
+	sourceVolID, name string,
+	params map[string]string,
+) (Snapshot, error) {
+	return newSnapshot(ctx, snapshotCreator, creds, sourceVolID, name, params)
+}
+
+func newSnapshot(
+	ctx context.Context,
+	creator SnapshotCreator,
+	creds *util.Credentials,
+	sourceVolID, name string,
+	params map[string]string,
+) (Snapshot, error) {
+	if creator == nil {
+		return nil, ErrNoSnapshotCreator
+	}
+
+	if sourceVolID == "" {
+		return nil, errors.New("source volume ID of the snapshot is empty")
+	}
+
+	if name == "" {
+		return nil, errors.New("name of the snapshot is empty")
+	}
+
+	return creator.CreateSnapshot(ctx, creds, sourceVolID, name, params)
+}
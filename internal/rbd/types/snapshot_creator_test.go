@@ -0,0 +1,162 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+var errSourceNotFound = errors.New("source volume not found")
+
+// fakeSnapshotCreator is a backend that journals the snapshots by their name
+// and source volume.
+type fakeSnapshotCreator struct {
+	lock      sync.Mutex
+	volumes   map[string]bool
+	journal   map[string]*fakeSnapshot
+	snapshots int
+}
+
+func newFakeSnapshotCreator(volumes ...string) *fakeSnapshotCreator {
+	fsc := &fakeSnapshotCreator{
+		volumes: make(map[string]bool, len(volumes)),
+		journal: make(map[string]*fakeSnapshot),
+	}
+	for _, vol := range volumes {
+		fsc.volumes[vol] = true
+	}
+
+	return fsc
+}
+
+func (fsc *fakeSnapshotCreator) CreateSnapshot(
+	_ context.Context,
+	_ *util.Credentials,
+	sourceVolID, name string,
+	params map[string]string,
+) (Snapshot, error) {
+	fsc.lock.Lock()
+	defer fsc.lock.Unlock()
+
+	if !fsc.volumes[sourceVolID] {
+		return nil, fmt.Errorf("%w: %s", errSourceNotFound, sourceVolID)
+	}
+
+	key := sourceVolID + "/" + name
+	if snap, ok := fsc.journal[key]; ok {
+		return snap, nil
+	}
+
+	fsc.snapshots++
+	snap := &fakeSnapshot{
+		clusterID: "cluster-1",
+		pool:      params["pool"],
+		name:      fmt.Sprintf("csi-snap-%d", fsc.snapshots),
+	}
+	fsc.journal[key] = snap
+
+	return snap, nil
+}
+
+func TestNewSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	params := map[string]string{"pool": "replicapool"}
+
+	t.Run("create snapshot", func(t *testing.T) {
+		t.Parallel()
+		fsc := newFakeSnapshotCreator("volume-1")
+
+		snap, err := newSnapshot(ctx, fsc, nil, "volume-1", "snapshot-1", params)
+		if err != nil {
+			t.Fatalf("newSnapshot() error = %v", err)
+		}
+		pool, err := snap.GetPool(ctx)
+		if err != nil || pool != "replicapool" {
+			t.Errorf("GetPool() = %q, %v, want %q", pool, err, "replicapool")
+		}
+		if fsc.snapshots != 1 {
+			t.Errorf("created %d snapshots, want 1", fsc.snapshots)
+		}
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		t.Parallel()
+		fsc := newFakeSnapshotCreator("volume-1", "volume-2")
+
+		first, err := newSnapshot(ctx, fsc, nil, "volume-1", "snapshot-1", params)
+		if err != nil {
+			t.Fatalf("newSnapshot() error = %v", err)
+		}
+		second, err := newSnapshot(ctx, fsc, nil, "volume-1", "snapshot-1", params)
+		if err != nil {
+			t.Fatalf("newSnapshot() error = %v", err)
+		}
+		if !SameSnapshot(ctx, first, second) {
+			t.Errorf("newSnapshot() returned %v and %v for the same name", first, second)
+		}
+		if fsc.snapshots != 1 {
+			t.Errorf("created %d snapshots, want 1", fsc.snapshots)
+		}
+
+		// the same name for another volume is a new snapshot
+		other, err := newSnapshot(ctx, fsc, nil, "volume-2", "snapshot-1", params)
+		if err != nil {
+			t.Fatalf("newSnapshot() error = %v", err)
+		}
+		if SameSnapshot(ctx, first, other) {
+			t.Error("newSnapshot() returned the same snapshot for another volume")
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		t.Parallel()
+		fsc := newFakeSnapshotCreator("volume-1")
+
+		_, err := newSnapshot(ctx, fsc, nil, "", "snapshot-1", params)
+		if err == nil {
+			t.Error("newSnapshot() should fail without source volume")
+		}
+		_, err = newSnapshot(ctx, fsc, nil, "volume-1", "", params)
+		if err == nil {
+			t.Error("newSnapshot() should fail without name")
+		}
+		_, err = newSnapshot(ctx, fsc, nil, "volume-2", "snapshot-1", params)
+		if !errors.Is(err, errSourceNotFound) {
+			t.Errorf("newSnapshot() error = %v, want %v", err, errSourceNotFound)
+		}
+		if fsc.snapshots != 0 {
+			t.Errorf("created %d snapshots, want 0", fsc.snapshots)
+		}
+	})
+
+	t.Run("no snapshot creator", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newSnapshot(ctx, nil, nil, "volume-1", "snapshot-1", params)
+		if !errors.Is(err, ErrNoSnapshotCreator) {
+			t.Errorf("newSnapshot() error = %v, want %v", err, ErrNoSnapshotCreator)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func (fs *fakeSnapshot) GetClusterID(_ context.Context) (string, error) {
+	return fs.clusterID, nil
+}
+
+func (fs *fakeSnapshot) GetPool(_ context.Context) (string, error) {
+	return fs.pool, nil
+}
+
+func (fs *fakeSnapshot) GetName(_ context.Context) (string, error) {
+	if fs.name == "" {
+		return "", errors.New("name is not set")
+	}
+
+	return fs.name, nil
+}
+
+func TestSameSnapshot(t *testing.T) {
+	t.Parallel()
+
+	snap := &fakeSnapshot{clusterID: "cluster-1", pool: "replicapool", name: "csi-snap-1"}
+
+	tests := []struct {
+		name  string
+		a     Snapshot
+		b     Snapshot
+		equal bool
+	}{
+		{
+			name:  "same instance",
+			a:     snap,
+			b:     snap,
+			equal: true,
+		},
+		{
+			name:  "same identity, different instance",
+			a:     snap,
+			b:     &fakeSnapshot{clusterID: "cluster-1", pool: "replicapool", name: "csi-snap-1"},
+			equal: true,
+		},
+		{
+			name:  "different name",
+			a:     snap,
+			b:     &fakeSnapshot{clusterID: "cluster-1", pool: "replicapool", name: "csi-snap-2"},
+			equal: false,
+		},
+		{
+			name:  "different pool",
+			a:     snap,
+			b:     &fakeSnapshot{clusterID: "cluster-1", pool: "ecpool", name: "csi-snap-1"},
+			equal: false,
+		},
+		{
+			name:  "different cluster",
+			a:     snap,
+			b:     &fakeSnapshot{clusterID: "cluster-2", pool: "replicapool", name: "csi-snap-1"},
+			equal: false,
+		},
+		{
+			name:  "incomplete identity",
+			a:     &fakeSnapshot{clusterID: "cluster-1", pool: "replicapool"},
+			b:     &fakeSnapshot{clusterID: "cluster-1", pool: "replicapool"},
+			equal: false,
+		},
+		{
+			name:  "nil snapshot",
+			a:     snap,
+			b:     nil,
+			equal: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := SameSnapshot(context.TODO(), tt.a, tt.b); got != tt.equal {
+				t.Errorf("SameSnapshot() = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestSnapshotStateReadyToUse(t *testing.T) {
+	t.Parallel()
+
+	tests := map[SnapshotState]bool{
+		SnapshotStateCreating:   false,
+		SnapshotStateReady:      true,
+		SnapshotStateFlattening: false,
+		SnapshotStateDeleting:   false,
+		SnapshotStateErrored:    false,
+	}
+
+	for state, ready := range tests {
+		t.Run(string(state), func(t *testing.T) {
+			t.Parallel()
+			if got := state.ReadyToUse(); got != ready {
+				t.Errorf("%s.ReadyToUse() = %v, want %v", state, got, ready)
+			}
+		})
+	}
+}
+
+// pollingSnapshot is a snapshot that is ready after GetStatus() was called
+// readyAfter times. It never becomes ready when readyAfter is 0.
+type pollingSnapshot struct {
+	Snapshot
+
+	readyAfter int
+	polls      int
+	state      SnapshotState
+}
+
+func (ps *pollingSnapshot) GetStatus(_ context.Context) (SnapshotState, string, error) {
+	ps.polls++
+	if ps.readyAfter != 0 && ps.polls >= ps.readyAfter {
+		return SnapshotStateReady, "snapshot is ready", nil
+	}
+
+	return ps.state, fmt.Sprintf("poll %d", ps.polls), nil
+}
+
+func TestWaitSnapshotReady(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ready after polls", func(t *testing.T) {
+		t.Parallel()
+		snap := &pollingSnapshot{readyAfter: 3, state: SnapshotStateCreating}
+
+		err := WaitSnapshotReady(context.TODO(), snap, time.Millisecond)
+		if err != nil {
+			t.Errorf("WaitSnapshotReady() error = %v", err)
+		}
+		if snap.polls != 3 {
+			t.Errorf("GetStatus() called %d times, want 3", snap.polls)
+		}
+	})
+
+	t.Run("never ready", func(t *testing.T) {
+		t.Parallel()
+		snap := &pollingSnapshot{state: SnapshotStateFlattening}
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+
+		err := WaitSnapshotReady(ctx, snap, 10*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("WaitSnapshotReady() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		want := fmt.Sprintf("snapshot is not ready, state %q: poll %d: %v",
+			SnapshotStateFlattening, snap.polls, context.DeadlineExceeded)
+		if err.Error() != want {
+			t.Errorf("WaitSnapshotReady() error = %q, want %q", err, want)
+		}
+	})
+
+	t.Run("errored", func(t *testing.T) {
+		t.Parallel()
+		snap := &pollingSnapshot{state: SnapshotStateErrored}
+
+		err := WaitSnapshotReady(context.TODO(), snap, time.Millisecond)
+		if !errors.Is(err, ErrSnapshotErrored) {
+			t.Errorf("WaitSnapshotReady() error = %v, want %v", err, ErrSnapshotErrored)
+		}
+		if snap.polls != 1 {
+			t.Errorf("GetStatus() called %d times, want 1", snap.polls)
+		}
+	})
+}
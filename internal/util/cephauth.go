@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cephAuthEntity is an entry in the output of `ceph auth get -f json`.
+type cephAuthEntity struct {
+	Entity string            `json:"entity"`
+	Caps   map[string]string `json:"caps"`
+}
+
+// capGrants splits the caps of a service, like "profile rbd pool=a, allow r",
+// into the separate grants.
+func capGrants(caps string) []string {
+	var grants []string
+	for _, grant := range strings.Split(caps, ",") {
+		grant = strings.Join(strings.Fields(grant), " ")
+		if grant != "" {
+			grants = append(grants, grant)
+		}
+	}
+
+	return grants
+}
+
+// missingCaps returns the required caps that are not granted, formatted as
+// "service 'grant'". A service with "allow *" grants all caps of the service.
+func missingCaps(granted, required map[string]string) []string {
+	var missing []string
+	for service, caps := range required {
+		grants := capGrants(granted[service])
+		if slices.Contains(grants, "allow *") {
+			continue
+		}
+
+		for _, grant := range capGrants(caps) {
+			if !slices.Contains(grants, grant) {
+				missing = append(missing, fmt.Sprintf("%s '%s'", service, grant))
+			}
+		}
+	}
+	slices.Sort(missing)
+
+	return missing
+}
+
+// VerifyUserCaps checks that the Ceph user has all of the requiredCaps in
+// the cluster with the given clusterID. The requiredCaps map a service
+// ("mon", "osd", "mgr" or "mds") to its caps, multiple caps for a service are
+// separated by a comma. The user is the name of the user without the
+// "client." prefix, cr needs to be allowed to read the caps of the user.
+func VerifyUserCaps(
+	ctx context.Context,
+	timeout time.Duration,
+	clusterID, user string,
+	cr *Credentials,
+	requiredCaps map[string]string,
+) error {
+	monitors, err := Mons(CsiConfigFile, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get monitors for cluster ID %q: %w", clusterID, err)
+	}
+
+	confFile, err := GetEffectiveCephConfFile(CsiConfigFile, clusterID, monitors)
+	if err != nil {
+		return err
+	}
+
+	entities, err := ExecCommandJSON[[]cephAuthEntity](
+		ctx,
+		timeout,
+		"ceph",
+		"auth",
+		"get",
+		"client."+user,
+		"-m", monitors,
+		"--id", cr.ID,
+		"--keyfile="+cr.KeyFile,
+		"-c", confFile,
+		"-f", "json",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get caps of user %q: %w", user, err)
+	}
+
+	if len(entities) == 0 {
+		return fmt.Errorf("user %q not found in cluster ID %q", user, clusterID)
+	}
+
+	missing := missingCaps(entities[0].Caps, requiredCaps)
+	if len(missing) != 0 {
+		return fmt.Errorf("user %q in cluster ID %q is missing caps: %s",
+			user, clusterID, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
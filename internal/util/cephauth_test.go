@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cephAuthGetRBD is the output of `ceph auth get client.csi-rbd-provisioner -f json`.
+const cephAuthGetRBD = `[
+  {
+    "entity": "client.csi-rbd-provisioner",
+    "key": "AQBgz/BlWrGzKhAAVq+QBrvVhV5g4VMLbO3Txg==",
+    "caps": {
+      "mgr": "allow rw",
+      "mon": "profile rbd, allow command 'osd blocklist'",
+      "osd": "profile rbd"
+    }
+  }
+]`
+
+// cephAuthGetAdmin is the output of `ceph auth get client.admin -f json`.
+const cephAuthGetAdmin = `[
+  {
+    "entity": "client.admin",
+    "key": "AQDOyfBl8mNSCBAA1/6h6Lb1uKlAUc3TYXeUyA==",
+    "caps": {
+      "mds": "allow *",
+      "mgr": "allow *",
+      "mon": "allow *",
+      "osd": "allow *"
+    }
+  }
+]`
+
+func TestMissingCaps(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		output   string
+		required map[string]string
+		want     []string
+	}{
+		{
+			name:   "all caps granted",
+			output: cephAuthGetRBD,
+			required: map[string]string{
+				"mon": "profile rbd, allow command 'osd blocklist'",
+				"osd": "profile rbd",
+			},
+			want: nil,
+		},
+		{
+			name:     "subset of caps granted",
+			output:   cephAuthGetRBD,
+			required: map[string]string{"mon": "profile rbd"},
+			want:     nil,
+		},
+		{
+			name:   "missing caps",
+			output: cephAuthGetRBD,
+			required: map[string]string{
+				"mds": "allow rw",
+				"mon": "profile rbd",
+				"osd": "profile rbd pool=replicapool,allow rwx",
+			},
+			want: []string{"mds 'allow rw'", "osd 'allow rwx'", "osd 'profile rbd pool=replicapool'"},
+		},
+		{
+			name:   "allow * grants all caps",
+			output: cephAuthGetAdmin,
+			required: map[string]string{
+				"mon": "profile rbd",
+				"osd": "profile rbd pool=replicapool",
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var entities []cephAuthEntity
+			require.NoError(t, json.Unmarshal([]byte(tt.output), &entities))
+			require.Len(t, entities, 1)
+			require.Equal(t, tt.want, missingCaps(entities[0].Caps, tt.required))
+		})
+	}
+}
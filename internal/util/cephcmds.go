@@ -19,10 +19,17 @@ package util
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
@@ -31,8 +38,101 @@ import (
 	"github.com/ceph/go-ceph/rados"
 )
 
-// InvalidPoolID used to denote an invalid pool.
-const InvalidPoolID int64 = -1
+const (
+	// InvalidPoolID used to denote an invalid pool.
+	InvalidPoolID int64 = -1
+
+	// DefaultMaxOutputBytes is the maximum number of bytes that is captured
+	// from the stdout and stderr streams of a command by
+	// ExecCommandWithTimeout.
+	DefaultMaxOutputBytes = 32 * 1024 * 1024
+
+	// killedOutputDelay is the time to wait for the output of a command
+	// that was killed on timeout. Child processes of the command may keep
+	// its stdout and stderr open, the output is returned without them.
+	killedOutputDelay = time.Second
+)
+
+// limitedBuffer is an io.Writer that stores up to limit bytes. Everything
+// that is written after the limit has been reached is discarded.
+//
+// The bytes.Buffer is not embedded, as its ReadFrom() function would bypass
+// the limit when used with io.Copy().
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write stores as much of p as the limit permits. It never returns an error,
+// so that the command writing to the buffer does not fail.
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := lb.limit - lb.buf.Len()
+	if len(p) > remaining {
+		lb.truncated = true
+		if remaining > 0 {
+			lb.buf.Write(p[:remaining])
+		}
+
+		return len(p), nil
+	}
+
+	return lb.buf.Write(p)
+}
+
+// String returns the captured data.
+func (lb *limitedBuffer) String() string {
+	return lb.buf.String()
+}
+
+// maxAbortMatchLen is the length of the data that a pattern for aborting a
+// command, that is not a literal string, can match over multiple writes.
+const maxAbortMatchLen = 4096
+
+// abortWriter writes to a limitedBuffer, and calls abort once when the
+// written data matches the pattern. The end of the previous writes is kept,
+// so that a match that is split over multiple writes is detected without
+// matching all captured data again.
+type abortWriter struct {
+	*limitedBuffer
+	pattern *regexp.Regexp
+	abort   func()
+	aborted bool
+
+	// tail contains the last tailLen bytes of the previous writes
+	tail    []byte
+	tailLen int
+}
+
+// newAbortWriter returns an abortWriter that writes to lb. For a literal
+// pattern, the tail only needs to hold one byte less than the pattern.
+func newAbortWriter(lb *limitedBuffer, pattern *regexp.Regexp, abort func()) *abortWriter {
+	tailLen := maxAbortMatchLen
+	if literal, complete := pattern.LiteralPrefix(); complete {
+		tailLen = max(len(literal)-1, 0)
+	}
+
+	return &abortWriter{limitedBuffer: lb, pattern: pattern, abort: abort, tailLen: tailLen}
+}
+
+// Write stores p in the buffer, and aborts the command on a match.
+func (aw *abortWriter) Write(p []byte) (int, error) {
+	n, err := aw.limitedBuffer.Write(p)
+	if aw.aborted {
+		return n, err
+	}
+
+	data := append(aw.tail, p...)
+	if aw.pattern.Match(data) {
+		aw.aborted = true
+		aw.abort()
+	}
+
+	keep := min(len(data), aw.tailLen)
+	aw.tail = append(aw.tail[:0], data[len(data)-keep:]...)
+
+	return n, err
+}
 
 // ExecuteCommandWithNSEnter executes passed in program with args with nsenter
 // and returns separate stdout and stderr streams. In case ctx is not set to
@@ -79,6 +179,12 @@ func ExecuteCommandWithNSEnter(ctx context.Context, netPath, program string, arg
 // and stderr streams. In case ctx is not set to context.TODO(), the command
 // will be logged after it was executed.
 func ExecCommand(ctx context.Context, program string, args ...string) (string, string, error) {
+	return ExecCommandWithEnv(ctx, nil, program, args...)
+}
+
+// ExecCommandWithEnv behaves like ExecCommand, but adds the variables in env,
+// in the form "key=value", to the environment of the command.
+func ExecCommandWithEnv(ctx context.Context, env []string, program string, args ...string) (string, string, error) {
 	var (
 		cmd           = exec.Command(program, args...) // #nosec:G204, commands executing not vulnerable.
 		sanitizedArgs = stripsecrets.InArgs(args)
@@ -88,6 +194,9 @@ func ExecCommand(ctx context.Context, program string, args ...string) (string, s
 
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
+	if len(env) != 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	err := cmd.Run()
 	stdout := stdoutBuf.String()
@@ -109,10 +218,26 @@ func ExecCommand(ctx context.Context, program string, args ...string) (string, s
 	return stdout, stderr, nil
 }
 
+// CephLogEnv returns the environment for Ceph commands to write their log to
+// the file name.log in logDir. Ceph commands read the CEPH_ARGS variable as
+// additional arguments. Without logDir, nil is returned.
+func CephLogEnv(logDir, name string) []string {
+	if logDir == "" {
+		return nil
+	}
+
+	return []string{
+		fmt.Sprintf("CEPH_ARGS=--log-to-file=true --log-file=%s", filepath.Join(logDir, name+".log")),
+	}
+}
+
 // ExecCommandWithTimeout executes passed in program with args, timeout and
 // returns separate stdout and stderr streams. If the command is not executed
-// within given timeout, the process will be killed. In case ctx is not set to
-// context.TODO(), the command will be logged after it was executed.
+// within given timeout, the process will be killed, and the output that was
+// captured until then is returned together with an error that wraps
+// context.DeadlineExceeded. In case ctx is not set to context.TODO(), the
+// command will be logged after it was executed.
+// The captured stdout and stderr streams are limited to DefaultMaxOutputBytes.
 func ExecCommandWithTimeout(
 	ctx context.Context,
 	timeout time.Duration,
@@ -121,11 +246,212 @@ func ExecCommandWithTimeout(
 	string,
 	string,
 	error,
+) {
+	return ExecCommandWithTimeoutAndMaxOutput(ctx, timeout, DefaultMaxOutputBytes, program, args...)
+}
+
+// ExecCommandWithTimeoutAndMaxOutput behaves like ExecCommandWithTimeout, but
+// captures at most maxOutputBytes of the stdout and stderr streams each. In
+// case the output of the command exceeded the limit, the truncated output is
+// returned together with an error wrapping ErrOutputTruncated.
+func ExecCommandWithTimeoutAndMaxOutput(
+	ctx context.Context,
+	timeout time.Duration,
+	maxOutputBytes int,
+	program string,
+	args ...string) (
+	string,
+	string,
+	error,
+) {
+	return execCommandWithTimeout(ctx, timeout, maxOutputBytes, "", nil, program, args...)
+}
+
+// ExecCommandWithTimeoutInDir behaves like ExecCommandWithTimeout, but runs
+// the command in the working directory dir. An empty dir runs the command in
+// the working directory of the current process.
+func ExecCommandWithTimeoutInDir(
+	ctx context.Context,
+	timeout time.Duration,
+	dir string,
+	program string,
+	args ...string) (
+	string,
+	string,
+	error,
+) {
+	return execCommandWithTimeout(ctx, timeout, DefaultMaxOutputBytes, dir, nil, program, args...)
+}
+
+// ExecCommandWithTimeoutAndAbort behaves like ExecCommandWithTimeout, but
+// kills the command as soon as its stderr matches abortOn. This prevents
+// waiting for the timeout when a command reports a fatal condition early,
+// like "connection refused". The returned error wraps ErrCommandAborted in
+// that case. A nil abortOn never aborts the command.
+func ExecCommandWithTimeoutAndAbort(
+	ctx context.Context,
+	timeout time.Duration,
+	abortOn *regexp.Regexp,
+	program string,
+	args ...string) (
+	string,
+	string,
+	error,
+) {
+	return execCommandWithTimeout(ctx, timeout, DefaultMaxOutputBytes, "", abortOn, program, args...)
+}
+
+// CommandPriority is the CPU and IO scheduling priority of a command.
+type CommandPriority struct {
+	// Nice is the adjustment of the niceness of the command, from -20
+	// (highest priority) to 19 (lowest priority). 0 keeps the niceness of
+	// the driver.
+	Nice int
+	// IOClass is the ionice scheduling class of the command, 1 (realtime),
+	// 2 (best-effort) or 3 (idle). 0 keeps the IO priority of the driver.
+	IOClass int
+	// IOLevel is the priority within the realtime and best-effort IOClass,
+	// from 0 (highest priority) to 7 (lowest priority).
+	IOLevel int
+}
+
+// priorityArgs returns the nice and ionice command line that runs a command
+// with the priority. Priorities that are not supported on the platform are
+// skipped, lookPath is used to find the nice and ionice executables.
+func (prio CommandPriority) priorityArgs(
+	ctx context.Context,
+	goos string,
+	lookPath func(string) (string, error),
+) ([]string, error) {
+	switch {
+	case prio.Nice < -20 || prio.Nice > 19:
+		return nil, fmt.Errorf("invalid nice value %d, it must be between -20 and 19", prio.Nice)
+	case prio.IOClass < 0 || prio.IOClass > 3:
+		return nil, fmt.Errorf("invalid IO class %d, it must be between 0 and 3", prio.IOClass)
+	case prio.IOLevel < 0 || prio.IOLevel > 7:
+		return nil, fmt.Errorf("invalid IO level %d, it must be between 0 and 7", prio.IOLevel)
+	}
+
+	if goos != "linux" {
+		log.DebugLog(ctx, "command priorities are not supported on %s, running with the default priority", goos)
+
+		return nil, nil
+	}
+
+	var args []string
+	if prio.Nice != 0 {
+		if nice, err := lookPath("nice"); err == nil {
+			args = append(args, nice, "-n", strconv.Itoa(prio.Nice))
+		} else {
+			log.DebugLog(ctx, "not setting the CPU priority of the command: %v", err)
+		}
+	}
+
+	if prio.IOClass != 0 {
+		if ionice, err := lookPath("ionice"); err == nil {
+			args = append(args, ionice, "-c", strconv.Itoa(prio.IOClass))
+			if prio.IOClass != 3 {
+				args = append(args, "-n", strconv.Itoa(prio.IOLevel))
+			}
+		} else {
+			log.DebugLog(ctx, "not setting the IO priority of the command: %v", err)
+		}
+	}
+
+	return args, nil
+}
+
+// ExecCommandWithTimeoutAndPriority behaves like ExecCommandWithTimeout, but
+// runs the command with the CPU and IO priority of prio, so that background
+// operations like flattening or exporting images do not starve other IO on
+// the node. On platforms without support for the priorities, or when the
+// nice and ionice executables are missing, the command runs with the
+// default priority.
+func ExecCommandWithTimeoutAndPriority(
+	ctx context.Context,
+	timeout time.Duration,
+	prio CommandPriority,
+	program string,
+	args ...string) (
+	string,
+	string,
+	error,
+) {
+	prioArgs, err := prio.priorityArgs(ctx, runtime.GOOS, exec.LookPath)
+	if err != nil {
+		return "", "", err
+	}
+	if len(prioArgs) != 0 {
+		args = append(append(prioArgs[1:], program), args...)
+		program = prioArgs[0]
+	}
+
+	return execCommandWithTimeout(ctx, timeout, DefaultMaxOutputBytes, "", nil, program, args...)
+}
+
+// ExecCommandWithTimeoutAndLatency behaves like ExecCommandWithTimeout, and
+// additionally returns the wall-clock duration of the command, including the
+// time it took to start the process. The latency is returned on failure too.
+func ExecCommandWithTimeoutAndLatency(
+	ctx context.Context,
+	timeout time.Duration,
+	program string,
+	args ...string) (
+	string,
+	string,
+	time.Duration,
+	error,
+) {
+	start := time.Now()
+	stdout, stderr, err := execCommandWithTimeout(ctx, timeout, DefaultMaxOutputBytes, "", nil, program, args...)
+
+	return stdout, stderr, time.Since(start), err
+}
+
+// ExecCommandJSON executes the program with ExecCommandWithTimeout, and
+// unmarshals the stdout of the command into a value of type T. This is
+// commonly used for Ceph commands that are called with `-f json`.
+func ExecCommandJSON[T any](
+	ctx context.Context,
+	timeout time.Duration,
+	program string,
+	args ...string,
+) (T, error) {
+	var result T
+
+	stdout, _, err := ExecCommandWithTimeout(ctx, timeout, program, args...)
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal([]byte(stdout), &result)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse the output of %s (%w), raw output: %s",
+			program, err, stdout)
+	}
+
+	return result, nil
+}
+
+// execCommandWithTimeout executes the program in the working directory dir,
+// and captures at most maxOutputBytes of stdout and stderr. The command is
+// killed when abortOn is set and matches stderr.
+func execCommandWithTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+	maxOutputBytes int,
+	dir string,
+	abortOn *regexp.Regexp,
+	program string,
+	args ...string) (
+	string,
+	string,
+	error,
 ) {
 	var (
 		sanitizedArgs = stripsecrets.InArgs(args)
-		stdoutBuf     bytes.Buffer
-		stderrBuf     bytes.Buffer
+		stdoutBuf     = limitedBuffer{limit: maxOutputBytes}
+		stderrBuf     = limitedBuffer{limit: maxOutputBytes}
 	)
 
 	cctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -134,20 +460,50 @@ func ExecCommandWithTimeout(
 	cmd := exec.CommandContext(cctx, program, args...) // #nosec:G204, commands executing not vulnerable.
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
+	cmd.Dir = dir
+	cmd.WaitDelay = killedOutputDelay
+
+	var stderrAbort *abortWriter
+	if abortOn != nil {
+		stderrAbort = newAbortWriter(&stderrBuf, abortOn, cancel)
+		cmd.Stderr = stderrAbort
+	}
 
 	err := cmd.Run()
 	stdout := stdoutBuf.String()
 	stderr := stderrBuf.String()
+	if err == nil && stderrAbort != nil && stderrAbort.aborted {
+		// the command exited before it could be killed
+		err = ErrCommandAborted
+	}
 	if err != nil {
-		// if its a timeout log return context deadline exceeded error message
-		if errors.Is(cctx.Err(), context.DeadlineExceeded) {
+		switch {
+		case stderrAbort != nil && stderrAbort.aborted:
+			err = fmt.Errorf("%w: stderr matched %q", ErrCommandAborted, abortOn)
+		case errors.Is(cctx.Err(), context.DeadlineExceeded):
+			// if its a timeout log return context deadline exceeded error message
 			err = fmt.Errorf("timeout: %w", cctx.Err())
 		}
-		err = fmt.Errorf("an error (%w) and stderror (%s) occurred while running %s args: %v",
+		// stderr may echo the secrets from the command line
+		err = RedactError(fmt.Errorf("an error (%w) and stderror (%s) occurred while running %s args: %v",
 			err,
 			stderr,
 			program,
-			sanitizedArgs)
+			sanitizedArgs))
+
+		if ctx != context.TODO() {
+			log.ErrorLog(ctx, "%s", err)
+		}
+
+		return stdout, stderr, err
+	}
+
+	if stdoutBuf.truncated || stderrBuf.truncated {
+		err = fmt.Errorf("%w: output of %s args: %v exceeded %d bytes",
+			ErrOutputTruncated,
+			program,
+			sanitizedArgs,
+			maxOutputBytes)
 
 		if ctx != context.TODO() {
 			log.ErrorLog(ctx, "%s", err)
@@ -163,10 +519,196 @@ func ExecCommandWithTimeout(
 	return stdout, stderr, nil
 }
 
+// CmdResult is the result of a command that was executed by
+// ExecCommandsBounded.
+type CmdResult struct {
+	Stdout string
+	Stderr string
+	// Err is the error of the command, or the error of the context when the
+	// command was not started because the context was done
+	Err error
+}
+
+// ExecCommandsBounded executes the commands with at most concurrency of them
+// running at the same time, each with the given timeout. The results are
+// returned in the order of cmds. Once the context is done, no new commands
+// are started. Commands that are already running are not interrupted. An
+// error is only returned when not all commands were started, the failures
+// of the individual commands are reported in their CmdResult.
+func ExecCommandsBounded(
+	ctx context.Context,
+	timeout time.Duration,
+	concurrency int,
+	cmds [][]string,
+) ([]CmdResult, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency %d must be 1 or more", concurrency)
+	}
+	for i, args := range cmds {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("command %d is empty", i)
+		}
+	}
+
+	var (
+		results = make([]CmdResult, len(cmds))
+		slots   = make(chan struct{}, concurrency)
+		wg      sync.WaitGroup
+		err     error
+	)
+
+	for i, args := range cmds {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		// a slot may have been taken while the context was done too, it
+		// does not need to be returned as no more commands are started
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%d of %d commands were not started: %w", len(cmds)-i, len(cmds), ctx.Err())
+			for j := i; j < len(cmds); j++ {
+				results[j].Err = ctx.Err()
+			}
+
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			results[i].Stdout, results[i].Stderr, results[i].Err = ExecCommandWithTimeout(
+				ctx, timeout, args[0], args[1:]...)
+		}()
+	}
+	wg.Wait()
+
+	return results, err
+}
+
+// ExecPipe executes the commands in a pipeline, where the stdout of each
+// command is connected to the stdin of the next command. It returns the
+// stdout of the last command, and the stderr of all commands. When one of the
+// commands fails, or the pipeline does not finish within the timeout, all
+// commands are killed and the error of the failing command is returned.
+func ExecPipe(ctx context.Context, timeout time.Duration, cmds [][]string) (string, string, error) {
+	if len(cmds) == 0 {
+		return "", "", errors.New("no commands to execute in the pipeline")
+	}
+
+	cctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		stages     = make([]*exec.Cmd, len(cmds))
+		stdoutBuf  = limitedBuffer{limit: DefaultMaxOutputBytes}
+		stderrBufs = make([]limitedBuffer, len(cmds))
+		sanitized  = make([]string, len(cmds))
+		err        error
+	)
+
+	for i, args := range cmds {
+		if len(args) == 0 {
+			return "", "", fmt.Errorf("command %d in the pipeline is empty", i)
+		}
+
+		// #nosec:G204, commands executing not vulnerable.
+		stages[i] = exec.CommandContext(cctx, args[0], args[1:]...)
+		stderrBufs[i].limit = DefaultMaxOutputBytes
+		stages[i].Stderr = &stderrBufs[i]
+		sanitized[i] = fmt.Sprintf("%s %v", args[0], stripsecrets.InArgs(args[1:]))
+
+		if i > 0 {
+			stages[i].Stdin, err = stages[i-1].StdoutPipe()
+			if err != nil {
+				return "", "", fmt.Errorf("failed to connect %s to %s: %w", sanitized[i-1], sanitized[i], err)
+			}
+		}
+	}
+	stages[len(stages)-1].Stdout = &stdoutBuf
+	pipeline := strings.Join(sanitized, " | ")
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failed   = -1
+		errs     = make([]error, len(stages))
+	)
+
+	// fail records the first command that failed, and kills the others
+	fail := func(i int) {
+		failOnce.Do(func() {
+			failed = i
+			cancel()
+		})
+	}
+
+	// all commands need to be started before waiting for any of them, as
+	// Wait() closes the pipe that the next command uses as stdin
+	started := 0
+	for i, stage := range stages {
+		errs[i] = stage.Start()
+		if errs[i] != nil {
+			fail(i)
+
+			break
+		}
+		started++
+	}
+
+	for i, stage := range stages[:started] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			errs[i] = stage.Wait()
+			if errs[i] != nil {
+				fail(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stdout := stdoutBuf.String()
+	stderrs := make([]string, len(stderrBufs))
+	for i := range stderrBufs {
+		stderrs[i] = stderrBufs[i].String()
+	}
+	stderr := strings.Join(stderrs, "")
+
+	if failed != -1 {
+		err = errs[failed]
+		// if its a timeout log return context deadline exceeded error message
+		if errors.Is(cctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timeout: %w", cctx.Err())
+		}
+		err = RedactError(fmt.Errorf("an error (%w) and stderror (%s) occurred while running %s in pipeline: %s",
+			err,
+			stderrs[failed],
+			sanitized[failed],
+			pipeline))
+
+		if ctx != context.TODO() {
+			log.ErrorLog(ctx, "%s", err)
+		}
+
+		return stdout, stderr, err
+	}
+
+	if ctx != context.TODO() {
+		log.UsefulLog(ctx, "pipeline succeeded: %s", pipeline)
+	}
+
+	return stdout, stderr, nil
+}
+
 // GetPoolID fetches the ID of the pool that matches the passed in poolName
 // parameter.
 func GetPoolID(monitors string, cr *Credentials, poolName string) (int64, error) {
-	conn, err := connPool.Get(monitors, cr.ID, cr.KeyFile)
+	conn, err := connPool.Get("", monitors, cr.ID, cr.KeyFile)
 	if err != nil {
 		return InvalidPoolID, err
 	}
@@ -186,7 +728,7 @@ func GetPoolID(monitors string, cr *Credentials, poolName string) (int64, error)
 // GetPoolName fetches the pool whose pool ID is equal to the requested poolID
 // parameter.
 func GetPoolName(monitors string, cr *Credentials, poolID int64) (string, error) {
-	conn, err := connPool.Get(monitors, cr.ID, cr.KeyFile)
+	conn, err := connPool.Get("", monitors, cr.ID, cr.KeyFile)
 	if err != nil {
 		return "", err
 	}
@@ -227,7 +769,7 @@ func GetPoolIDs(ctx context.Context, monitors, journalPool, imagePool string, cr
 // is already present in rados.
 func CreateObject(ctx context.Context, monitors string, cr *Credentials, poolName, namespace, objectName string) error {
 	conn := ClusterConnection{}
-	err := conn.Connect(monitors, cr)
+	err := conn.Connect("", monitors, cr)
 	if err != nil {
 		return err
 	}
@@ -263,7 +805,7 @@ func CreateObject(ctx context.Context, monitors string, cr *Credentials, poolNam
 // is not found in rados.
 func RemoveObject(ctx context.Context, monitors string, cr *Credentials, poolName, namespace, oMapName string) error {
 	conn := ClusterConnection{}
-	err := conn.Connect(monitors, cr)
+	err := conn.Connect("", monitors, cr)
 	if err != nil {
 		return err
 	}
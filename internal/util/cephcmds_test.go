@@ -17,10 +17,25 @@ limitations under the License.
 package util
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"k8s.io/klog/v2"
 )
 
 func TestExecCommandWithTimeout(t *testing.T) {
@@ -86,3 +101,629 @@ func TestExecCommandWithTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestExecCommandWithTimeoutPartialOutput(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	stdout, _, err := ExecCommandWithTimeout(context.TODO(), time.Second, "sh", "-c", "echo partial; sleep 10")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecCommandWithTimeout() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if stdout != "partial\n" {
+		t.Errorf("ExecCommandWithTimeout() stdout = %q, want %q", stdout, "partial\n")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ExecCommandWithTimeout() returned after %v, the command was not killed on timeout", elapsed)
+	}
+}
+
+//nolint:paralleltest // redirects the output of klog
+func TestExecCommandWithTimeoutTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	klog.LogToStderr(false)
+	klog.SetOutput(&buf)
+	defer klog.LogToStderr(true)
+
+	ctx := log.WithTraceID(context.Background(), "trace-1234")
+	_, _, err := ExecCommandWithTimeout(ctx, time.Second, "false")
+	if err == nil {
+		t.Fatal("ExecCommandWithTimeout() should fail for false")
+	}
+	klog.Flush()
+
+	if !strings.Contains(buf.String(), "Trace-ID: trace-1234 ") {
+		t.Errorf("log output %q does not contain the trace ID", buf.String())
+	}
+}
+
+//nolint:paralleltest // redirects the output and changes the verbosity of klog
+func TestExecCommandTraceID(t *testing.T) {
+	// the succeeded commands are logged at the Useful level
+	klogFlags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(klogFlags)
+	err := klogFlags.Set("v", strconv.Itoa(int(log.Useful)))
+	if err != nil {
+		t.Fatalf("failed to set the klog verbosity: %v", err)
+	}
+	defer func() { _ = klogFlags.Set("v", "0") }()
+
+	var buf bytes.Buffer
+	klog.LogToStderr(false)
+	klog.SetOutput(&buf)
+	defer klog.LogToStderr(true)
+
+	ctx := log.WithTraceID(context.Background(), "trace-5678")
+	_, _, err = ExecCommand(ctx, "true", "--trace-arg")
+	if err != nil {
+		t.Fatalf("ExecCommand() failed: %v", err)
+	}
+	klog.Flush()
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "command succeeded: true [--trace-arg]") {
+			if !strings.Contains(line, "Trace-ID: trace-5678 ") {
+				t.Errorf("exec log %q does not contain the trace ID", line)
+			}
+
+			return
+		}
+	}
+	t.Errorf("log output %q does not contain the exec log", buf.String())
+}
+
+func TestExecCommandWithTimeoutAndMaxOutput(t *testing.T) {
+	t.Parallel()
+
+	// "seq 1 1000" writes 3893 bytes to stdout
+	stdout, _, err := ExecCommandWithTimeoutAndMaxOutput(context.TODO(), time.Second, 100, "seq", "1", "1000")
+	if !errors.Is(err, ErrOutputTruncated) {
+		t.Errorf("ExecCommandWithTimeoutAndMaxOutput() error = %v, want %v", err, ErrOutputTruncated)
+	}
+	if len(stdout) != 100 {
+		t.Errorf("ExecCommandWithTimeoutAndMaxOutput() got %d bytes, want %d", len(stdout), 100)
+	}
+	if !strings.HasPrefix(stdout, "1\n2\n3\n") {
+		t.Errorf("ExecCommandWithTimeoutAndMaxOutput() got = %q, want start of the output", stdout)
+	}
+
+	// output smaller than the limit is not truncated
+	stdout, _, err = ExecCommandWithTimeoutAndMaxOutput(context.TODO(), time.Second, 100, "echo", "hello")
+	if err != nil {
+		t.Errorf("ExecCommandWithTimeoutAndMaxOutput() error = %v", err)
+	}
+	if stdout != "hello\n" {
+		t.Errorf("ExecCommandWithTimeoutAndMaxOutput() got = %v, want %v", stdout, "hello\n")
+	}
+}
+
+func TestExecPipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		cmds        [][]string
+		timeout     time.Duration
+		stdout      string
+		expectedErr error
+		wantErr     bool
+	}{
+		{
+			name:    "echo hello | tr a-z A-Z",
+			cmds:    [][]string{{"echo", "hello"}, {"tr", "a-z", "A-Z"}},
+			timeout: time.Second,
+			stdout:  "HELLO\n",
+		},
+		{
+			name:    "three stages",
+			cmds:    [][]string{{"seq", "1", "5"}, {"grep", "-v", "3"}, {"wc", "-l"}},
+			timeout: time.Second,
+			stdout:  "4\n",
+		},
+		{
+			name:    "failing stage",
+			cmds:    [][]string{{"sleep", "3"}, {"false"}, {"cat"}},
+			timeout: 10 * time.Second,
+			wantErr: true,
+		},
+		{
+			name:        "pipeline with timeout",
+			cmds:        [][]string{{"sleep", "3"}, {"cat"}},
+			timeout:     time.Second,
+			expectedErr: context.DeadlineExceeded,
+			wantErr:     true,
+		},
+		{
+			name:    "no commands",
+			cmds:    [][]string{},
+			timeout: time.Second,
+			wantErr: true,
+		},
+		{
+			name:    "empty command",
+			cmds:    [][]string{{"echo", "hello"}, {}},
+			timeout: time.Second,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			start := time.Now()
+			stdout, _, err := ExecPipe(context.TODO(), tt.timeout, tt.cmds)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecPipe() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("ExecPipe() error expected got = %v, want %v", err, tt.expectedErr)
+			}
+
+			if stdout != tt.stdout {
+				t.Errorf("ExecPipe() got = %q, want %q", stdout, tt.stdout)
+			}
+
+			// a failing stage should abort the other stages
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("ExecPipe() took %v, the pipeline was not aborted", elapsed)
+			}
+		})
+	}
+}
+
+func TestExecCommandWithTimeoutInDir(t *testing.T) {
+	t.Parallel()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temporary directory: %v", err)
+	}
+
+	stdout, _, err := ExecCommandWithTimeoutInDir(context.TODO(), time.Second, dir, "pwd")
+	if err != nil {
+		t.Errorf("ExecCommandWithTimeoutInDir() error = %v", err)
+	}
+	if stdout != dir+"\n" {
+		t.Errorf("ExecCommandWithTimeoutInDir() got = %q, want %q", stdout, dir+"\n")
+	}
+
+	// without a directory, the working directory of the process is used
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	cwd, err = filepath.EvalSymlinks(cwd)
+	if err != nil {
+		t.Fatalf("failed to resolve working directory: %v", err)
+	}
+
+	stdout, _, err = ExecCommandWithTimeoutInDir(context.TODO(), time.Second, "", "pwd", "-P")
+	if err != nil {
+		t.Errorf("ExecCommandWithTimeoutInDir() error = %v", err)
+	}
+	if stdout != cwd+"\n" {
+		t.Errorf("ExecCommandWithTimeoutInDir() got = %q, want %q", stdout, cwd+"\n")
+	}
+
+	// a missing directory fails the command
+	_, _, err = ExecCommandWithTimeoutInDir(context.TODO(), time.Second, dir+"/missing", "pwd")
+	if err == nil {
+		t.Error("ExecCommandWithTimeoutInDir() should fail for a missing directory")
+	}
+}
+
+func TestExecCommandJSON(t *testing.T) {
+	t.Parallel()
+
+	type pool struct {
+		Name string `json:"poolname"`
+		ID   int64  `json:"poolnum"`
+	}
+
+	t.Run("parse JSON output", func(t *testing.T) {
+		t.Parallel()
+		pools, err := ExecCommandJSON[[]pool](context.TODO(), time.Second,
+			"echo", `[{"poolname":"replicapool","poolnum":1},{"poolname":"ecpool","poolnum":2}]`)
+		if err != nil {
+			t.Fatalf("ExecCommandJSON() error = %v", err)
+		}
+		want := []pool{{Name: "replicapool", ID: 1}, {Name: "ecpool", ID: 2}}
+		if !reflect.DeepEqual(pools, want) {
+			t.Errorf("ExecCommandJSON() = %v, want %v", pools, want)
+		}
+	})
+
+	t.Run("invalid JSON output", func(t *testing.T) {
+		t.Parallel()
+		_, err := ExecCommandJSON[[]pool](context.TODO(), time.Second, "echo", "not json")
+		if err == nil {
+			t.Fatal("ExecCommandJSON() should fail for invalid JSON")
+		}
+		if !strings.Contains(err.Error(), "not json") {
+			t.Errorf("ExecCommandJSON() error = %v, should contain the raw output", err)
+		}
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		t.Parallel()
+		_, err := ExecCommandJSON[[]pool](context.TODO(), time.Second, "false")
+		if err == nil {
+			t.Error("ExecCommandJSON() should fail for a failing command")
+		}
+	})
+}
+
+func TestExecCommandWithTimeoutAndLatency(t *testing.T) {
+	t.Parallel()
+
+	const (
+		sleep     = 200 * time.Millisecond
+		tolerance = 100 * time.Millisecond
+	)
+
+	start := time.Now()
+	_, _, latency, err := ExecCommandWithTimeoutAndLatency(context.TODO(), 5*time.Second, "sleep", "0.2")
+	observed := time.Since(start)
+	if err != nil {
+		t.Fatalf("ExecCommandWithTimeoutAndLatency() error = %v", err)
+	}
+	if latency < sleep {
+		t.Errorf("ExecCommandWithTimeoutAndLatency() latency = %v, should be at least %v", latency, sleep)
+	}
+	if latency > observed || observed-latency > tolerance {
+		t.Errorf("ExecCommandWithTimeoutAndLatency() latency = %v, want within %v of %v",
+			latency, tolerance, observed)
+	}
+
+	// the latency is returned for failing commands too
+	_, _, latency, err = ExecCommandWithTimeoutAndLatency(context.TODO(), 100*time.Millisecond, "sleep", "1")
+	if err == nil {
+		t.Fatal("ExecCommandWithTimeoutAndLatency() should fail on timeout")
+	}
+	if latency < 100*time.Millisecond {
+		t.Errorf("ExecCommandWithTimeoutAndLatency() latency = %v, should be at least the timeout", latency)
+	}
+}
+
+func TestExecCommandWithTimeoutAndAbort(t *testing.T) {
+	t.Parallel()
+
+	abortOn := regexp.MustCompile("connection refused")
+	script := "echo 'error: connection refused' >&2; exec sleep 10"
+
+	start := time.Now()
+	_, stderr, err := ExecCommandWithTimeoutAndAbort(context.TODO(), 10*time.Second, abortOn, "sh", "-c", script)
+	if !errors.Is(err, ErrCommandAborted) {
+		t.Errorf("ExecCommandWithTimeoutAndAbort() error = %v, want %v", err, ErrCommandAborted)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ExecCommandWithTimeoutAndAbort() took %v, the command was not aborted", elapsed)
+	}
+	if stderr != "error: connection refused\n" {
+		t.Errorf("ExecCommandWithTimeoutAndAbort() stderr = %q", stderr)
+	}
+
+	// other output on stderr does not abort the command
+	stdout, _, err := ExecCommandWithTimeoutAndAbort(context.TODO(), 10*time.Second, abortOn,
+		"sh", "-c", "echo 'warning: slow' >&2; echo done")
+	if err != nil {
+		t.Errorf("ExecCommandWithTimeoutAndAbort() error = %v", err)
+	}
+	if stdout != "done\n" {
+		t.Errorf("ExecCommandWithTimeoutAndAbort() stdout = %q, want %q", stdout, "done\n")
+	}
+
+	// without a pattern, the timeout applies
+	_, _, err = ExecCommandWithTimeoutAndAbort(context.TODO(), 100*time.Millisecond, nil, "sh", "-c", script)
+	if err == nil || errors.Is(err, ErrCommandAborted) {
+		t.Errorf("ExecCommandWithTimeoutAndAbort() error = %v, want a timeout", err)
+	}
+}
+
+func TestAbortWriter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		pattern string
+		writes  []string
+		aborted bool
+	}{
+		{
+			name:    "match in a single write",
+			pattern: "connection refused",
+			writes:  []string{"error: connection refused\n"},
+			aborted: true,
+		},
+		{
+			name:    "match split over writes",
+			pattern: "connection refused",
+			writes:  []string{"error: conn", "ection ", "refused\n"},
+			aborted: true,
+		},
+		{
+			name:    "regular expression split over writes",
+			pattern: "error [0-9]+: timed out",
+			writes:  []string{"error 1", "10: timed", " out\n"},
+			aborted: true,
+		},
+		{
+			name:    "no match",
+			pattern: "connection refused",
+			writes:  []string{"warning: connection ", "slow\n", "refused\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			aborts := 0
+			aw := newAbortWriter(&limitedBuffer{limit: DefaultMaxOutputBytes}, regexp.MustCompile(tt.pattern),
+				func() { aborts++ })
+			for _, w := range tt.writes {
+				if _, err := aw.Write([]byte(w)); err != nil {
+					t.Errorf("abortWriter.Write() error = %v", err)
+				}
+				if len(aw.tail) > aw.tailLen {
+					t.Errorf("abortWriter.tail has %d bytes, want at most %d", len(aw.tail), aw.tailLen)
+				}
+			}
+			if aw.aborted != tt.aborted {
+				t.Errorf("abortWriter.aborted = %v, want %v", aw.aborted, tt.aborted)
+			}
+			if got := aw.String(); got != strings.Join(tt.writes, "") {
+				t.Errorf("abortWriter.String() = %q", got)
+			}
+
+			// abort is only called once
+			_, _ = aw.Write([]byte(strings.Join(tt.writes, "")))
+			want := 0
+			if tt.aborted {
+				want = 1
+			}
+			if aborts != want {
+				t.Errorf("abort was called %d times, want %d", aborts, want)
+			}
+		})
+	}
+}
+
+func TestExecCommandsBounded(t *testing.T) {
+	t.Parallel()
+
+	t.Run("concurrency and ordering", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		// each command reports how many commands are running, including
+		// itself, and the commands with a lower index finish last
+		cmds := make([][]string, 6)
+		for i := range cmds {
+			script := fmt.Sprintf("touch %[1]s/%[2]d; ls %[1]s | wc -l; sleep 0.%[3]d; rm %[1]s/%[2]d; echo %[2]d",
+				dir, i, len(cmds)-i)
+			cmds[i] = []string{"sh", "-c", script}
+		}
+
+		results, err := ExecCommandsBounded(context.TODO(), 10*time.Second, 2, cmds)
+		if err != nil {
+			t.Fatalf("ExecCommandsBounded() error = %v", err)
+		}
+		if len(results) != len(cmds) {
+			t.Fatalf("ExecCommandsBounded() returned %d results, want %d", len(results), len(cmds))
+		}
+		for i, result := range results {
+			if result.Err != nil {
+				t.Errorf("command %d failed: %v", i, result.Err)
+
+				continue
+			}
+			lines := strings.Fields(result.Stdout)
+			if len(lines) != 2 {
+				t.Errorf("command %d returned unexpected output %q", i, result.Stdout)
+
+				continue
+			}
+			if running, _ := strconv.Atoi(lines[0]); running < 1 || running > 2 {
+				t.Errorf("command %d ran with %s commands, want at most 2", i, lines[0])
+			}
+			if lines[1] != strconv.Itoa(i) {
+				t.Errorf("result %d is the output of command %s", i, lines[1])
+			}
+		}
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		t.Parallel()
+		cmds := [][]string{{"true"}, {"false"}, {"echo", "done"}}
+
+		results, err := ExecCommandsBounded(context.TODO(), 10*time.Second, 3, cmds)
+		if err != nil {
+			t.Fatalf("ExecCommandsBounded() error = %v", err)
+		}
+		if results[0].Err != nil || results[1].Err == nil || results[2].Stdout != "done\n" {
+			t.Errorf("ExecCommandsBounded() unexpected results %+v", results)
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.TODO(), 150*time.Millisecond)
+		defer cancel()
+		cmds := make([][]string, 5)
+		for i := range cmds {
+			cmds[i] = []string{"sleep", "0.1"}
+		}
+
+		results, err := ExecCommandsBounded(ctx, 10*time.Second, 1, cmds)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("ExecCommandsBounded() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if results[0].Err != nil {
+			t.Errorf("command 0 failed: %v", results[0].Err)
+		}
+		if !errors.Is(results[len(results)-1].Err, context.DeadlineExceeded) {
+			t.Errorf("last command error = %v, want %v", results[len(results)-1].Err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		t.Parallel()
+		_, err := ExecCommandsBounded(context.TODO(), time.Second, 0, [][]string{{"true"}})
+		if err == nil {
+			t.Error("ExecCommandsBounded() should fail with concurrency 0")
+		}
+		_, err = ExecCommandsBounded(context.TODO(), time.Second, 1, [][]string{{"true"}, {}})
+		if err == nil {
+			t.Error("ExecCommandsBounded() should fail with an empty command")
+		}
+	})
+}
+
+func TestExecCommandWithEnv(t *testing.T) {
+	t.Parallel()
+
+	env := CephLogEnv("/var/log/ceph", "ceph-fuse-cluster-1")
+	want := "--log-to-file=true --log-file=/var/log/ceph/ceph-fuse-cluster-1.log\n"
+
+	stdout, _, err := ExecCommandWithEnv(context.TODO(), env, "sh", "-c", "echo \"$CEPH_ARGS\"")
+	if err != nil {
+		t.Fatalf("ExecCommandWithEnv() error = %v", err)
+	}
+	if stdout != want {
+		t.Errorf("ExecCommandWithEnv() got = %q, want %q", stdout, want)
+	}
+
+	// the environment of the process is kept
+	stdout, _, err = ExecCommandWithEnv(context.TODO(), env, "sh", "-c", "echo \"$PATH\"")
+	if err != nil {
+		t.Fatalf("ExecCommandWithEnv() error = %v", err)
+	}
+	if stdout != os.Getenv("PATH")+"\n" {
+		t.Errorf("ExecCommandWithEnv() got = %q, want %q", stdout, os.Getenv("PATH")+"\n")
+	}
+
+	if env := CephLogEnv("", "ceph-fuse-cluster-1"); env != nil {
+		t.Errorf("CephLogEnv() = %v, want nil without log directory", env)
+	}
+}
+
+func TestCommandPriorityArgs(t *testing.T) {
+	t.Parallel()
+
+	found := func(name string) (string, error) {
+		return "/usr/bin/" + name, nil
+	}
+	missing := func(name string) (string, error) {
+		return "", fmt.Errorf("%s: %w", name, exec.ErrNotFound)
+	}
+
+	tests := []struct {
+		name     string
+		prio     CommandPriority
+		goos     string
+		lookPath func(string) (string, error)
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "default priority",
+			goos:     "linux",
+			lookPath: found,
+		},
+		{
+			name:     "nice and best-effort IO",
+			prio:     CommandPriority{Nice: 10, IOClass: 2, IOLevel: 7},
+			goos:     "linux",
+			lookPath: found,
+			want:     []string{"/usr/bin/nice", "-n", "10", "/usr/bin/ionice", "-c", "2", "-n", "7"},
+		},
+		{
+			name:     "idle IO",
+			prio:     CommandPriority{IOClass: 3},
+			goos:     "linux",
+			lookPath: found,
+			want:     []string{"/usr/bin/ionice", "-c", "3"},
+		},
+		{
+			name:     "unsupported platform",
+			prio:     CommandPriority{Nice: 10, IOClass: 3},
+			goos:     "darwin",
+			lookPath: found,
+		},
+		{
+			name:     "missing executables",
+			prio:     CommandPriority{Nice: 10, IOClass: 3},
+			goos:     "linux",
+			lookPath: missing,
+		},
+		{
+			name:    "invalid nice",
+			prio:    CommandPriority{Nice: 20},
+			goos:    "linux",
+			wantErr: true,
+		},
+		{
+			name:    "invalid IO class",
+			prio:    CommandPriority{IOClass: 4},
+			goos:    "linux",
+			wantErr: true,
+		},
+		{
+			name:    "invalid IO level",
+			prio:    CommandPriority{IOClass: 2, IOLevel: 8},
+			goos:    "linux",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.prio.priorityArgs(context.TODO(), tt.goos, tt.lookPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("priorityArgs() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("priorityArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecCommandWithTimeoutAndPriority(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("command priorities are only supported on Linux")
+	}
+	if _, err := exec.LookPath("nice"); err != nil {
+		t.Skipf("nice is not available: %v", err)
+	}
+
+	// nice without arguments prints the niceness of the process
+	stdout, _, err := ExecCommandWithTimeout(context.TODO(), time.Second, "nice")
+	if err != nil {
+		t.Fatalf("ExecCommandWithTimeout() error = %v", err)
+	}
+	base, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		t.Fatalf("failed to parse niceness %q: %v", stdout, err)
+	}
+
+	stdout, _, err = ExecCommandWithTimeoutAndPriority(context.TODO(), time.Second,
+		CommandPriority{Nice: 5}, "nice")
+	if err != nil {
+		t.Fatalf("ExecCommandWithTimeoutAndPriority() error = %v", err)
+	}
+	got, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		t.Fatalf("failed to parse niceness %q: %v", stdout, err)
+	}
+	if want := min(base+5, 19); got != want {
+		t.Errorf("niceness of the command = %d, want %d", got, want)
+	}
+}
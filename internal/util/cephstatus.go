@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthOK is the status of a healthy Ceph cluster.
+	HealthOK = "HEALTH_OK"
+	// HealthWarn is the status of a Ceph cluster with warnings.
+	HealthWarn = "HEALTH_WARN"
+	// HealthErr is the status of a Ceph cluster with errors.
+	HealthErr = "HEALTH_ERR"
+
+	// allClustersHealthTimeout is the timeout of `ceph status` for each
+	// cluster in AllClustersHealth().
+	allClustersHealthTimeout = 30 * time.Second
+	// allClustersHealthConcurrency is the number of clusters that
+	// AllClustersHealth() checks at the same time.
+	allClustersHealthConcurrency = 4
+)
+
+// commandExecutor executes a command, like ExecCommandWithTimeout.
+type commandExecutor func(
+	ctx context.Context,
+	timeout time.Duration,
+	program string,
+	args ...string,
+) (string, string, error)
+
+// CephStatus contains the parts of `ceph status -f json` that are relevant
+// for checking the health of a Ceph cluster.
+type CephStatus struct {
+	FSID   string     `json:"fsid"`
+	Health CephHealth `json:"health"`
+	// QuorumNames contains the names of the monitors that are in quorum.
+	QuorumNames []string      `json:"quorum_names"`
+	MonMap      CephMonMap    `json:"monmap"`
+	OSDMap      CephOSDStatus `json:"osdmap"`
+}
+
+// CephHealth is the health status of a Ceph cluster, with the checks that
+// are failing.
+type CephHealth struct {
+	Status string                     `json:"status"`
+	Checks map[string]CephHealthCheck `json:"checks"`
+}
+
+// CephHealthCheck is a single failing health check.
+type CephHealthCheck struct {
+	Severity string                 `json:"severity"`
+	Summary  CephHealthCheckSummary `json:"summary"`
+}
+
+// CephHealthCheckSummary describes why a health check is failing.
+type CephHealthCheckSummary struct {
+	Message string `json:"message"`
+}
+
+// CephMonMap contains the number of monitors in the Ceph cluster.
+type CephMonMap struct {
+	NumMons int `json:"num_mons"`
+}
+
+// CephOSDStatus contains the number of OSDs, and how many of them are up
+// and in.
+type CephOSDStatus struct {
+	NumOSDs   int `json:"num_osds"`
+	NumUpOSDs int `json:"num_up_osds"`
+	NumInOSDs int `json:"num_in_osds"`
+}
+
+// parseCephStatus unmarshals the output of `ceph status -f json`.
+func parseCephStatus(output []byte) (*CephStatus, error) {
+	status := &CephStatus{}
+	err := json.Unmarshal(output, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ceph status %q: %w", string(output), err)
+	}
+
+	if status.Health.Status == "" {
+		return nil, fmt.Errorf("health status missing in ceph status %q", string(output))
+	}
+
+	return status, nil
+}
+
+// GetCephStatus runs `ceph status` against the cluster with the given
+// clusterID, and returns the parsed health, monitor quorum and OSD status.
+func GetCephStatus(
+	ctx context.Context,
+	timeout time.Duration,
+	clusterID string,
+	cr *Credentials,
+) (*CephStatus, error) {
+	return getCephStatus(ctx, timeout, CsiConfigFile, clusterID, cr, ExecCommandWithTimeout)
+}
+
+// getCephStatus implements GetCephStatus() for the cluster in the csi config
+// at pathToConfig, running `ceph status` with execute.
+func getCephStatus(
+	ctx context.Context,
+	timeout time.Duration,
+	pathToConfig, clusterID string,
+	cr *Credentials,
+	execute commandExecutor,
+) (*CephStatus, error) {
+	monitors, err := Mons(pathToConfig, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monitors for cluster ID %q: %w", clusterID, err)
+	}
+
+	confFile, err := GetEffectiveCephConfFile(pathToConfig, clusterID, monitors)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := execute(
+		ctx,
+		timeout,
+		"ceph",
+		"status",
+		"-m", monitors,
+		"--id", cr.ID,
+		"--keyfile="+cr.KeyFile,
+		"-c", confFile,
+		"-f", "json",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ceph status (%w): %s", err, stderr)
+	}
+
+	return parseCephStatus([]byte(stdout))
+}
+
+// AllClustersHealth runs `ceph status` against every cluster in the csi
+// config, with the credentials in creds for the cluster ID, and returns the
+// status per cluster ID. A few clusters are checked at the same time. When
+// the status of a cluster can not be fetched, the cluster ID maps to nil and
+// the other clusters are still checked. The returned error contains the
+// failures of all clusters, the map is only nil when the csi config could not
+// be read.
+func AllClustersHealth(
+	ctx context.Context,
+	pathToConfig string,
+	creds map[string]*Credentials,
+) (map[string]*CephStatus, error) {
+	return allClustersHealth(ctx, pathToConfig, creds, allClustersHealthConcurrency, ExecCommandWithTimeout)
+}
+
+// allClustersHealth implements AllClustersHealth(), checking at most
+// concurrency clusters at the same time with execute.
+func allClustersHealth(
+	ctx context.Context,
+	pathToConfig string,
+	creds map[string]*Credentials,
+	concurrency int,
+	execute commandExecutor,
+) (map[string]*CephStatus, error) {
+	clusterIDs, err := ListClusterIDs(pathToConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results = make([]*CephStatus, len(clusterIDs))
+		errs    = make([]error, len(clusterIDs))
+		slots   = make(chan struct{}, concurrency)
+		wg      sync.WaitGroup
+	)
+
+	for i, clusterID := range clusterIDs {
+		cr, ok := creds[clusterID]
+		if !ok || cr == nil {
+			errs[i] = fmt.Errorf("cluster ID %q: no credentials", clusterID)
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			errs[i] = fmt.Errorf("cluster ID %q: %w", clusterID, ctx.Err())
+
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			results[i], errs[i] = getCephStatus(ctx, allClustersHealthTimeout, pathToConfig, clusterID, cr, execute)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("cluster ID %q: %w", clusterID, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	statuses := make(map[string]*CephStatus, len(clusterIDs))
+	for i, clusterID := range clusterIDs {
+		statuses[clusterID] = results[i]
+	}
+
+	return statuses, errors.Join(errs...)
+}
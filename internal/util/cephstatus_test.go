@@ -0,0 +1,205 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+const cephStatusHealthOK = `{
+  "fsid": "ba68226a-672f-4ba5-97bc-22840318b2ec",
+  "health": {"status": "HEALTH_OK", "checks": {}, "mutes": []},
+  "election_epoch": 3,
+  "quorum": [0],
+  "quorum_names": ["a"],
+  "quorum_age": 5263,
+  "monmap": {"epoch": 1, "min_mon_release_name": "squid", "num_mons": 1},
+  "osdmap": {"epoch": 12, "num_osds": 3, "num_up_osds": 3, "osd_up_since": 1710243221,
+    "num_in_osds": 3, "osd_in_since": 1710243204, "num_remapped_pgs": 0}
+}`
+
+const cephStatusHealthWarn = `{
+  "fsid": "ba68226a-672f-4ba5-97bc-22840318b2ec",
+  "health": {
+    "status": "HEALTH_WARN",
+    "checks": {
+      "OSD_DOWN": {
+        "severity": "HEALTH_WARN",
+        "summary": {"message": "1 osds down", "count": 1},
+        "muted": false
+      },
+      "MON_DOWN": {
+        "severity": "HEALTH_WARN",
+        "summary": {"message": "1/3 mons down, quorum a,b", "count": 1},
+        "muted": false
+      }
+    },
+    "mutes": []
+  },
+  "election_epoch": 8,
+  "quorum": [0, 1],
+  "quorum_names": ["a", "b"],
+  "quorum_age": 12,
+  "monmap": {"epoch": 3, "min_mon_release_name": "squid", "num_mons": 3},
+  "osdmap": {"epoch": 31, "num_osds": 3, "num_up_osds": 2, "osd_up_since": 1710243221,
+    "num_in_osds": 3, "osd_in_since": 1710243204, "num_remapped_pgs": 0}
+}`
+
+func TestParseCephStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		output  string
+		want    *CephStatus
+		wantErr bool
+	}{
+		{
+			name:   "health ok",
+			output: cephStatusHealthOK,
+			want: &CephStatus{
+				FSID:        "ba68226a-672f-4ba5-97bc-22840318b2ec",
+				Health:      CephHealth{Status: HealthOK, Checks: map[string]CephHealthCheck{}},
+				QuorumNames: []string{"a"},
+				MonMap:      CephMonMap{NumMons: 1},
+				OSDMap:      CephOSDStatus{NumOSDs: 3, NumUpOSDs: 3, NumInOSDs: 3},
+			},
+		},
+		{
+			name:   "health warn",
+			output: cephStatusHealthWarn,
+			want: &CephStatus{
+				FSID: "ba68226a-672f-4ba5-97bc-22840318b2ec",
+				Health: CephHealth{
+					Status: HealthWarn,
+					Checks: map[string]CephHealthCheck{
+						"OSD_DOWN": {Severity: HealthWarn, Summary: CephHealthCheckSummary{Message: "1 osds down"}},
+						"MON_DOWN": {Severity: HealthWarn, Summary: CephHealthCheckSummary{Message: "1/3 mons down, quorum a,b"}},
+					},
+				},
+				QuorumNames: []string{"a", "b"},
+				MonMap:      CephMonMap{NumMons: 3},
+				OSDMap:      CephOSDStatus{NumOSDs: 3, NumUpOSDs: 2, NumInOSDs: 3},
+			},
+		},
+		{
+			name:    "invalid json",
+			output:  "Error initializing cluster client",
+			wantErr: true,
+		},
+		{
+			name:    "missing health",
+			output:  `{"fsid": "ba68226a-672f-4ba5-97bc-22840318b2ec"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseCephStatus([]byte(tt.output))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAllClustersHealth(t *testing.T) {
+	t.Parallel()
+
+	config := []cephcsi.ClusterInfo{
+		{ClusterID: "healthy", Monitors: []string{"mon-healthy:6789"}},
+		{ClusterID: "degraded", Monitors: []string{"mon-degraded:6789"}},
+		{ClusterID: "unreachable", Monitors: []string{"mon-unreachable:6789"}},
+		{ClusterID: "no-credentials", Monitors: []string{"mon-no-credentials:6789"}},
+		{
+			ClusterID:    "own-conf",
+			Monitors:     []string{"mon-own-conf:6789"},
+			CephConfFile: "/etc/ceph-own-conf/ceph.conf",
+		},
+	}
+	content, err := json.Marshal(config)
+	require.NoError(t, err)
+	pathToConfig := t.TempDir() + "/config.json"
+	require.NoError(t, os.WriteFile(pathToConfig, content, 0o600))
+
+	creds := map[string]*Credentials{
+		"healthy":     {ID: "admin", KeyFile: "/tmp/healthy.key"},
+		"degraded":    {ID: "admin", KeyFile: "/tmp/degraded.key"},
+		"unreachable": {ID: "admin", KeyFile: "/tmp/unreachable.key"},
+		"own-conf":    {ID: "admin", KeyFile: "/tmp/own-conf.key"},
+	}
+
+	var running, maxRunning atomic.Int32
+	execute := func(_ context.Context, _ time.Duration, _ string, args ...string) (string, string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := maxRunning.Load()
+			if n <= old || maxRunning.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		monitors := args[slices.Index(args, "-m")+1]
+		confFile := args[slices.Index(args, "-c")+1]
+		switch {
+		case monitors == "mon-healthy:6789" && confFile == CephConfigPath:
+			return cephStatusHealthOK, "", nil
+		case monitors == "mon-degraded:6789" && confFile == CephConfigPath:
+			return cephStatusHealthWarn, "", nil
+		case monitors == "mon-own-conf:6789" && confFile == "/etc/ceph-own-conf/ceph.conf":
+			return cephStatusHealthOK, "", nil
+		}
+
+		return "", "error connecting to the cluster", errors.New("exit status 1")
+	}
+
+	statuses, err := allClustersHealth(context.TODO(), pathToConfig, creds, 2, execute)
+	require.Error(t, err)
+	require.ErrorContains(t, err, `cluster ID "unreachable"`)
+	require.ErrorContains(t, err, `cluster ID "no-credentials"`)
+	require.NotContains(t, err.Error(), `cluster ID "healthy"`)
+
+	require.Len(t, statuses, len(config))
+	require.Equal(t, HealthOK, statuses["healthy"].Health.Status)
+	require.Equal(t, HealthWarn, statuses["degraded"].Health.Status)
+	require.Equal(t, HealthOK, statuses["own-conf"].Health.Status)
+	require.Nil(t, statuses["unreachable"])
+	require.Nil(t, statuses["no-credentials"])
+	require.LessOrEqual(t, maxRunning.Load(), int32(2))
+
+	_, err = allClustersHealth(context.TODO(), t.TempDir()+"/missing.json", creds, 2, execute)
+	require.Error(t, err)
+}
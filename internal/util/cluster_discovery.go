@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+// cephFSID is the output of `ceph fsid -f json`.
+type cephFSID struct {
+	FSID string `json:"fsid"`
+}
+
+// cephMonDump is the output of `ceph mon dump -f json`.
+type cephMonDump struct {
+	FSID string           `json:"fsid"`
+	Mons []cephMonDumpMon `json:"mons"`
+}
+
+// cephMonDumpMon is a monitor in the output of `ceph mon dump -f json`.
+type cephMonDumpMon struct {
+	Name        string `json:"name"`
+	PublicAddrs struct {
+		AddrVec []cephMonAddr `json:"addrvec"`
+	} `json:"public_addrs"`
+	// PublicAddr is the legacy v1 address in the format ip:port/nonce
+	PublicAddr string `json:"public_addr"`
+}
+
+// cephMonAddr is an address of a monitor, Type is "v1" or "v2".
+type cephMonAddr struct {
+	Type string `json:"type"`
+	Addr string `json:"addr"`
+}
+
+// monitorsFromMonDump returns the address of each monitor in the dump. The v1
+// address is preferred, as it is supported by all Ceph clients.
+func monitorsFromMonDump(dump *cephMonDump) ([]string, error) {
+	monitors := make([]string, 0, len(dump.Mons))
+	for _, mon := range dump.Mons {
+		addr := ""
+		for _, a := range mon.PublicAddrs.AddrVec {
+			if a.Type == "v1" || addr == "" {
+				addr = a.Addr
+			}
+		}
+
+		if addr == "" {
+			// strip the nonce from ip:port/nonce
+			addr, _, _ = strings.Cut(mon.PublicAddr, "/")
+		}
+
+		if addr == "" {
+			return nil, fmt.Errorf("no address found for monitor %q", mon.Name)
+		}
+
+		monitors = append(monitors, addr)
+	}
+
+	if len(monitors) == 0 {
+		return nil, errors.New("no monitors found in the monitor map")
+	}
+
+	return monitors, nil
+}
+
+// DiscoverClusterInfo connects to a Ceph cluster through the given monitors,
+// and returns the configuration of the cluster with the fsid as ClusterID and
+// all monitors of the cluster. This can be used to bootstrap the CSI config,
+// the monitors only need to contain a single reachable monitor.
+func DiscoverClusterInfo(
+	ctx context.Context,
+	timeout time.Duration,
+	monitors string,
+	cr *Credentials,
+) (*kubernetes.ClusterInfo, error) {
+	// a cluster that is already in the CSI config keeps its own ceph.conf
+	confFile, err := GetEffectiveCephConfFile(CsiConfigFile, "", monitors)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-m", monitors,
+		"--id", cr.ID,
+		"--keyfile=" + cr.KeyFile,
+		"-c", confFile,
+		"-f", "json",
+	}
+
+	fsid, err := ExecCommandJSON[cephFSID](ctx, timeout, "ceph", append([]string{"fsid"}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the fsid of the cluster: %w", err)
+	}
+
+	if fsid.FSID == "" {
+		return nil, errors.New("fsid missing in the output of ceph fsid")
+	}
+
+	dump, err := ExecCommandJSON[cephMonDump](ctx, timeout, "ceph", append([]string{"mon", "dump"}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the monitor map of the cluster: %w", err)
+	}
+
+	mons, err := monitorsFromMonDump(&dump)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubernetes.ClusterInfo{
+		ClusterID: fsid.FSID,
+		Monitors:  mons,
+	}, nil
+}
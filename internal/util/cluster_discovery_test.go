@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const cephMonDumpMsgr2 = `{
+  "epoch": 3,
+  "fsid": "ba68226a-672f-4ba5-97bc-22840318b2ec",
+  "modified": "2024-03-12T11:33:21.573913Z",
+  "created": "2024-03-12T11:32:02.216414Z",
+  "min_mon_release": 19,
+  "min_mon_release_name": "squid",
+  "quorum": [0, 1, 2],
+  "mons": [
+    {
+      "rank": 0,
+      "name": "a",
+      "public_addrs": {"addrvec": [
+        {"type": "v2", "addr": "10.0.0.1:3300", "nonce": 0},
+        {"type": "v1", "addr": "10.0.0.1:6789", "nonce": 0}
+      ]},
+      "addr": "10.0.0.1:6789/0",
+      "public_addr": "10.0.0.1:6789/0",
+      "priority": 0,
+      "weight": 0
+    },
+    {
+      "rank": 1,
+      "name": "b",
+      "public_addrs": {"addrvec": [
+        {"type": "v2", "addr": "10.0.0.2:3300", "nonce": 0},
+        {"type": "v1", "addr": "10.0.0.2:6789", "nonce": 0}
+      ]},
+      "addr": "10.0.0.2:6789/0",
+      "public_addr": "10.0.0.2:6789/0",
+      "priority": 0,
+      "weight": 0
+    },
+    {
+      "rank": 2,
+      "name": "c",
+      "public_addrs": {"addrvec": [
+        {"type": "v2", "addr": "10.0.0.3:3300", "nonce": 0}
+      ]},
+      "addr": "10.0.0.3:3300/0",
+      "public_addr": "10.0.0.3:3300/0",
+      "priority": 0,
+      "weight": 0
+    }
+  ]
+}`
+
+const cephMonDumpLegacy = `{
+  "epoch": 1,
+  "fsid": "ba68226a-672f-4ba5-97bc-22840318b2ec",
+  "quorum": [0],
+  "mons": [
+    {
+      "rank": 0,
+      "name": "a",
+      "addr": "192.168.39.10:6789/0",
+      "public_addr": "192.168.39.10:6789/0"
+    }
+  ]
+}`
+
+func TestMonitorsFromMonDump(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		dump    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "msgr2 monitors",
+			dump: cephMonDumpMsgr2,
+			want: []string{"10.0.0.1:6789", "10.0.0.2:6789", "10.0.0.3:3300"},
+		},
+		{
+			name: "legacy monitors",
+			dump: cephMonDumpLegacy,
+			want: []string{"192.168.39.10:6789"},
+		},
+		{
+			name:    "no monitors",
+			dump:    `{"epoch": 1, "fsid": "ba68226a-672f-4ba5-97bc-22840318b2ec", "mons": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "monitor without address",
+			dump:    `{"epoch": 1, "mons": [{"rank": 0, "name": "a"}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dump := cephMonDump{}
+			require.NoError(t, json.Unmarshal([]byte(tt.dump), &dump))
+
+			got, err := monitorsFromMonDump(&dump)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
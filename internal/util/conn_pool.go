@@ -17,18 +17,30 @@ limitations under the License.
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ceph/go-ceph/rados"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util/log"
 )
 
 type connEntry struct {
 	conn     *rados.Conn
 	lastUsed time.Time
 	users    int
+	// clusterID and monitorsHash identify the cluster of the connection,
+	// so that it can be destroyed when the monitors of the cluster change
+	clusterID    string
+	monitorsHash string
 }
 
 // ConnPool is the struct which contains details of connection entries in the pool and gc controlled params.
@@ -43,6 +55,8 @@ type ConnPool struct {
 	lock *sync.RWMutex
 	// all connEntry's in this pool
 	conns map[string]*connEntry
+	// GetMonitorsHash() of the monitors that were last used for a clusterID
+	monitorsHashes map[string]string
 }
 
 // NewConnPool creates a new connection pool instance and start the garbage collector running
@@ -53,6 +67,8 @@ func NewConnPool(interval, expiry time.Duration) *ConnPool {
 		expiry:   expiry,
 		lock:     &sync.RWMutex{},
 		conns:    make(map[string]*connEntry),
+
+		monitorsHashes: make(map[string]string),
 	}
 	cp.timer = time.AfterFunc(interval, cp.gc)
 
@@ -94,14 +110,14 @@ func (cp *ConnPool) Destroy() {
 	}
 }
 
-func (cp *ConnPool) generateUniqueKey(monitors, user, keyfile string) (string, error) {
+func (cp *ConnPool) generateUniqueKey(monitors, clusterID, user, keyfile string) (string, error) {
 	// the keyfile can be unique for operations, contents will be the same
 	key, err := os.ReadFile(keyfile) // #nosec:G304, file inclusion via variable.
 	if err != nil {
 		return "", fmt.Errorf("could not open keyfile %s: %w", keyfile, err)
 	}
 
-	return fmt.Sprintf("%s|%s|%s", monitors, user, string(key)), nil
+	return fmt.Sprintf("%s|%s|%s|%s", monitors, clusterID, user, string(key)), nil
 }
 
 // getExisting returns the existing rados.Conn associated with the unique key.
@@ -120,9 +136,18 @@ func (cp *ConnPool) getConn(unique string) *rados.Conn {
 
 // Get returns a rados.Conn for the given arguments. Creates a new rados.Conn in
 // case there is none. Use the returned rados.Conn to reduce the reference
-// count with ConnPool.Put(unique).
-func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
-	unique, err := cp.generateUniqueKey(monitors, user, keyfile)
+// count with ConnPool.Put(unique). The cephConfFile, cephLogDir and
+// readBalancing of the cluster with the clusterID in the CSI config are
+// applied to new connections. Without a clusterID, the cluster is looked up
+// by its monitors.
+func (cp *ConnPool) Get(clusterID, monitors, user, keyfile string) (*rados.Conn, error) {
+	return cp.get(CsiConfigFile, clusterID, monitors, user, keyfile)
+}
+
+// get implements Get, the cluster is read from the CSI config at
+// pathToConfig.
+func (cp *ConnPool) get(pathToConfig, clusterID, monitors, user, keyfile string) (*rados.Conn, error) {
+	unique, err := cp.generateUniqueKey(monitors, clusterID, user, keyfile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate unique for connection: %w", err)
 	}
@@ -134,6 +159,12 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 		return conn, nil
 	}
 
+	// the options of the cluster are only needed for a new connection
+	cluster := connClusterInfo(pathToConfig, clusterID, monitors)
+	if cluster != nil {
+		clusterID = cluster.ClusterID
+	}
+
 	// construct and connect a new rados.Conn
 	args := []string{"-m", monitors, "--keyfile=" + keyfile}
 	conn, err = rados.NewConnWithUser(user)
@@ -145,8 +176,22 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 		return nil, fmt.Errorf("parsing cmdline args (%v) failed: %w", args, err)
 	}
 
-	if err = conn.ReadConfigFile(CephConfigPath); err != nil {
-		return nil, fmt.Errorf("failed to read config file %q: %w", CephConfigPath, err)
+	confFile, err := connCephConfFile(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.ReadConfigFile(confFile); err != nil {
+		return nil, fmt.Errorf("failed to read config file %q: %w", confFile, err)
+	}
+
+	err = setConnLogFile(conn, cluster, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setConnReadBalancing(conn, cluster)
+	if err != nil {
+		return nil, err
 	}
 
 	err = conn.Connect()
@@ -155,9 +200,11 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 	}
 
 	ce := &connEntry{
-		conn:     conn,
-		lastUsed: time.Now(),
-		users:    1,
+		conn:         conn,
+		lastUsed:     time.Now(),
+		users:        1,
+		clusterID:    clusterID,
+		monitorsHash: GetMonitorsHash(monitors),
 	}
 
 	cp.lock.Lock()
@@ -174,6 +221,59 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 	return conn, nil
 }
 
+// GetByClusterID returns a rados.Conn for the user of the cluster with the
+// given clusterID in the CSI config at pathToConfig. When the monitors of the
+// cluster changed since the previous call, as detected by GetMonitorsHash(),
+// the unused connections to the cluster are destroyed. Use ConnPool.Put() to
+// release the returned rados.Conn.
+func (cp *ConnPool) GetByClusterID(pathToConfig, clusterID, user, keyfile string) (*rados.Conn, error) {
+	monitors, err := Mons(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	cp.updateClusterMonitors(clusterID, GetMonitorsHash(monitors))
+
+	return cp.get(pathToConfig, clusterID, monitors, user, keyfile)
+}
+
+// updateClusterMonitors records the GetMonitorsHash() of the monitors that
+// are used for the clusterID. In case the monitors changed, all unused
+// connections of the cluster to other monitors are destroyed. Connections
+// that are still in use are destroyed by the garbage collector once they
+// expired.
+func (cp *ConnPool) updateClusterMonitors(clusterID, monitorsHash string) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	previous, exists := cp.monitorsHashes[clusterID]
+	cp.monitorsHashes[clusterID] = monitorsHash
+	if exists && previous == monitorsHash {
+		return
+	}
+
+	for key, ce := range cp.conns {
+		if ce.users == 0 && ce.clusterID == clusterID && ce.monitorsHash != monitorsHash {
+			ce.destroy()
+			delete(cp.conns, key)
+		}
+	}
+}
+
+// GetMonitorsHash returns a hash of the comma separated list of monitors,
+// which does not depend on the order of the monitors.
+func GetMonitorsHash(monitors string) string {
+	mons := strings.Split(monitors, ",")
+	for i := range mons {
+		mons[i] = strings.TrimSpace(mons[i])
+	}
+	slices.Sort(mons)
+
+	sum := sha256.Sum256([]byte(strings.Join(mons, ",")))
+
+	return hex.EncodeToString(sum[:])
+}
+
 // Copy adds an extra reference count to the used ConnEntry and returns the
 // *rados.Conn if it was found.
 func (cp *ConnPool) Copy(conn *rados.Conn) *rados.Conn {
@@ -227,3 +327,98 @@ func (ce *connEntry) destroy() {
 		ce.conn = nil
 	}
 }
+
+// connClusterInfo returns the configuration of the cluster for a new
+// connection, or nil when the cluster is not in the CSI config at
+// pathToConfig. The CSI config is optional for connections, so errors are
+// only logged. When clusterID is empty, the first cluster that lists one of
+// the monitors is returned.
+func connClusterInfo(pathToConfig, clusterID, monitors string) *kubernetes.ClusterInfo {
+	if clusterID != "" {
+		cluster, err := readClusterInfo(pathToConfig, clusterID)
+		if err != nil {
+			log.WarningLogMsg("connecting to cluster ID %q without options from the CSI config: %v",
+				clusterID, err)
+
+			return nil
+		}
+
+		return cluster
+	}
+
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		log.DebugLogMsg("connecting to %q without options from the CSI config: %v", monitors, err)
+
+		return nil
+	}
+
+	for _, mon := range strings.Split(monitors, ",") {
+		for i := range config {
+			// monitors from Mons() can have the msgr2 port added
+			if slices.Contains(config[i].Monitors, mon) ||
+				slices.Contains(preferredMonitors(&config[i], config[i].Monitors), mon) {
+				return &config[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// connCephConfFile returns the ceph.conf for a connection to the cluster.
+// That is the cephConfFile of the cluster, or CephConfigPath when the cluster
+// has none or is nil.
+func connCephConfFile(cluster *kubernetes.ClusterInfo) (string, error) {
+	if cluster == nil {
+		return CephConfigPath, nil
+	}
+
+	confFile, err := checkCephConfFile(cluster, validateCephConfFile.Load())
+	if err != nil {
+		return "", err
+	}
+	if confFile == "" {
+		return CephConfigPath, nil
+	}
+
+	return confFile, nil
+}
+
+// setConnLogFile configures the connection to write its log to the cephLogDir
+// of the cluster. Nothing is changed when the cluster is nil or has no
+// cephLogDir.
+func setConnLogFile(conn *rados.Conn, cluster *kubernetes.ClusterInfo, user string) error {
+	if cluster == nil || cluster.LogDir == "" {
+		return nil
+	}
+
+	logFile := filepath.Join(cluster.LogDir, "ceph-client."+user+".log")
+	err := conn.SetConfigOption("log_file", logFile)
+	if err != nil {
+		return fmt.Errorf("failed to set log_file for the connection to cluster ID %q: %w", cluster.ClusterID, err)
+	}
+
+	err = conn.SetConfigOption("log_to_file", "true")
+	if err != nil {
+		return fmt.Errorf("failed to set log_to_file for the connection to cluster ID %q: %w", cluster.ClusterID, err)
+	}
+
+	return nil
+}
+
+// setConnReadBalancing configures the connection to balance the reads of
+// librbd over the replicas, in case readBalancing is enabled for the cluster.
+func setConnReadBalancing(conn *rados.Conn, cluster *kubernetes.ClusterInfo) error {
+	if cluster == nil || !cluster.ReadBalancing {
+		return nil
+	}
+
+	err := conn.SetConfigOption("rbd_read_from_replica_policy", "balance")
+	if err != nil {
+		return fmt.Errorf("failed to set rbd_read_from_replica_policy for the connection to cluster ID %q: %w",
+			cluster.ClusterID, err)
+	}
+
+	return nil
+}
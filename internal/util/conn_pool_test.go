@@ -17,11 +17,15 @@ limitations under the License.
 package util
 
 import (
+	"encoding/json"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ceph/go-ceph/rados"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
 )
 
 const (
@@ -33,8 +37,8 @@ const (
 // working Ceph cluster to connect to.
 //
 // This is mostly a copy of ConnPool.Get().
-func (cp *ConnPool) fakeGet(monitors, user, keyfile string) (*rados.Conn, string, error) {
-	unique, err := cp.generateUniqueKey(monitors, user, keyfile)
+func (cp *ConnPool) fakeGet(clusterID, monitors, user, keyfile string) (*rados.Conn, string, error) {
+	unique, err := cp.generateUniqueKey(monitors, clusterID, user, keyfile)
 	if err != nil {
 		return nil, "", err
 	}
@@ -54,9 +58,11 @@ func (cp *ConnPool) fakeGet(monitors, user, keyfile string) (*rados.Conn, string
 	}
 
 	ce := &connEntry{
-		conn:     conn,
-		lastUsed: time.Now(),
-		users:    1,
+		conn:         conn,
+		lastUsed:     time.Now(),
+		users:        1,
+		clusterID:    clusterID,
+		monitorsHash: GetMonitorsHash(monitors),
 	}
 
 	cp.lock.Lock()
@@ -92,7 +98,7 @@ func TestConnPool(t *testing.T) {
 	var unique string
 
 	t.Run("fakeGet", func(t *testing.T) {
-		conn, unique, err = cp.fakeGet("monitors", "user", keyfile)
+		conn, unique, err = cp.fakeGet("", "monitors", "user", keyfile)
 		if err != nil {
 			t.Errorf("failed to get connection: %v", err)
 		}
@@ -116,7 +122,7 @@ func TestConnPool(t *testing.T) {
 
 	t.Run("doubleFakeGet", func(t *testing.T) {
 		// after a 2nd get, there should still be a single conn in cp.conns
-		_, _, err = cp.fakeGet("monitors", "user", keyfile)
+		_, _, err = cp.fakeGet("", "monitors", "user", keyfile)
 		if err != nil {
 			t.Errorf("failed to get connection: %v", err)
 		}
@@ -177,3 +183,183 @@ func TestConnPool(t *testing.T) {
 		}
 	})
 }
+
+//nolint:paralleltest // these tests cannot run in parallel
+func TestConnPoolClusterMonitors(t *testing.T) {
+	cp := NewConnPool(interval, expiry)
+	defer cp.Destroy()
+
+	keyfile := t.TempDir() + "/conn_utils.keyfile"
+	err := os.WriteFile(keyfile, []byte("the-key"), 0o600)
+	if err != nil {
+		t.Errorf("failed to create keyfile: %v", err)
+
+		return
+	}
+
+	t.Run("concurrentFakeGet", func(t *testing.T) {
+		const users = 10
+		conns := make(chan *rados.Conn, users)
+		var wg sync.WaitGroup
+		for range users {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, _, getErr := cp.fakeGet("cluster-1", "mon1,mon2", "user", keyfile)
+				if getErr != nil {
+					t.Errorf("failed to get connection: %v", getErr)
+				}
+				conns <- conn
+			}()
+		}
+		wg.Wait()
+		close(conns)
+
+		// all users should share a single connection
+		if len(cp.conns) != 1 {
+			t.Errorf("there is more than a single conn in cp.conns: %v", len(cp.conns))
+		}
+		for _, ce := range cp.conns {
+			if ce.users != users {
+				t.Errorf("there should be %d users: %v", users, ce.users)
+			}
+		}
+		for conn := range conns {
+			cp.Put(conn)
+		}
+	})
+
+	t.Run("reuseWithUnchangedMonitors", func(t *testing.T) {
+		cp.updateClusterMonitors("cluster-1", GetMonitorsHash("mon1,mon2"))
+		cp.updateClusterMonitors("cluster-1", GetMonitorsHash("mon2,mon1"))
+		if len(cp.conns) != 1 {
+			t.Errorf("unchanged monitors should not remove the conn: %v", len(cp.conns))
+		}
+	})
+
+	t.Run("evictOnMonitorsChange", func(t *testing.T) {
+		// a connection that is in use, should not be removed
+		conn, _, err := cp.fakeGet("cluster-1", "mon1,mon2", "other-user", keyfile)
+		if err != nil {
+			t.Errorf("failed to get connection: %v", err)
+		}
+		// an unused connection of another cluster, should not be removed
+		other, _, err := cp.fakeGet("cluster-2", "mon1,mon2", "user", keyfile)
+		if err != nil {
+			t.Errorf("failed to get connection: %v", err)
+		}
+		cp.Put(other)
+		if len(cp.conns) != 3 {
+			t.Errorf("there should be three conns in cp.conns: %v", len(cp.conns))
+		}
+
+		cp.updateClusterMonitors("cluster-1", GetMonitorsHash("mon3,mon4"))
+		if len(cp.conns) != 2 {
+			t.Errorf("the unused conn of cluster-1 should have been removed: %v", len(cp.conns))
+		}
+		for _, ce := range cp.conns {
+			if ce.clusterID == "cluster-1" && ce.users == 0 {
+				t.Errorf("the unused conn of cluster-1 was not removed")
+			}
+		}
+
+		cp.Put(conn)
+	})
+}
+
+func TestGetMonitorsHash(t *testing.T) {
+	t.Parallel()
+
+	hash := GetMonitorsHash("10.0.0.1:6789,10.0.0.2:6789")
+	if GetMonitorsHash("10.0.0.2:6789, 10.0.0.1:6789") != hash {
+		t.Error("GetMonitorsHash() should not depend on the order of the monitors")
+	}
+	if GetMonitorsHash("10.0.0.1:6789,10.0.0.3:6789") == hash {
+		t.Error("GetMonitorsHash() should change when the monitors change")
+	}
+}
+
+func TestConnClusterInfo(t *testing.T) {
+	t.Parallel()
+
+	clusters := []kubernetes.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+			RBD:       kubernetes.RBD{RadosNamespace: "ns-1"},
+			LogDir:    "/var/log/cluster-1",
+		},
+		{
+			ClusterID:   "cluster-2",
+			Monitors:    []string{"10.1.0.1"},
+			PreferMsgr2: true,
+		},
+	}
+	data, err := json.Marshal(clusters)
+	if err != nil {
+		t.Fatalf("failed to marshal CSI config: %v", err)
+	}
+	pathToConfig := t.TempDir() + "/config.json"
+	err = os.WriteFile(pathToConfig, data, 0o600)
+	if err != nil {
+		t.Fatalf("failed to write CSI config: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		clusterID     string
+		monitors      string
+		wantClusterID string
+	}{
+		{"by clusterID", "cluster-2", "10.0.0.1:6789", "cluster-2"},
+		{"unknown clusterID", "cluster-3", "10.0.0.1:6789", ""},
+		{"monitors with radosNamespace", "", "10.0.0.2:6789", "cluster-1"},
+		{"monitors with msgr2 port", "", "10.1.0.1:3300", "cluster-2"},
+		{"unknown monitors", "", "10.2.0.1:6789", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cluster := connClusterInfo(pathToConfig, tt.clusterID, tt.monitors)
+			clusterID := ""
+			if cluster != nil {
+				clusterID = cluster.ClusterID
+			}
+			if clusterID != tt.wantClusterID {
+				t.Errorf("connClusterInfo() ClusterID = %q, want %q", clusterID, tt.wantClusterID)
+			}
+		})
+	}
+
+	t.Run("missing CSI config", func(t *testing.T) {
+		t.Parallel()
+
+		cluster := connClusterInfo(t.TempDir()+"/missing.json", "", "10.0.0.1:6789")
+		if cluster != nil {
+			t.Errorf("connClusterInfo() = %v, want nil", cluster)
+		}
+	})
+}
+
+func TestConnCephConfFile(t *testing.T) {
+	t.Parallel()
+
+	confFile, err := connCephConfFile(nil)
+	if err != nil || confFile != CephConfigPath {
+		t.Errorf("connCephConfFile(nil) = %q, %v, want %q", confFile, err, CephConfigPath)
+	}
+
+	confFile, err = connCephConfFile(&kubernetes.ClusterInfo{ClusterID: "cluster-1"})
+	if err != nil || confFile != CephConfigPath {
+		t.Errorf("connCephConfFile() without cephConfFile = %q, %v, want %q", confFile, err, CephConfigPath)
+	}
+
+	confFile, err = connCephConfFile(&kubernetes.ClusterInfo{
+		ClusterID:    "cluster-1",
+		CephConfFile: "/etc/ceph-cluster-1/ceph.conf",
+	})
+	if err != nil || confFile != "/etc/ceph-cluster-1/ceph.conf" {
+		t.Errorf("connCephConfFile() = %q, %v, want %q", confFile, err, "/etc/ceph-cluster-1/ceph.conf")
+	}
+}
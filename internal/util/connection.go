@@ -48,9 +48,11 @@ var (
 )
 
 // rbdVol.Connect() connects to the Ceph cluster and sets rbdVol.conn for further usage.
-func (cc *ClusterConnection) Connect(monitors string, cr *Credentials) error {
+// The clusterID selects the options from the CSI config for the connection,
+// it can be empty for callers that only know the monitors.
+func (cc *ClusterConnection) Connect(clusterID, monitors string, cr *Credentials) error {
 	if cc.conn == nil {
-		conn, err := connPool.Get(monitors, cr.ID, cr.KeyFile)
+		conn, err := connPool.Get(clusterID, monitors, cr.ID, cr.KeyFile)
 		if err != nil {
 			return fmt.Errorf("failed to get connection: %w", err)
 		}
@@ -20,6 +20,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 const (
@@ -33,6 +37,10 @@ const (
 	migUserName          = "admin"
 	migUserID            = "adminId"
 	migUserKey           = "key"
+
+	// AuthModeCephx authenticates the Ceph clients with cephx keys. It is
+	// the only supported authMode, all Ceph clients require a keyfile.
+	AuthModeCephx = "cephx"
 )
 
 // Credentials struct represents credentials to access the ceph cluster.
@@ -97,6 +105,32 @@ func newCredentialsFromSecret(idField, keyField string, secrets map[string]strin
 	return c, err
 }
 
+// NewCredentialsFromSecret creates new credentials from the Data of a
+// Kubernetes Secret. userKey and keyKey are the names of the entries with
+// the ID and the key of the user, both need to be set and not empty.
+func NewCredentialsFromSecret(secret *corev1.Secret, userKey, keyKey string) (*Credentials, error) {
+	if secret == nil || len(secret.Data) == 0 {
+		return nil, errors.New("provided secret is empty")
+	}
+
+	id := string(secret.Data[userKey])
+	if id == "" {
+		return nil, fmt.Errorf("missing ID field '%s' in secret %s/%s", userKey, secret.Namespace, secret.Name)
+	}
+
+	key := string(secret.Data[keyKey])
+	if key == "" {
+		return nil, fmt.Errorf("missing key field '%s' in secret %s/%s", keyKey, secret.Namespace, secret.Name)
+	}
+
+	keyFile, err := storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{ID: id, KeyFile: keyFile}, nil
+}
+
 // DeleteCredentials removes the KeyFile.
 func (cr *Credentials) DeleteCredentials() {
 	// don't complain about unhandled error
@@ -172,3 +206,76 @@ func NewUserCredentialsWithMigration(secrets map[string]string) (*Credentials, e
 
 	return cr, nil
 }
+
+// NewCredentialsFromConfig creates the credentials for the driver ("rbd",
+// "cephfs" or "nfs") to access the cluster with the given clusterID. The user
+// is the clientID of the driver in the config, or the userID from the secrets
+// when the config does not set a clientID. The key of the user is taken from
+// the userKey in the secrets, which therefore needs to belong to the same
+// user.
+func NewCredentialsFromConfig(
+	pathToConfig, clusterID, driver string,
+	secrets map[string]string,
+) (*Credentials, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, key, err := credentialsFromConfig(cluster, driver, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials for cluster ID %q: %w", clusterID, err)
+	}
+
+	keyFile, err := storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{ID: id, KeyFile: keyFile}, nil
+}
+
+// credentialsFromConfig returns the user and key for the driver.
+func credentialsFromConfig(
+	cluster *kubernetes.ClusterInfo,
+	driver string,
+	secrets map[string]string,
+) (string, string, error) {
+	var id string
+	switch driver {
+	case "rbd":
+		id = cluster.RBD.ClientID
+	case "cephfs":
+		id = cluster.CephFS.ClientID
+	case "nfs":
+		id = cluster.NFS.ClientID
+	default:
+		return "", "", fmt.Errorf("unknown driver %q", driver)
+	}
+
+	switch cluster.AuthMode {
+	case "", AuthModeCephx:
+	default:
+		return "", "", fmt.Errorf("unsupported authMode %q, only %q is supported", cluster.AuthMode, AuthModeCephx)
+	}
+
+	userID := secrets[credUserID]
+	switch {
+	case id == "" && userID == "":
+		return "", "", fmt.Errorf("missing ID field '%s' in secrets, and no clientID for %s in config",
+			credUserID, driver)
+	case id == "":
+		id = userID
+	case userID != "" && userID != id:
+		// the key in the secrets is the key of the userID
+		return "", "", fmt.Errorf("clientID %q for %s in config does not match ID field '%s' %q in secrets",
+			id, driver, credUserID, userID)
+	}
+
+	key := secrets[credUserKey]
+	if key == "" {
+		return "", "", fmt.Errorf("missing key field '%s' in secrets", credUserKey)
+	}
+
+	return id, key, nil
+}
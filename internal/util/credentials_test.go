@@ -16,8 +16,15 @@ limitations under the License.
 package util
 
 import (
+	"encoding/json"
+	"os"
 	"reflect"
 	"testing"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestIsMigrationSecret(t *testing.T) {
@@ -96,3 +103,213 @@ func TestParseAndSetSecretMapFromMigSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	secrets := map[string]string{
+		"userID":  "csi-user",
+		"userKey": "QVFBOFF2SlZheUJQRVJBQWgvS2cwT1laQUhPQno3akZwekxxdGc9PQ==",
+	}
+
+	tests := []struct {
+		name    string
+		cluster kubernetes.ClusterInfo
+		driver  string
+		secrets map[string]string
+		wantID  string
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name:    "cephx with user from secrets",
+			cluster: kubernetes.ClusterInfo{},
+			driver:  "rbd",
+			secrets: secrets,
+			wantID:  "csi-user",
+			wantKey: secrets["userKey"],
+		},
+		{
+			name: "cephx with clientID from config",
+			cluster: kubernetes.ClusterInfo{
+				AuthMode: AuthModeCephx,
+				CephFS:   kubernetes.CephFS{ClientID: "csi-cephfs"},
+			},
+			driver:  "cephfs",
+			secrets: map[string]string{"userKey": secrets["userKey"]},
+			wantID:  "csi-cephfs",
+			wantKey: secrets["userKey"],
+		},
+		{
+			name:    "cephx without key",
+			cluster: kubernetes.ClusterInfo{},
+			driver:  "nfs",
+			secrets: map[string]string{"userID": "csi-user"},
+			wantErr: true,
+		},
+		{
+			name:    "cephx without user",
+			cluster: kubernetes.ClusterInfo{},
+			driver:  "rbd",
+			secrets: map[string]string{"userKey": secrets["userKey"]},
+			wantErr: true,
+		},
+		{
+			name: "clientID from config with key of the same user",
+			cluster: kubernetes.ClusterInfo{
+				RBD: kubernetes.RBD{ClientID: "csi-user"},
+			},
+			driver:  "rbd",
+			secrets: secrets,
+			wantID:  "csi-user",
+			wantKey: secrets["userKey"],
+		},
+		{
+			name: "clientID from config with key of another user",
+			cluster: kubernetes.ClusterInfo{
+				NFS: kubernetes.NFS{ClientID: "csi-nfs"},
+			},
+			driver:  "nfs",
+			secrets: secrets,
+			wantErr: true,
+		},
+		{
+			name:    "none is not supported",
+			cluster: kubernetes.ClusterInfo{AuthMode: "none"},
+			driver:  "rbd",
+			secrets: secrets,
+			wantErr: true,
+		},
+		{
+			name:    "unknown authMode",
+			cluster: kubernetes.ClusterInfo{AuthMode: "kerberos"},
+			driver:  "rbd",
+			secrets: secrets,
+			wantErr: true,
+		},
+		{
+			name:    "unknown driver",
+			cluster: kubernetes.ClusterInfo{},
+			driver:  "iscsi",
+			secrets: secrets,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			id, key, err := credentialsFromConfig(&tt.cluster, tt.driver, tt.secrets)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("credentialsFromConfig() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if id != tt.wantID || key != tt.wantKey {
+				t.Errorf("credentialsFromConfig() = (%q, %q), want (%q, %q)", id, key, tt.wantID, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestNewCredentialsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []kubernetes.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       kubernetes.RBD{ClientID: "csi-rbd"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	err = os.MkdirAll(tmpKeyFileLocation, 0o700)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", tmpKeyFileLocation, err)
+	}
+
+	secrets := map[string]string{"userKey": "QVFBOFF2SlZheUJQRVJBQWgvS2cwT1laQUhPQno3akZwekxxdGc9PQ=="}
+	cr, err := NewCredentialsFromConfig(tmpConfPath, "cluster-1", "rbd", secrets)
+	if err != nil {
+		t.Fatalf("NewCredentialsFromConfig() error = %v", err)
+	}
+	defer cr.DeleteCredentials()
+	if cr.ID != "csi-rbd" {
+		t.Errorf("NewCredentialsFromConfig() ID = %q, want %q", cr.ID, "csi-rbd")
+	}
+	key, err := os.ReadFile(cr.KeyFile)
+	if err != nil {
+		t.Fatalf("failed to read KeyFile: %v", err)
+	}
+	if string(key) != secrets["userKey"] {
+		t.Errorf("KeyFile contains %q, want %q", key, secrets["userKey"])
+	}
+
+	_, err = NewCredentialsFromConfig(tmpConfPath, "cluster-1", "rbd", nil)
+	if err == nil {
+		t.Error("NewCredentialsFromConfig() should fail without a key")
+	}
+
+	_, err = NewCredentialsFromConfig(tmpConfPath, "cluster-2", "rbd", secrets)
+	if err == nil {
+		t.Error("NewCredentialsFromConfig() should fail for an unknown cluster")
+	}
+}
+
+func TestNewCredentialsFromSecret(t *testing.T) {
+	t.Parallel()
+
+	err := os.MkdirAll(tmpKeyFileLocation, 0o700)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", tmpKeyFileLocation, err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-rbd-secret", Namespace: "ceph-csi"},
+		Data: map[string][]byte{
+			"userID":  []byte("csi-rbd"),
+			"userKey": []byte("AQDSKdJhAAAAABAA0Zhc5lEd2Ic2bO3fqH2hvw=="),
+		},
+	}
+	cr, err := NewCredentialsFromSecret(secret, "userID", "userKey")
+	if err != nil {
+		t.Fatalf("NewCredentialsFromSecret() error = %v", err)
+	}
+	defer cr.DeleteCredentials()
+	if cr.ID != "csi-rbd" {
+		t.Errorf("NewCredentialsFromSecret() ID = %q, want %q", cr.ID, "csi-rbd")
+	}
+	key, err := os.ReadFile(cr.KeyFile)
+	if err != nil {
+		t.Fatalf("failed to read KeyFile: %v", err)
+	}
+	if string(key) != string(secret.Data["userKey"]) {
+		t.Errorf("KeyFile contains %q, want %q", key, secret.Data["userKey"])
+	}
+
+	tests := []struct {
+		name   string
+		secret *corev1.Secret
+	}{
+		{"nil secret", nil},
+		{"empty secret", &corev1.Secret{}},
+		{"missing key", &corev1.Secret{Data: map[string][]byte{"userID": []byte("csi-rbd")}}},
+		{"missing user", &corev1.Secret{Data: map[string][]byte{"userKey": []byte("key")}}},
+		{"empty key", &corev1.Secret{Data: map[string][]byte{"userID": []byte("csi-rbd"), "userKey": {}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := NewCredentialsFromSecret(tt.secret, "userID", "userKey"); err == nil {
+				t.Error("NewCredentialsFromSecret() should fail")
+			}
+		})
+	}
+}
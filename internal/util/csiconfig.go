@@ -17,13 +17,27 @@ limitations under the License.
 package util
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/sys/unix"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -31,114 +45,1111 @@ const (
 	// This was hardcoded once and defaults to the old value to keep backward compatibility.
 	defaultCsiSubvolumeGroup = "csi"
 
-	// defaultCsiCephFSRadosNamespace defines the default RADOS namespace used for storing
-	// CSI-specific objects and keys for CephFS volumes.
-	defaultCsiCephFSRadosNamespace = "csi"
+	// defaultCsiCephFSRadosNamespace defines the default RADOS namespace used for storing
+	// CSI-specific objects and keys for CephFS volumes.
+	defaultCsiCephFSRadosNamespace = "csi"
+
+	// CsiConfigFile is the location of the CSI config file.
+	CsiConfigFile = "/etc/ceph-csi-config/config.json"
+
+	// ClusterIDKey is the name of the key containing clusterID.
+	ClusterIDKey = "clusterID"
+
+	// DefaultRBDMaxCloneDepth is the number of nested clones after which an
+	// RBD image is flattened, when the CSI config does not set it.
+	DefaultRBDMaxCloneDepth = 8
+
+	// InMemoryCSIConfig can be passed instead of the path to the CSI config
+	// file, to use the clusters that were registered with
+	// SetInMemoryCSIConfig().
+	InMemoryCSIConfig = "in-memory://csi-config"
+)
+
+var (
+	inMemoryConfigLock sync.RWMutex
+	// inMemoryConfig contains the clusters registered with
+	// SetInMemoryCSIConfig, nil when none are registered.
+	inMemoryConfig *csiConfig
+
+	defaultClusterLock sync.RWMutex
+	// defaultCluster is the configuration that is used for clusterIDs that
+	// are missing from the CSI config, when defaultClusterFallback is set.
+	defaultCluster         *kubernetes.ClusterInfo
+	defaultClusterFallback bool
+)
+
+// SetDefaultClusterInfo registers cluster as the configuration for clusterIDs
+// that are missing from the CSI config. It is only used once the fallback is
+// enabled with SetDefaultClusterFallback(). The cluster is copied, passing
+// nil removes the registered default.
+func SetDefaultClusterInfo(cluster *kubernetes.ClusterInfo) {
+	defaultClusterLock.Lock()
+	defer defaultClusterLock.Unlock()
+
+	if cluster == nil {
+		defaultCluster = nil
+
+		return
+	}
+
+	copied := cluster.DeepCopy()
+	defaultCluster = &copied
+}
+
+// SetDefaultClusterFallback enables the use of the cluster that was
+// registered with SetDefaultClusterInfo() for clusterIDs that are missing
+// from the CSI config. The fallback is disabled by default, so that a
+// missing clusterID is reported as an error instead of masking a
+// misconfiguration.
+func SetDefaultClusterFallback(enabled bool) {
+	defaultClusterLock.Lock()
+	defer defaultClusterLock.Unlock()
+
+	defaultClusterFallback = enabled
+}
+
+// getDefaultClusterInfo returns a copy of the default cluster with the given
+// clusterID, or nil when the fallback is disabled or no default is
+// registered.
+func getDefaultClusterInfo(clusterID string) *kubernetes.ClusterInfo {
+	defaultClusterLock.RLock()
+	defer defaultClusterLock.RUnlock()
+
+	if !defaultClusterFallback || defaultCluster == nil {
+		return nil
+	}
+
+	cluster := defaultCluster.DeepCopy()
+	cluster.ClusterID = clusterID
+
+	return &cluster
+}
+
+// SetInMemoryCSIConfig registers clusters as the CSI config that is used when
+// InMemoryCSIConfig is passed as the path to the config. This allows using
+// ceph-csi without a config file on disk, for example when it is embedded in
+// another program. The clusters are copied, later modifications of the passed
+// slice have no effect. Passing nil removes the registered config.
+func SetInMemoryCSIConfig(clusters []kubernetes.ClusterInfo) {
+	inMemoryConfigLock.Lock()
+	defer inMemoryConfigLock.Unlock()
+
+	if clusters == nil {
+		inMemoryConfig = nil
+
+		return
+	}
+
+	inMemoryConfig = newCSIConfig(copyClusters(clusters))
+}
+
+// readInMemoryCSIConfig returns the registered in-memory config.
+func readInMemoryCSIConfig() (*csiConfig, error) {
+	inMemoryConfigLock.RLock()
+	defer inMemoryConfigLock.RUnlock()
+
+	if inMemoryConfig == nil {
+		return nil, errors.New("no in-memory CSI config registered")
+	}
+
+	return inMemoryConfig, nil
+}
+
+// csiConfig is a parsed CSI config. It is shared by the readers of the
+// config, and must not be modified.
+type csiConfig struct {
+	clusters []kubernetes.ClusterInfo
+	// byID contains the first cluster of every clusterID in clusters
+	byID map[string]*kubernetes.ClusterInfo
+}
+
+// newCSIConfig returns a csiConfig with the clusters indexed by clusterID.
+func newCSIConfig(clusters []kubernetes.ClusterInfo) *csiConfig {
+	config := &csiConfig{
+		clusters: clusters,
+		byID:     make(map[string]*kubernetes.ClusterInfo, len(clusters)),
+	}
+	for i := range clusters {
+		if _, ok := config.byID[clusters[i].ClusterID]; !ok {
+			config.byID[clusters[i].ClusterID] = &clusters[i]
+		}
+	}
+
+	return config
+}
+
+// copyClusters returns a deep copy of clusters, nil when clusters is nil.
+func copyClusters(clusters []kubernetes.ClusterInfo) []kubernetes.ClusterInfo {
+	if clusters == nil {
+		return nil
+	}
+
+	copied := make([]kubernetes.ClusterInfo, len(clusters))
+	for i := range clusters {
+		copied[i] = clusters[i].DeepCopy()
+	}
+
+	return copied
+}
+
+// Expected JSON structure in the passed in config file is the following, the
+// same structure can be written in YAML instead,
+//nolint:godot // example json content should not contain unwanted dot.
+/*
+[{
+	"clusterID": "<cluster-id>",
+	"rbd": {
+		"radosNamespace": "<rados-namespace>"
+		"mirrorDaemonCount": 1
+	},
+	"monitors": [
+		"<monitor-value>",
+		"<monitor-value>"
+	],
+	"cephFS": {
+		"subvolumeGroup": "<subvolumegroup for cephfs volumes>"
+	}
+}]
+*/
+// The returned clusters are shared with the cache of the config, and must
+// not be modified.
+func readCSIConfig(pathToConfig string) ([]kubernetes.ClusterInfo, error) {
+	config, err := loadCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.clusters, nil
+}
+
+// loadCSIConfig returns the parsed CSI config at pathToConfig. The config is
+// taken from the cache when pathToConfig is watched, and parsed from the file
+// otherwise.
+func loadCSIConfig(pathToConfig string) (*csiConfig, error) {
+	if pathToConfig == InMemoryCSIConfig {
+		return readInMemoryCSIConfig()
+	}
+
+	config, generation, cached := getCachedCSIConfig(pathToConfig)
+	if cached {
+		return config, nil
+	}
+
+	// #nosec
+	content, err := os.ReadFile(pathToConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := ParseCSIConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal failed (%w), raw buffer response: %s",
+			err, string(content))
+	}
+	config = newCSIConfig(clusters)
+	setCachedCSIConfig(pathToConfig, generation, config)
+
+	return config, nil
+}
+
+// csiConfigToJSON returns the contents of a CSI configuration file as JSON.
+// Contents that start with a JSON array or object are returned unmodified,
+// other contents are converted from YAML. The strict conversion rejects YAML
+// with duplicate keys.
+func csiConfigToJSON(content []byte, strict bool) ([]byte, error) {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 || trimmed[0] == '[' || trimmed[0] == '{' {
+		return content, nil
+	}
+
+	convert := yaml.YAMLToJSON
+	if strict {
+		convert = yaml.YAMLToJSONStrict
+	}
+
+	converted, err := convert(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert YAML to JSON: %w", err)
+	}
+
+	return converted, nil
+}
+
+// ParseCSIConfig parses the contents of a CSI configuration file, in JSON or
+// YAML format. Keys that do not match a field of kubernetes.ClusterInfo are
+// ignored, so that configurations written for newer versions can still be
+// read.
+func ParseCSIConfig(content []byte) ([]kubernetes.ClusterInfo, error) {
+	var config []kubernetes.ClusterInfo
+
+	content, err := csiConfigToJSON(content, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ParseCSIConfigStrict parses the contents of a CSI configuration file like
+// ParseCSIConfig, but returns an error for keys that do not match a field of
+// kubernetes.ClusterInfo. This surfaces typos like "monitorss", which would
+// otherwise result in a cluster without monitors.
+func ParseCSIConfigStrict(content []byte) ([]kubernetes.ClusterInfo, error) {
+	var config []kubernetes.ClusterInfo
+
+	content, err := csiConfigToJSON(content, true)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	// json.Unmarshal rejects trailing data, the Decoder needs to check it
+	if _, err = dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid data after the CSI configuration")
+	}
+
+	// DisallowUnknownFields() does not apply to the sections that implement
+	// json.Unmarshaler, like kubernetes.RBD, check all keys again
+	var raw []any
+	err = json.Unmarshal(content, &raw)
+	if err != nil {
+		return nil, err
+	}
+	clusterType := reflect.TypeFor[kubernetes.ClusterInfo]()
+	for i := range raw {
+		err = checkUnknownKeys(raw[i], clusterType, "")
+		if err != nil {
+			return nil, fmt.Errorf("cluster %d: %w", i, err)
+		}
+	}
+
+	return config, nil
+}
+
+// checkUnknownKeys returns an error for the first key of the JSON value that
+// does not match a field of typ, recursing into nested objects and arrays.
+// Like encoding/json, the keys are matched case-insensitively.
+func checkUnknownKeys(value any, typ reflect.Type, path string) error {
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return checkUnknownKeys(value, typ.Elem(), path)
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			return nil
+		}
+		for i := range items {
+			err := checkUnknownKeys(items[i], typ.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if path != "" {
+			path += "."
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			field, found := jsonField(typ, key)
+			if !found {
+				return fmt.Errorf("unknown field %q", path+key)
+			}
+			err := checkUnknownKeys(object[key], field.Type, path+key)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+	}
+
+	return nil
+}
+
+// jsonField returns the exported field of the struct typ that has the JSON
+// name key.
+func jsonField(typ reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// readClusterInfo returns the configuration of the cluster with the given
+// clusterID. It is shared with the cache of the config, and must not be
+// modified.
+func readClusterInfo(pathToConfig, clusterID string) (*kubernetes.ClusterInfo, error) {
+	config, err := loadCSIConfig(pathToConfig)
+	if err != nil {
+		err = fmt.Errorf("error fetching configuration for cluster ID %q: %w", clusterID, err)
+
+		return nil, err
+	}
+
+	if cluster, ok := config.byID[clusterID]; ok {
+		return cluster, nil
+	}
+
+	if cluster := getDefaultClusterInfo(clusterID); cluster != nil {
+		log.WarningLogMsg("missing configuration for cluster ID %q, using the default cluster configuration",
+			clusterID)
+
+		return cluster, nil
+	}
+
+	return nil, fmt.Errorf("missing configuration for cluster ID %q", clusterID)
+}
+
+// GetClusterInfo returns a copy of the configuration of the cluster with the
+// given clusterID.
+func GetClusterInfo(pathToConfig, clusterID string) (*kubernetes.ClusterInfo, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	copied := cluster.DeepCopy()
+
+	return &copied, nil
+}
+
+// LoadCSIConfigMap reads the CSI config and returns the configuration of the
+// clusters keyed by their clusterID, for lookups of many clusters without
+// reading the config again. An error is returned when a clusterID is used
+// more than once.
+func LoadCSIConfigMap(pathToConfig string) (map[string]kubernetes.ClusterInfo, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration: %w", err)
+	}
+
+	clusters := make(map[string]kubernetes.ClusterInfo, len(config))
+	for i := range config {
+		clusterID := config[i].ClusterID
+		if _, ok := clusters[clusterID]; ok {
+			return nil, fmt.Errorf("duplicate configuration for cluster ID %q", clusterID)
+		}
+		clusters[clusterID] = config[i].DeepCopy()
+	}
+
+	return clusters, nil
+}
+
+// Mons returns a comma separated MON list from the csi config for the given clusterID.
+func Mons(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(cluster.Monitors) == 0 {
+		return "", fmt.Errorf("empty monitor list for cluster ID (%s) in config", clusterID)
+	}
+
+	return strings.Join(preferredMonitors(cluster, cluster.Monitors), ","), nil
+}
+
+// preferredMonitors returns mons, which are monitors of the cluster, with the
+// msgr2 port added when the cluster sets preferMsgr2.
+func preferredMonitors(cluster *kubernetes.ClusterInfo, mons []string) []string {
+	if cluster.PreferMsgr2 {
+		return NormalizeMonitors(mons, true)
+	}
+
+	return mons
+}
+
+// MonsOrdered returns a comma separated MON list from the csi config for the
+// given clusterID, sorted by the monitorPriorities. Monitors without a
+// priority are listed after the prioritized ones, in their original order.
+func MonsOrdered(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(cluster.Monitors) == 0 {
+		return "", fmt.Errorf("empty monitor list for cluster ID (%s) in config", clusterID)
+	}
+
+	mons := slices.Clone(cluster.Monitors)
+	slices.SortStableFunc(mons, func(a, b string) int {
+		prioA, okA := cluster.MonitorPriorities[a]
+		prioB, okB := cluster.MonitorPriorities[b]
+		switch {
+		case okA && okB:
+			return prioA - prioB
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+
+		return 0
+	})
+
+	return strings.Join(preferredMonitors(cluster, mons), ","), nil
+}
+
+// MonsForClusters returns the comma separated monitors of each of the given
+// clusterIDs like Mons, reading the config only once. When clusters are missing from
+// the config, or have no monitors, the monitors of the other clusters are
+// returned together with an error that lists the missing clusterIDs.
+func MonsForClusters(pathToConfig string, clusterIDs []string) (map[string]string, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration for cluster IDs %v: %w", clusterIDs, err)
+	}
+
+	mons := make(map[string]string, len(clusterIDs))
+	for i := range config {
+		if len(config[i].Monitors) != 0 && slices.Contains(clusterIDs, config[i].ClusterID) {
+			mons[config[i].ClusterID] = strings.Join(preferredMonitors(&config[i], config[i].Monitors), ",")
+		}
+	}
+
+	var missing []string
+	for _, clusterID := range clusterIDs {
+		if _, ok := mons[clusterID]; !ok && !slices.Contains(missing, clusterID) {
+			missing = append(missing, clusterID)
+		}
+	}
+
+	if len(missing) != 0 {
+		return mons, fmt.Errorf("missing monitors in configuration for cluster IDs %q", missing)
+	}
+
+	return mons, nil
+}
+
+// GetClusterInfoFromMonitors returns the configuration of the cluster that
+// contains one of the comma separated monitors. This is used for legacy
+// volumes that have the monitors encoded in their volume handle, instead of
+// a clusterID. As the same monitors can be configured for different
+// clusterIDs with different RBD radosNamespaces, and legacy volumes do not
+// use a radosNamespace, clusters with a radosNamespace are skipped.
+// In case no cluster matches, a ClusterInfo with only the given monitors and
+// an empty ClusterID is returned.
+func GetClusterInfoFromMonitors(pathToConfig, monitors string) (*kubernetes.ClusterInfo, error) {
+	if monitors == "" {
+		return nil, errors.New("empty monitor list")
+	}
+	mons := strings.Split(monitors, ",")
+
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration for monitors %q: %w", monitors, err)
+	}
+
+	for i := range config {
+		if config[i].RBD.RadosNamespace != "" {
+			continue
+		}
+
+		for _, mon := range mons {
+			if slices.Contains(config[i].Monitors, mon) {
+				return &config[i], nil
+			}
+		}
+	}
+
+	return &kubernetes.ClusterInfo{Monitors: mons}, nil
+}
+
+// GetClusterInfoByVolumeID returns the configuration of the cluster that is
+// encoded in the CSI volume handle (a VolumeId or SnapshotId).
+func GetClusterInfoByVolumeID(pathToConfig, volumeID string) (*kubernetes.ClusterInfo, error) {
+	var vi CSIIdentifier
+	err := vi.DecomposeCSIID(volumeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode volume handle %q: %w", volumeID, err)
+	}
+
+	return readClusterInfo(pathToConfig, vi.ClusterID)
+}
+
+// GetClusterName returns the friendly name of the given clusterID, to be
+// used in logs and events. It returns the clusterID when no name is set.
+func GetClusterName(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if cluster.Name == "" {
+		return clusterID, nil
+	}
+
+	return cluster.Name, nil
+}
+
+// GetClusterNamespace returns the Kubernetes namespace that contains the
+// secrets for the given clusterID. It returns an empty string when the
+// namespace is not configured, in which case the namespace of the driver
+// should be used.
+func GetClusterNamespace(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	return cluster.Namespace, nil
+}
+
+// IsClusterReadOnly returns true when all volumes of the given clusterID
+// should be published read-only, like for a cluster in a disaster recovery
+// posture.
+func IsClusterReadOnly(pathToConfig, clusterID string) (bool, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return false, err
+	}
+
+	return bool(cluster.ReadOnly), nil
+}
+
+// GetClusterLogLevel returns the log verbosity for operations on the given
+// clusterID. When the cluster does not set a log level, the verbosity of the
+// driver is returned. A log level of 0 in the config is returned as is.
+func GetClusterLogLevel(pathToConfig, clusterID string) (int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	if cluster.LogLevel == nil {
+		return int(log.Verbosity()), nil
+	}
+
+	return int(*cluster.LogLevel), nil
+}
+
+// GetClusterLogDir returns the `cephLogDir` for the Ceph clients of the given
+// clusterID. It returns an empty string when the log directory is not
+// configured.
+func GetClusterLogDir(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	return cluster.LogDir, nil
+}
+
+// validateCephConfFile makes GetCephConfFile check that the configured file
+// exists. It is read by concurrent operations, hence atomic.
+var validateCephConfFile atomic.Bool
+
+// SetCephConfFileValidation configures whether GetCephConfFile reports a
+// cephConfFile that does not exist as an error.
+func SetCephConfFileValidation(enabled bool) {
+	validateCephConfFile.Store(enabled)
+}
+
+// GetCephConfFile returns the `cephConfFile` of the given clusterID, which is
+// the path to the ceph.conf that the Ceph clients use instead of the
+// generated one. It returns an empty string when no file is configured.
+func GetCephConfFile(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	return checkCephConfFile(cluster, validateCephConfFile.Load())
+}
+
+// GetEffectiveCephConfFile returns the ceph.conf to pass with `-c` to the
+// Ceph CLI tools for the given clusterID, or for the cluster with one of the
+// monitors when clusterID is empty. This is the same file that connections
+// from the pool use: the `cephConfFile` of the cluster, or CephConfigPath
+// when none is configured or the cluster is not in the CSI config.
+func GetEffectiveCephConfFile(pathToConfig, clusterID, monitors string) (string, error) {
+	return connCephConfFile(connClusterInfo(pathToConfig, clusterID, monitors))
+}
+
+// checkCephConfFile returns the expanded cephConfFile of the cluster. When
+// validate is set, the file needs to exist.
+func checkCephConfFile(cluster *kubernetes.ClusterInfo, validate bool) (string, error) {
+	if cluster.CephConfFile == "" {
+		return "", nil
+	}
+
+	confFile, err := expandConfigPath(cluster.CephConfFile)
+	if err != nil {
+		return "", err
+	}
+
+	if validate {
+		info, err := os.Stat(confFile)
+		if err != nil {
+			return "", fmt.Errorf("invalid cephConfFile for cluster ID %q: %w", cluster.ClusterID, err)
+		}
+		if info.IsDir() {
+			return "", fmt.Errorf("invalid cephConfFile for cluster ID %q: %q is a directory",
+				cluster.ClusterID, confFile)
+		}
+	}
+
+	return confFile, nil
+}
+
+// GetRBDRadosNamespace returns the namespace for the given clusterID.
+func GetRBDRadosNamespace(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	return cluster.RBD.RadosNamespace, nil
+}
+
+// GetCephFSRadosNamespace returns the namespace for the given clusterID.
+// If not set, it returns the default value "csi".
+func GetCephFSRadosNamespace(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if cluster.CephFS.RadosNamespace == "" {
+		return defaultCsiCephFSRadosNamespace, nil
+	}
+
+	return cluster.CephFS.RadosNamespace, nil
+}
+
+// GetRBDMirrorDaemonCount returns the number of mirror daemon count for the
+// given clusterID. It returns the default of 1, which is the most common in a
+// cluster, when the count is not set. An error is returned when the
+// configured count is less than 1.
+func GetRBDMirrorDaemonCount(pathToConfig, clusterID string) (int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !cluster.RBD.HasMirrorDaemonCount() {
+		return 1, nil
+	}
+
+	count := cluster.RBD.MirrorDaemonCount
+	if count < 1 {
+		return 0, fmt.Errorf("invalid rbd.mirrorDaemonCount %d for cluster ID %q, it must be 1 or more",
+			count, clusterID)
+	}
+
+	return count, nil
+}
+
+// ListClusterIDs returns the IDs of all clusters in the csi config, in the
+// order of the configuration. Duplicate cluster IDs are only returned once.
+func ListClusterIDs(pathToConfig string) ([]string, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration: %w", err)
+	}
+
+	clusterIDs := make([]string, 0, len(config))
+	for i := range config {
+		if !slices.Contains(clusterIDs, config[i].ClusterID) {
+			clusterIDs = append(clusterIDs, config[i].ClusterID)
+		}
+	}
+
+	return clusterIDs, nil
+}
+
+// ListMirroringClusters returns the clusterIDs of the clusters that set the
+// `rbd.mirrorDaemonCount`, in the order of the config. Clusters that do not
+// set it, or set an invalid count, do not run RBD mirroring.
+func ListMirroringClusters(pathToConfig string) ([]string, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration: %w", err)
+	}
+
+	var clusters []string
+	for i := range config {
+		if config[i].RBD.MirrorDaemonCount > 0 {
+			clusters = append(clusters, config[i].ClusterID)
+		}
+	}
+
+	return clusters, nil
+}
 
-	// CsiConfigFile is the location of the CSI config file.
-	CsiConfigFile = "/etc/ceph-csi-config/config.json"
+// GetRBDMapOptions returns the `rbd.mapOptions` for RBD volumes of the given
+// clusterID. The StorageClass mapOptions parameter is merged with, and takes
+// precedence over, these options.
+func GetRBDMapOptions(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
 
-	// ClusterIDKey is the name of the key containing clusterID.
-	ClusterIDKey = "clusterID"
-)
+	return cluster.RBD.MapOptions, nil
+}
 
-// Expected JSON structure in the passed in config file is,
-//nolint:godot // example json content should not contain unwanted dot.
-/*
-[{
-	"clusterID": "<cluster-id>",
-	"rbd": {
-		"radosNamespace": "<rados-namespace>"
-		"mirrorDaemonCount": 1
-	},
-	"monitors": [
-		"<monitor-value>",
-		"<monitor-value>"
-	],
-	"cephFS": {
-		"subvolumeGroup": "<subvolumegroup for cephfs volumes>"
+// GetRBDUnmapOptions returns the `rbd.unmapOptions` for RBD volumes of the
+// given clusterID. The StorageClass unmapOptions parameter is merged with, and
+// takes precedence over, these options.
+func GetRBDUnmapOptions(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
 	}
-}]
-*/
-func readClusterInfo(pathToConfig, clusterID string) (*kubernetes.ClusterInfo, error) {
-	var config []kubernetes.ClusterInfo
 
-	// #nosec
-	content, err := os.ReadFile(pathToConfig)
+	return cluster.RBD.UnmapOptions, nil
+}
+
+// GetRBDImageFeatures returns the `rbd.defaultImageFeatures` for the given
+// clusterID. It returns an empty string when the default image features are
+// not configured.
+func GetRBDImageFeatures(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
-		err = fmt.Errorf("error fetching configuration for cluster ID %q: %w", clusterID, err)
+		return "", err
+	}
 
-		return nil, err
+	return cluster.RBD.DefaultImageFeatures, nil
+}
+
+// GetRBDMounter returns the `rbd.mounter` for the given clusterID. It returns
+// an empty string when the mounter is not configured. The value "nbd" is
+// accepted as an alias for "rbd-nbd".
+func GetRBDMounter(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
 	}
 
-	err = json.Unmarshal(content, &config)
+	switch cluster.RBD.Mounter {
+	case "", "rbd", "rbd-nbd":
+		return cluster.RBD.Mounter, nil
+	case "nbd":
+		return "rbd-nbd", nil
+	}
+
+	return "", fmt.Errorf("invalid rbd mounter %q for cluster ID %q", cluster.RBD.Mounter, clusterID)
+}
+
+// GetRBDClientID returns the `rbd.clientID` for the given clusterID. It
+// returns an empty string when it is not set, in which case the user from
+// the secrets should be used.
+func GetRBDClientID(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal failed (%w), raw buffer response: %s",
-			err, string(content))
+		return "", err
 	}
 
-	for i := range config {
-		if config[i].ClusterID == clusterID {
-			return &config[i], nil
-		}
+	return cluster.RBD.ClientID, nil
+}
+
+// GetRBDMetadataPool returns the `rbd.metadataPool` for the given clusterID.
+// It returns an empty string when it is not set, in which case the CSI OMAP
+// objects are stored in the pool of the image.
+func GetRBDMetadataPool(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
 	}
 
-	return nil, fmt.Errorf("missing configuration for cluster ID %q", clusterID)
+	return cluster.RBD.MetadataPool, nil
 }
 
-// Mons returns a comma separated MON list from the csi config for the given clusterID.
-func Mons(pathToConfig, clusterID string) (string, error) {
+// GetCephFSClientID returns the `cephFS.clientID` for the given clusterID. It
+// returns an empty string when it is not set, in which case the user from
+// the secrets should be used.
+func GetCephFSClientID(pathToConfig, clusterID string) (string, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
 		return "", err
 	}
 
-	if len(cluster.Monitors) == 0 {
-		return "", fmt.Errorf("empty monitor list for cluster ID (%s) in config", clusterID)
+	return cluster.CephFS.ClientID, nil
+}
+
+// GetRBDMaxSnapshotsPerVolume returns the `rbd.maxSnapshotsPerVolume` for the
+// given clusterID. It returns 0 when the number of snapshots is unlimited.
+// The limit is configured per driver, so there is an accessor for each driver
+// instead of a single GetMaxSnapshotsPerVolume.
+func GetRBDMaxSnapshotsPerVolume(pathToConfig, clusterID string) (int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
 	}
 
-	return strings.Join(cluster.Monitors, ","), nil
+	return validateMaxSnapshotsPerVolume(int(cluster.RBD.MaxSnapshotsPerVolume), "rbd", clusterID)
 }
 
-// GetRBDRadosNamespace returns the namespace for the given clusterID.
-func GetRBDRadosNamespace(pathToConfig, clusterID string) (string, error) {
+// GetRBDMaxCloneDepth returns the `rbd.maxCloneDepth` for the given
+// clusterID, or DefaultRBDMaxCloneDepth when it is not set.
+func GetRBDMaxCloneDepth(pathToConfig, clusterID string) (int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	depth := int(cluster.RBD.MaxCloneDepth)
+	switch {
+	case depth == 0:
+		return DefaultRBDMaxCloneDepth, nil
+	case depth < 0:
+		return 0, fmt.Errorf("invalid rbd.maxCloneDepth %d for cluster ID %q, it must be positive",
+			depth, clusterID)
+	}
+
+	return depth, nil
+}
+
+// GetRBDStripeConfig returns the `rbd.stripeUnit` and `rbd.stripeCount` for
+// the given clusterID. It returns (0, 0) when striping is not configured. An
+// error is returned when only one of the fields is set, or when the stripe
+// unit is not a power of two.
+func GetRBDStripeConfig(pathToConfig, clusterID string) (int, int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	unit := int(cluster.RBD.StripeUnit)
+	count := int(cluster.RBD.StripeCount)
+	switch {
+	case unit == 0 && count == 0:
+		return 0, 0, nil
+	case unit <= 0 || count <= 0:
+		return 0, 0, fmt.Errorf("invalid rbd.stripeUnit %d and rbd.stripeCount %d for cluster ID %q, "+
+			"both must be set to a positive value", unit, count, clusterID)
+	case unit&(unit-1) != 0:
+		return 0, 0, fmt.Errorf("invalid rbd.stripeUnit %d for cluster ID %q, it must be a power of two",
+			unit, clusterID)
+	}
+
+	return unit, count, nil
+}
+
+// GetCephFSMaxSnapshotsPerVolume returns the `cephFS.maxSnapshotsPerVolume`
+// for the given clusterID. It returns 0 when the number of snapshots is
+// unlimited.
+func GetCephFSMaxSnapshotsPerVolume(pathToConfig, clusterID string) (int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	return validateMaxSnapshotsPerVolume(int(cluster.CephFS.MaxSnapshotsPerVolume), "cephFS", clusterID)
+}
+
+// GetCephFSSnapshotRetention returns the `cephFS.snapshotRetentionCount` for
+// the given clusterID. Snapshots of a volume beyond this count can be pruned,
+// starting with the oldest. It returns 0 when all snapshots are retained.
+func GetCephFSSnapshotRetention(pathToConfig, clusterID string) (int, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	count := int(cluster.CephFS.SnapshotRetentionCount)
+	if count < 0 {
+		return 0, fmt.Errorf("invalid cephFS.snapshotRetentionCount %d for cluster ID %q, it must not be negative",
+			count, clusterID)
+	}
+
+	return count, nil
+}
+
+// GetCephFSForceKernelClient returns the `cephFS.forceKernelClient` for the
+// given clusterID. When true, CephFS volumes must not be mounted with the
+// FUSE client.
+func GetCephFSForceKernelClient(pathToConfig, clusterID string) (bool, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return false, err
+	}
+
+	return bool(cluster.CephFS.ForceKernelClient), nil
+}
+
+func validateMaxSnapshotsPerVolume(maxSnapshots int, driver, clusterID string) (int, error) {
+	if maxSnapshots < 0 {
+		return 0, fmt.Errorf("invalid %s.maxSnapshotsPerVolume %d for cluster ID %q, it must not be negative",
+			driver, maxSnapshots, clusterID)
+	}
+
+	return maxSnapshots, nil
+}
+
+// GetCephFSFsName returns the `cephFS.fsName` for the given clusterID. It
+// returns an empty string when it is not set, in which case the filesystem
+// from the StorageClass should be used.
+func GetCephFSFsName(pathToConfig, clusterID string) (string, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
 		return "", err
 	}
 
-	return cluster.RBD.RadosNamespace, nil
+	return cluster.CephFS.FsName, nil
 }
 
-// GetCephFSRadosNamespace returns the namespace for the given clusterID.
-// If not set, it returns the default value "csi".
-func GetCephFSRadosNamespace(pathToConfig, clusterID string) (string, error) {
+// GetNFSClientID returns the `nfs.clientID` for the given clusterID. It
+// returns an empty string when it is not set, in which case the user from
+// the secrets should be used.
+func GetNFSClientID(pathToConfig, clusterID string) (string, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
 		return "", err
 	}
 
-	if cluster.CephFS.RadosNamespace == "" {
-		return defaultCsiCephFSRadosNamespace, nil
+	return cluster.NFS.ClientID, nil
+}
+
+// NFSExportOptions are the options for new NFS exports of a cluster.
+type NFSExportOptions struct {
+	// Squash is the user-id squashing, one of "none", "root", "rootid" or
+	// "all"
+	Squash string
+	// AccessType is "RW" or "RO"
+	AccessType string
+	// Clients that may access the export, all clients when empty
+	Clients []string
+}
+
+// GetNFSExportOptions returns the `nfs.squash`, `nfs.accessType` and
+// `nfs.clients` for the given clusterID. When not set, the squash mode is
+// "none", the access type is "RW" and all clients can access the exports.
+func GetNFSExportOptions(pathToConfig, clusterID string) (*NFSExportOptions, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
 	}
 
-	return cluster.CephFS.RadosNamespace, nil
+	opts := &NFSExportOptions{
+		Squash:     strings.ToLower(cluster.NFS.Squash),
+		AccessType: strings.ToUpper(cluster.NFS.AccessType),
+		Clients:    slices.Clone(cluster.NFS.Clients),
+	}
+
+	switch opts.Squash {
+	case "":
+		opts.Squash = "none"
+	case "none", "root", "rootid", "all":
+	default:
+		return nil, fmt.Errorf("invalid nfs.squash %q for cluster ID %q, valid options are "+
+			"\"none\", \"root\", \"rootid\" and \"all\"", cluster.NFS.Squash, clusterID)
+	}
+
+	switch opts.AccessType {
+	case "":
+		opts.AccessType = "RW"
+	case "RW", "RO":
+	default:
+		return nil, fmt.Errorf("invalid nfs.accessType %q for cluster ID %q, valid options are "+
+			"\"RW\" and \"RO\"", cluster.NFS.AccessType, clusterID)
+	}
+
+	return opts, nil
 }
 
-// GetRBDMirrorDaemonCount returns the number of mirror daemon count for the
-// given clusterID.
-func GetRBDMirrorDaemonCount(pathToConfig, clusterID string) (int, error) {
+// GetTopologyConstrainedPools returns the `rbd.topologyConstrainedPools` for
+// the given clusterID. It returns nil when no pools are configured.
+func GetTopologyConstrainedPools(pathToConfig, clusterID string) ([]TopologyConstrainedPool, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	// if it is empty, set the default to 1 which is most common in a cluster.
-	if cluster.RBD.MirrorDaemonCount == 0 {
-		return 1, nil
+	if len(cluster.RBD.TopologyConstrainedPools) == 0 {
+		return nil, nil
+	}
+
+	pools := make([]TopologyConstrainedPool, 0, len(cluster.RBD.TopologyConstrainedPools))
+	for _, pool := range cluster.RBD.TopologyConstrainedPools {
+		segments := make([]topologySegment, 0, len(pool.DomainSegments))
+		for _, segment := range pool.DomainSegments {
+			segments = append(segments, topologySegment{
+				DomainLabel: segment.DomainLabel,
+				DomainValue: segment.DomainValue,
+			})
+		}
+
+		pools = append(pools, TopologyConstrainedPool{
+			PoolName:       pool.PoolName,
+			DataPoolName:   pool.DataPoolName,
+			DomainSegments: segments,
+		})
+	}
+
+	return pools, nil
+}
+
+// ResolveRBDPool returns the pool for an RBD volume in the given clusterID.
+// The pool from the StorageClass takes precedence, then the first of the
+// `rbd.topologyConstrainedPools` that matches the nodeTopology, and last the
+// `rbd.defaultPool`. The keys of nodeTopology can be prefixed like the
+// topology segments of the driver. An error is returned when none of them
+// resolves to a pool.
+func ResolveRBDPool(pathToConfig, clusterID, scPool string, nodeTopology map[string]string) (string, error) {
+	if scPool != "" {
+		return scPool, nil
+	}
+
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(nodeTopology) != 0 {
+		pools, err := GetTopologyConstrainedPools(pathToConfig, clusterID)
+		if err != nil {
+			return "", err
+		}
+
+		if len(pools) != 0 {
+			pool := matchPoolToTopology(&pools, &csi.Topology{Segments: nodeTopology})
+			if pool.PoolName != "" {
+				return pool.PoolName, nil
+			}
+		}
+	}
+
+	if cluster.RBD.DefaultPool != "" {
+		return cluster.RBD.DefaultPool, nil
 	}
 
-	return cluster.RBD.MirrorDaemonCount, nil
+	return "", fmt.Errorf("no pool for cluster ID %q: the StorageClass does not set a pool, "+
+		"no topology constrained pool matches %v and rbd.defaultPool is not set", clusterID, nodeTopology)
 }
 
 // CephFSSubvolumeGroup returns the subvolumeGroup for CephFS volumes. If not set, it returns the default value "csi".
@@ -185,13 +1196,64 @@ func GetClusterID(options map[string]string) (string, error) {
 	return clusterID, nil
 }
 
+var (
+	// expandConfigPaths enables the expansion of environment variables in
+	// the path-type fields of the CSI config.
+	expandConfigPaths bool
+	// strictConfigPaths makes the expansion fail for unset variables.
+	strictConfigPaths bool
+)
+
+// SetConfigPathExpansion configures the expansion of environment variable
+// references (like $KUBELET_DIR or ${KUBELET_DIR}) in the path-type fields of
+// the CSI config, such as netNamespaceFilePath. When strict is set, references
+// to unset variables are reported as an error, otherwise they expand to an
+// empty string. Setting strict enables the expansion as well.
+func SetConfigPathExpansion(enabled, strict bool) {
+	expandConfigPaths = enabled || strict
+	strictConfigPaths = strict
+}
+
+// ExpandConfigPath replaces the references to environment variables in path
+// with their values. In strict mode an error listing the unset variables is
+// returned.
+func ExpandConfigPath(path string, strict bool) (string, error) {
+	var unset []string
+	expanded := os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && !slices.Contains(unset, name) {
+			unset = append(unset, name)
+		}
+
+		return value
+	})
+
+	if strict && len(unset) != 0 {
+		return "", fmt.Errorf("path %q references unset environment variables: %s",
+			path, strings.Join(unset, ", "))
+	}
+
+	return expanded, nil
+}
+
+// expandConfigPath expands path with ExpandConfigPath when the expansion of
+// config paths is enabled, otherwise path is returned unmodified.
+func expandConfigPath(path string) (string, error) {
+	if !expandConfigPaths {
+		return path, nil
+	}
+
+	return ExpandConfigPath(path, strictConfigPaths)
+}
+
+// GetRBDNetNamespaceFilePath returns the netNamespaceFilePath for RBD volumes.
 func GetRBDNetNamespaceFilePath(pathToConfig, clusterID string) (string, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
 	if err != nil {
 		return "", err
 	}
 
-	return cluster.RBD.NetNamespaceFilePath, nil
+	return expandConfigPath(cluster.RBD.NetNamespaceFilePath)
 }
 
 // GetCephFSNetNamespaceFilePath returns the netNamespaceFilePath for CephFS volumes.
@@ -201,7 +1263,7 @@ func GetCephFSNetNamespaceFilePath(pathToConfig, clusterID string) (string, erro
 		return "", err
 	}
 
-	return cluster.CephFS.NetNamespaceFilePath, nil
+	return expandConfigPath(cluster.CephFS.NetNamespaceFilePath)
 }
 
 // GetNFSNetNamespaceFilePath returns the netNamespaceFilePath for NFS volumes.
@@ -211,7 +1273,40 @@ func GetNFSNetNamespaceFilePath(pathToConfig, clusterID string) (string, error)
 		return "", err
 	}
 
-	return cluster.NFS.NetNamespaceFilePath, nil
+	return expandConfigPath(cluster.NFS.NetNamespaceFilePath)
+}
+
+// ValidateNetNamespaceFilePath checks that the given netNamespaceFilePath, as
+// returned by the Get*NetNamespaceFilePath functions, points to an existing
+// network namespace. An empty path is not validated, as it means that no
+// network namespace is configured.
+func ValidateNetNamespaceFilePath(netNamespaceFilePath string) error {
+	if netNamespaceFilePath == "" {
+		return nil
+	}
+
+	var fs unix.Statfs_t
+	err := unix.Statfs(netNamespaceFilePath, &fs)
+	if err != nil {
+		return fmt.Errorf("failed to stat netNamespaceFilePath %q: %w", netNamespaceFilePath, err)
+	}
+
+	if fs.Type != unix.NSFS_MAGIC {
+		return fmt.Errorf("netNamespaceFilePath %q is not a network namespace file", netNamespaceFilePath)
+	}
+
+	return nil
+}
+
+// IsReadBalancingEnabled returns the `readBalancing` for the given clusterID,
+// which defaults to false. It is independent of the `readAffinity` settings.
+func IsReadBalancingEnabled(pathToConfig, clusterID string) (bool, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return false, err
+	}
+
+	return bool(cluster.ReadBalancing), nil
 }
 
 // GetCrushLocationLabels returns the `readAffinity.enabled` and `readAffinity.crushLocationLabels`
@@ -241,3 +1336,180 @@ func GetCephFSMountOptions(pathToConfig, clusterID string) (string, string, erro
 
 	return cluster.CephFS.KernelMountOptions, cluster.CephFS.FuseMountOptions, nil
 }
+
+// GetEffectiveCephFSMountOptions returns the `kernelMountOptions` when the
+// mounter is "kernel", and the `fuseMountOptions` when the mounter is "fuse".
+func GetEffectiveCephFSMountOptions(pathToConfig, clusterID, mounter string) (string, error) {
+	kernelMountOptions, fuseMountOptions, err := GetCephFSMountOptions(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	switch mounter {
+	case "kernel":
+		return kernelMountOptions, nil
+	case "fuse":
+		return fuseMountOptions, nil
+	}
+
+	return "", fmt.Errorf("unknown mounter %q, valid options are \"kernel\" and \"fuse\"", mounter)
+}
+
+// CSIConfigModTime returns the time the CSI config file was last modified.
+// This can be used to detect changes to the configuration without reading
+// and parsing the whole file.
+func CSIConfigModTime(pathToConfig string) (time.Time, error) {
+	info, err := os.Stat(pathToConfig)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat CSI config %q: %w", pathToConfig, err)
+	}
+
+	return info.ModTime(), nil
+}
+
+// RotateCSIConfig replaces the CSI config at pathToConfig with newClusters,
+// which are written in the order of CanonicalizeCSIConfig(). The previous config is kept in a timestamped backup next to it, and the
+// path of the backup is returned. The backup path is empty when there was no
+// previous config. The new config is written atomically, so that the previous
+// config remains intact in case writing fails.
+func RotateCSIConfig(pathToConfig string, newClusters []kubernetes.ClusterInfo) (string, error) {
+	return rotateCSIConfig(pathToConfig, newClusters, writeFileAtomic)
+}
+
+// rotateCSIConfig implements RotateCSIConfig, write is used to replace the
+// contents of the config file.
+func rotateCSIConfig(
+	pathToConfig string,
+	newClusters []kubernetes.ClusterInfo,
+	write func(path string, data []byte, perm os.FileMode) error,
+) (string, error) {
+	content, err := json.Marshal(CanonicalizeCSIConfig(newClusters))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal CSI config: %w", err)
+	}
+
+	perm := os.FileMode(0o644)
+	backupPath := ""
+	info, err := os.Stat(pathToConfig)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// nothing to back up
+	case err != nil:
+		return "", fmt.Errorf("failed to stat CSI config %q: %w", pathToConfig, err)
+	default:
+		perm = info.Mode().Perm()
+		backupPath = pathToConfig + "." + time.Now().UTC().Format("20060102T150405.000000000Z")
+
+		old, rErr := os.ReadFile(pathToConfig) // #nosec:G304, file inclusion via variable.
+		if rErr != nil {
+			return "", fmt.Errorf("failed to read CSI config %q: %w", pathToConfig, rErr)
+		}
+
+		err = write(backupPath, old, perm)
+		if err != nil {
+			return "", fmt.Errorf("failed to write backup %q of CSI config: %w", backupPath, err)
+		}
+	}
+
+	err = write(pathToConfig, content, perm)
+	if err != nil {
+		if backupPath != "" {
+			_ = os.Remove(backupPath)
+		}
+
+		return "", fmt.Errorf("failed to write CSI config %q: %w", pathToConfig, err)
+	}
+
+	return backupPath, nil
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of path,
+// and renames it to path once all data is written. Readers of path either see
+// the old or the new contents, never a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	// the temporary file does not exist anymore after a successful rename
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// CanonicalizeCSIConfig returns a copy of the passed clusters in a stable
+// order. Clusters are sorted by ClusterID, and the monitors, crush location
+// labels, NFS clients and the domain segments of the topology constrained
+// pools of each cluster are sorted as well. The topology constrained pools
+// keep their order, as the first matching pool is used. This makes sure that
+// rewriting the configuration does not produce unneeded changes.
+func CanonicalizeCSIConfig(clusters []kubernetes.ClusterInfo) []kubernetes.ClusterInfo {
+	canonical := copyClusters(clusters)
+	for i := range canonical {
+		slices.Sort(canonical[i].Monitors)
+		slices.Sort(canonical[i].ReadAffinity.CrushLocationLabels)
+		slices.Sort(canonical[i].NFS.Clients)
+		for j := range canonical[i].RBD.TopologyConstrainedPools {
+			slices.SortFunc(canonical[i].RBD.TopologyConstrainedPools[j].DomainSegments,
+				func(a, b kubernetes.TopologySegment) int {
+					if c := strings.Compare(a.DomainLabel, b.DomainLabel); c != 0 {
+						return c
+					}
+
+					return strings.Compare(a.DomainValue, b.DomainValue)
+				})
+		}
+	}
+
+	slices.SortStableFunc(canonical, func(a, b kubernetes.ClusterInfo) int {
+		return strings.Compare(a.ClusterID, b.ClusterID)
+	})
+
+	return canonical
+}
+
+// MergeClusterInfo returns a copy of base, with the fields that are set in
+// override replacing the fields in base. Nested structs are merged field by
+// field, slices from override replace the slices in base. Fields of override
+// with a zero value (like false, 0 or "") leave the field in base intact.
+func MergeClusterInfo(base, override kubernetes.ClusterInfo) kubernetes.ClusterInfo {
+	merged := base
+	mergeFields(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(override))
+
+	// do not share the slices and maps with base or override
+	return merged.DeepCopy()
+}
+
+// mergeFields sets the non-zero fields of override in dst, recursing into
+// nested structs. Unexported fields can not be set and are skipped.
+func mergeFields(dst, override reflect.Value) {
+	for i := range override.NumField() {
+		if !override.Type().Field(i).IsExported() {
+			continue
+		}
+
+		field := override.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			mergeFields(dst.Field(i), field)
+		case field.Kind() == reflect.Slice && field.Len() != 0:
+			dst.Field(i).Set(field)
+		case field.Kind() != reflect.Slice && !field.IsZero():
+			dst.Field(i).Set(field)
+		}
+	}
+}
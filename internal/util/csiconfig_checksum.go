@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+// CSIConfigChecksum returns the hex encoded sha256 checksum of the CSI config
+// at pathToConfig. The checksum is calculated over the parsed config, so that
+// formatting, the order of the clusters, and the order of the monitors of a
+// cluster do not change it. Plugins that read the same config version
+// return the same checksum, which can be used to confirm that a rollout of
+// the config has converged.
+func CSIConfigChecksum(pathToConfig string) (string, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CSI config %q: %w", pathToConfig, err)
+	}
+
+	content, err := json.Marshal(canonicalCSIConfig(config))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode CSI config %q: %w", pathToConfig, err)
+	}
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalCSIConfig returns a copy of config with the clusters sorted by
+// their clusterID, and the monitors of each cluster sorted.
+func canonicalCSIConfig(config []kubernetes.ClusterInfo) []kubernetes.ClusterInfo {
+	canonical := copyClusters(config)
+	for i := range canonical {
+		slices.Sort(canonical[i].Monitors)
+	}
+	slices.SortStableFunc(canonical, func(a, b kubernetes.ClusterInfo) int {
+		return strings.Compare(a.ClusterID, b.ClusterID)
+	})
+
+	return canonical
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSIConfigChecksum(t *testing.T) {
+	t.Parallel()
+
+	base := `[
+		{"clusterID": "cluster-1", "monitors": ["mon1:6789", "mon2:6789"], "rbd": {"radosNamespace": "ns"}},
+		{"clusterID": "cluster-2", "monitors": ["mon3:6789"]}
+	]`
+
+	checksum := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "ceph-csi.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		sum, err := CSIConfigChecksum(path)
+		require.NoError(t, err)
+
+		return sum
+	}
+	want := checksum(t, base)
+	require.Len(t, want, 64)
+
+	tests := []struct {
+		name    string
+		content string
+		same    bool
+	}{
+		{
+			name: "reordered clusters",
+			content: `[
+				{"clusterID": "cluster-2", "monitors": ["mon3:6789"]},
+				{"clusterID": "cluster-1", "monitors": ["mon1:6789", "mon2:6789"], "rbd": {"radosNamespace": "ns"}}
+			]`,
+			same: true,
+		},
+		{
+			name: "reordered monitors and formatting",
+			content: `[{"clusterID":"cluster-1","rbd":{"radosNamespace":"ns"},"monitors":["mon2:6789","mon1:6789"]},
+				{"monitors":["mon3:6789"],"clusterID":"cluster-2"}]`,
+			same: true,
+		},
+		{
+			name: "changed monitor",
+			content: `[
+				{"clusterID": "cluster-1", "monitors": ["mon1:6789", "mon4:6789"], "rbd": {"radosNamespace": "ns"}},
+				{"clusterID": "cluster-2", "monitors": ["mon3:6789"]}
+			]`,
+		},
+		{
+			name: "changed setting",
+			content: `[
+				{"clusterID": "cluster-1", "monitors": ["mon1:6789", "mon2:6789"], "rbd": {"radosNamespace": "other"}},
+				{"clusterID": "cluster-2", "monitors": ["mon3:6789"]}
+			]`,
+		},
+		{
+			name: "removed cluster",
+			content: `[
+				{"clusterID": "cluster-1", "monitors": ["mon1:6789", "mon2:6789"], "rbd": {"radosNamespace": "ns"}}
+			]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := checksum(t, tt.content)
+			if tt.same {
+				require.Equal(t, want, got)
+			} else {
+				require.NotEqual(t, want, got)
+			}
+		})
+	}
+
+	_, err := CSIConfigChecksum(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+// LintSeverity is the severity of a LintIssue.
+type LintSeverity string
+
+const (
+	// LintWarning is used for settings that are likely not what the operator
+	// intended, but that do not prevent the driver from working.
+	LintWarning LintSeverity = "warning"
+	// LintError is used for settings that cause operations to fail.
+	LintError LintSeverity = "error"
+)
+
+// LintIssue is a problem that was found in the CSI config.
+type LintIssue struct {
+	// Severity of the issue
+	Severity LintSeverity
+	// Field is the path of the field in the config, like [1].rbd.mounter
+	Field string
+	// Message describes the issue, prefixed with the cluster it was found in
+	Message string
+}
+
+// String returns a human readable description of the issue.
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", li.Severity, li.Field, li.Message)
+}
+
+// LintCSIConfig reads the CSI config at pathToConfig and returns the issues
+// that were found in it. An error is only returned when the config can not
+// be read or parsed.
+func LintCSIConfig(pathToConfig string) ([]LintIssue, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSI config %q: %w", pathToConfig, err)
+	}
+
+	return lintClusters(config), nil
+}
+
+// configLinter collects the issues of a single cluster in the CSI config.
+type configLinter struct {
+	index  int
+	name   string
+	issues []LintIssue
+}
+
+func (cl *configLinter) add(severity LintSeverity, field, format string, args ...interface{}) {
+	cl.issues = append(cl.issues, LintIssue{
+		Severity: severity,
+		Field:    fmt.Sprintf("[%d].%s", cl.index, field),
+		Message:  fmt.Sprintf("cluster %s: ", cl.name) + fmt.Sprintf(format, args...),
+	})
+}
+
+func lintClusters(config []kubernetes.ClusterInfo) []LintIssue {
+	var issues []LintIssue
+	seen := make(map[string]bool, len(config))
+
+	for i := range config {
+		cl := &configLinter{index: i, name: config[i].ClusterID}
+		if cl.name == "" {
+			cl.name = fmt.Sprintf("#%d", i)
+			cl.add(LintError, "clusterID", "missing clusterID")
+		} else if seen[cl.name] {
+			cl.add(LintError, "clusterID", "duplicate clusterID")
+		}
+		seen[config[i].ClusterID] = true
+
+		cl.lintCluster(&config[i])
+		issues = append(issues, cl.issues...)
+	}
+
+	return issues
+}
+
+func (cl *configLinter) lintCluster(cluster *kubernetes.ClusterInfo) {
+	cl.lintMonitors(cluster)
+
+	switch cluster.AuthMode {
+	case "", AuthModeCephx:
+	default:
+		cl.add(LintError, "authMode", "unsupported authMode %q, only %q is supported",
+			cluster.AuthMode, AuthModeCephx)
+	}
+
+	if cluster.LogLevel != nil && *cluster.LogLevel < 0 {
+		cl.add(LintError, "logLevel", "negative logLevel %d", *cluster.LogLevel)
+	}
+
+	err := ValidateReadAffinity(&cluster.ReadAffinity, "")
+	switch {
+	case errors.Is(err, ErrNoCrushLocationLabels):
+		cl.add(LintWarning, "readAffinity.crushLocationLabels",
+			"readAffinity enabled but no crushLocationLabels, the labels of the command line are used")
+	case err != nil:
+		cl.add(LintError, "readAffinity.crushLocationLabels", "%v", err)
+	}
+
+	cl.lintRBD(&cluster.RBD)
+
+	if cluster.CephFS.MaxSnapshotsPerVolume < 0 {
+		cl.add(LintError, "cephFS.maxSnapshotsPerVolume", "negative maxSnapshotsPerVolume %d",
+			cluster.CephFS.MaxSnapshotsPerVolume)
+	}
+
+	if cluster.CephFS.SnapshotRetentionCount < 0 {
+		cl.add(LintError, "cephFS.snapshotRetentionCount", "negative snapshotRetentionCount %d",
+			cluster.CephFS.SnapshotRetentionCount)
+	}
+
+	cl.lintNetNamespaceFilePath("rbd.netNamespaceFilePath", cluster.RBD.NetNamespaceFilePath)
+	cl.lintNetNamespaceFilePath("cephFS.netNamespaceFilePath", cluster.CephFS.NetNamespaceFilePath)
+	cl.lintNetNamespaceFilePath("nfs.netNamespaceFilePath", cluster.NFS.NetNamespaceFilePath)
+
+	cl.lintConflicts(cluster)
+}
+
+// lintConflicts checks for fields that are valid by themselves, but do not
+// make sense in combination with other fields of the cluster.
+func (cl *configLinter) lintConflicts(cluster *kubernetes.ClusterInfo) {
+	if bool(cluster.ReadOnly) && strings.EqualFold(cluster.NFS.AccessType, "RW") {
+		cl.add(LintWarning, "nfs.accessType",
+			"accessType \"RW\" has no effect, all volumes of the cluster are published read-only")
+	}
+}
+
+func (cl *configLinter) lintMonitors(cluster *kubernetes.ClusterInfo) {
+	if len(cluster.Monitors) == 0 {
+		cl.add(LintError, "monitors", "no monitors")
+	}
+
+	seen := make(map[string]bool, len(cluster.Monitors))
+	for _, mon := range cluster.Monitors {
+		if seen[mon] {
+			cl.add(LintWarning, "monitors", "duplicate monitor %q", mon)
+		}
+		seen[mon] = true
+	}
+
+	// duplicate monitors do not add to the quorum
+	switch count := len(seen); {
+	case count == 0:
+	case count < 3:
+		cl.add(LintWarning, "monitors", "%d monitor(s), at least 3 are needed to tolerate a monitor failure", count)
+	case count%2 == 0:
+		cl.add(LintWarning, "monitors", "even number of monitors %d, an odd number is needed for a majority quorum",
+			count)
+	}
+
+	var unknown []string
+	for mon := range cluster.MonitorPriorities {
+		if !seen[mon] {
+			unknown = append(unknown, mon)
+		}
+	}
+	slices.Sort(unknown)
+	for _, mon := range unknown {
+		cl.add(LintWarning, "monitorPriorities", "priority for unknown monitor %q", mon)
+	}
+}
+
+func (cl *configLinter) lintRBD(rbd *kubernetes.RBD) {
+	if rbd.MirrorDaemonCount < 0 {
+		cl.add(LintError, "rbd.mirrorDaemonCount", "negative mirrorDaemonCount %d", rbd.MirrorDaemonCount)
+	}
+
+	switch rbd.Mounter {
+	case "", "rbd", "rbd-nbd", "nbd":
+	default:
+		cl.add(LintError, "rbd.mounter", "invalid mounter %q, valid options are \"rbd\" and \"rbd-nbd\"",
+			rbd.Mounter)
+	}
+
+	if rbd.MaxSnapshotsPerVolume < 0 {
+		cl.add(LintError, "rbd.maxSnapshotsPerVolume", "negative maxSnapshotsPerVolume %d",
+			rbd.MaxSnapshotsPerVolume)
+	}
+
+	switch {
+	case (rbd.StripeUnit == 0) != (rbd.StripeCount == 0):
+		cl.add(LintError, "rbd.stripeUnit", "stripeUnit %d and stripeCount %d must be set together",
+			rbd.StripeUnit, rbd.StripeCount)
+	case rbd.StripeUnit < 0 || rbd.StripeCount < 0:
+		cl.add(LintError, "rbd.stripeUnit", "negative stripeUnit %d or stripeCount %d",
+			rbd.StripeUnit, rbd.StripeCount)
+	case rbd.StripeUnit&(rbd.StripeUnit-1) != 0:
+		cl.add(LintError, "rbd.stripeUnit", "stripeUnit %d is not a power of two", rbd.StripeUnit)
+	}
+
+	for i, pool := range rbd.TopologyConstrainedPools {
+		field := fmt.Sprintf("rbd.topologyConstrainedPools[%d]", i)
+		if pool.PoolName == "" {
+			cl.add(LintError, field+".poolName", "topology constrained pool without poolName")
+		}
+		if len(pool.DomainSegments) == 0 {
+			cl.add(LintWarning, field+".domainSegments",
+				"topology constrained pool %q without domainSegments", pool.PoolName)
+		}
+	}
+}
+
+func (cl *configLinter) lintNetNamespaceFilePath(field, path string) {
+	// paths that start with an environment variable are expanded when read
+	if path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "$") {
+		return
+	}
+
+	cl.add(LintWarning, field, "netNamespaceFilePath %q is not an absolute path", path)
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+func TestLintCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config []cephcsi.ClusterInfo
+		want   []LintIssue
+	}{
+		{
+			name: "valid config",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID:         "test1",
+					Monitors:          []string{"mon1", "mon2", "mon3"},
+					MonitorPriorities: map[string]int{"mon1": 1},
+					AuthMode:          AuthModeCephx,
+					RBD: cephcsi.RBD{
+						Mounter:              "rbd-nbd",
+						NetNamespaceFilePath: "$KUBELET_DIR/plugins/rbd.csi.ceph.com/net",
+					},
+					CephFS: cephcsi.CephFS{
+						NetNamespaceFilePath: "/var/lib/kubelet/plugins/cephfs.csi.ceph.com/net",
+					},
+				},
+			},
+			want: nil,
+		},
+		{
+			name: "duplicate and missing clusterID",
+			config: []cephcsi.ClusterInfo{
+				{ClusterID: "test2", Monitors: []string{"mon1", "mon2", "mon3"}},
+				{ClusterID: "test2", Monitors: []string{"mon4", "mon5", "mon6"}},
+				{Monitors: []string{"mon7", "mon8", "mon9"}},
+			},
+			want: []LintIssue{
+				{LintError, "[1].clusterID", "cluster test2: duplicate clusterID"},
+				{LintError, "[2].clusterID", "cluster #2: missing clusterID"},
+			},
+		},
+		{
+			name: "monitors",
+			config: []cephcsi.ClusterInfo{
+				{ClusterID: "test1"},
+				{
+					ClusterID:         "test2",
+					Monitors:          []string{"mon1", "mon1"},
+					MonitorPriorities: map[string]int{"mon3": 1, "mon2": 2},
+				},
+			},
+			want: []LintIssue{
+				{LintError, "[0].monitors", "cluster test1: no monitors"},
+				{LintWarning, "[1].monitors", `cluster test2: duplicate monitor "mon1"`},
+				{
+					LintWarning,
+					"[1].monitors",
+					"cluster test2: 1 monitor(s), at least 3 are needed to tolerate a monitor failure",
+				},
+				{LintWarning, "[1].monitorPriorities", `cluster test2: priority for unknown monitor "mon2"`},
+				{LintWarning, "[1].monitorPriorities", `cluster test2: priority for unknown monitor "mon3"`},
+			},
+		},
+		{
+			name: "readAffinity without crushLocationLabels",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID:    "test1",
+					Monitors:     []string{"mon1", "mon2", "mon3"},
+					ReadAffinity: cephcsi.ReadAffinity{Enabled: true},
+				},
+			},
+			want: []LintIssue{
+				{
+					LintWarning,
+					"[0].readAffinity.crushLocationLabels",
+					"cluster test1: readAffinity enabled but no crushLocationLabels, " +
+						"the labels of the command line are used",
+				},
+			},
+		},
+		{
+			name: "readAffinity with an empty crushLocationLabel",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID: "test1",
+					Monitors:  []string{"mon1", "mon2", "mon3"},
+					ReadAffinity: cephcsi.ReadAffinity{
+						Enabled:             true,
+						CrushLocationLabels: []string{"topology.kubernetes.io/zone", ""},
+					},
+				},
+			},
+			want: []LintIssue{
+				{
+					LintError,
+					"[0].readAffinity.crushLocationLabels",
+					"cluster test1: empty crush location label at index 1",
+				},
+			},
+		},
+		{
+			name: "invalid values",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID: "test1",
+					Monitors:  []string{"mon1", "mon2", "mon3"},
+					AuthMode:  "kerberos",
+					LogLevel:  ptr.To[cephcsi.FlexInt](-1),
+					RBD: cephcsi.RBD{
+						MirrorDaemonCount:     -2,
+						Mounter:               "krbd",
+						MaxSnapshotsPerVolume: -3,
+						TopologyConstrainedPools: []cephcsi.TopologyPool{
+							{PoolName: "pool-a"},
+						},
+					},
+					CephFS: cephcsi.CephFS{
+						MaxSnapshotsPerVolume: -4,
+					},
+					NFS: cephcsi.NFS{
+						NetNamespaceFilePath: "plugins/nfs.csi.ceph.com/net",
+					},
+				},
+			},
+			want: []LintIssue{
+				{LintError, "[0].authMode", `cluster test1: unsupported authMode "kerberos", only "cephx" is supported`},
+				{LintError, "[0].logLevel", "cluster test1: negative logLevel -1"},
+				{LintError, "[0].rbd.mirrorDaemonCount", "cluster test1: negative mirrorDaemonCount -2"},
+				{LintError, "[0].rbd.mounter", `cluster test1: invalid mounter "krbd", valid options are "rbd" and "rbd-nbd"`},
+				{LintError, "[0].rbd.maxSnapshotsPerVolume", "cluster test1: negative maxSnapshotsPerVolume -3"},
+				{
+					LintWarning,
+					"[0].rbd.topologyConstrainedPools[0].domainSegments",
+					`cluster test1: topology constrained pool "pool-a" without domainSegments`,
+				},
+				{LintError, "[0].cephFS.maxSnapshotsPerVolume", "cluster test1: negative maxSnapshotsPerVolume -4"},
+				{
+					LintWarning,
+					"[0].nfs.netNamespaceFilePath",
+					`cluster test1: netNamespaceFilePath "plugins/nfs.csi.ceph.com/net" is not an absolute path`,
+				},
+			},
+		},
+		{
+			name: "conflicting fields",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID: "test1",
+					Monitors:  []string{"mon1", "mon2", "mon3"},
+					ReadOnly:  true,
+					RBD: cephcsi.RBD{
+						ClientID:   "csi-rbd",
+						StripeUnit: 65536,
+					},
+					NFS: cephcsi.NFS{
+						ClientID:   "csi-nfs",
+						AccessType: "rw",
+					},
+				},
+				{
+					ClusterID: "test2",
+					Monitors:  []string{"mon1", "mon2", "mon3"},
+					RBD: cephcsi.RBD{
+						StripeUnit:  3000,
+						StripeCount: 4,
+					},
+				},
+			},
+			want: []LintIssue{
+				{LintError, "[0].rbd.stripeUnit", "cluster test1: stripeUnit 65536 and stripeCount 0 must be set together"},
+				{
+					LintWarning,
+					"[0].nfs.accessType",
+					`cluster test1: accessType "RW" has no effect, all volumes of the cluster are published read-only`,
+				},
+				{LintError, "[1].rbd.stripeUnit", "cluster test2: stripeUnit 3000 is not a power of two"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := json.Marshal(tt.config)
+			require.NoError(t, err)
+			path := t.TempDir() + "/ceph-csi.json"
+			require.NoError(t, os.WriteFile(path, content, 0o600))
+
+			issues, err := LintCSIConfig(path)
+			if err != nil {
+				t.Errorf("LintCSIConfig() error = %v", err)
+
+				return
+			}
+			require.Equal(t, tt.want, issues)
+		})
+	}
+
+	t.Run("unreadable config", func(t *testing.T) {
+		t.Parallel()
+		path := t.TempDir() + "/ceph-csi.json"
+		require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+
+		_, err := LintCSIConfig(path)
+		require.Error(t, err)
+		_, err = LintCSIConfig(t.TempDir() + "/missing.json")
+		require.Error(t, err)
+	})
+}
+
+func TestLintMonitorQuorum(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		monitors []string
+		want     []LintIssue
+	}{
+		{
+			name:     "one monitor",
+			monitors: []string{"mon1"},
+			want: []LintIssue{
+				{LintWarning, "[0].monitors", "cluster test1: 1 monitor(s), at least 3 are needed to tolerate a monitor failure"},
+			},
+		},
+		{
+			name:     "two monitors",
+			monitors: []string{"mon1", "mon2"},
+			want: []LintIssue{
+				{LintWarning, "[0].monitors", "cluster test1: 2 monitor(s), at least 3 are needed to tolerate a monitor failure"},
+			},
+		},
+		{
+			name:     "three monitors",
+			monitors: []string{"mon1", "mon2", "mon3"},
+			want:     nil,
+		},
+		{
+			name:     "four monitors",
+			monitors: []string{"mon1", "mon2", "mon3", "mon4"},
+			want: []LintIssue{
+				{
+					LintWarning,
+					"[0].monitors",
+					"cluster test1: even number of monitors 4, an odd number is needed for a majority quorum",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			issues := lintClusters([]cephcsi.ClusterInfo{{ClusterID: "test1", Monitors: tt.monitors}})
+			require.Equal(t, tt.want, issues)
+		})
+	}
+}
+
+func TestLintIssueString(t *testing.T) {
+	t.Parallel()
+
+	issue := LintIssue{LintError, "[1].clusterID", "cluster test2: duplicate clusterID"}
+	require.Equal(t, "error: [1].clusterID: cluster test2: duplicate clusterID", issue.String())
+}
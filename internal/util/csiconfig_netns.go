@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// FindStaleNetNSFiles returns the netNamespaceFilePath entries of the RBD,
+// CephFS and NFS sections in the CSI config that point to files that do not
+// exist anymore. This happens when the holder pod that created the network
+// namespace was restarted. Each stale path is returned once, in the order of
+// the config. The CSI config is only read: it is a ConfigMap that is not
+// written by the plugins, and clearing an entry would move the traffic of
+// the cluster to the host network instead of the recreated namespace.
+func FindStaleNetNSFiles(pathToConfig string) ([]string, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []string{}
+	for i := range config {
+		for _, netNSPath := range []string{
+			config[i].RBD.NetNamespaceFilePath,
+			config[i].CephFS.NetNamespaceFilePath,
+			config[i].NFS.NetNamespaceFilePath,
+		} {
+			if netNSPath == "" {
+				continue
+			}
+
+			path, err := expandConfigPath(netNSPath)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = os.Stat(path)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				if !slices.Contains(stale, path) {
+					stale = append(stale, path)
+				}
+			case err != nil:
+				return nil, fmt.Errorf("failed to stat netNamespaceFilePath %q of cluster ID %q: %w",
+					path, config[i].ClusterID, err)
+			}
+		}
+	}
+
+	return stale, nil
+}
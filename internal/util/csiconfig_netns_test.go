@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeNetNSTestConfig writes a CSI config with existing and dangling
+// netNamespaceFilePath entries to a temporary directory, and returns the
+// path of the config and the paths of the netns files.
+func writeNetNSTestConfig(t *testing.T) (string, string, string, string) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "rbd-net")
+	require.NoError(t, os.WriteFile(existing, nil, 0o600))
+	danglingRBD := filepath.Join(tmpDir, "rbd-net-old")
+	danglingCephFS := filepath.Join(tmpDir, "cephfs-net-old")
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{NetNamespaceFilePath: existing},
+			CephFS:    cephcsi.CephFS{NetNamespaceFilePath: danglingCephFS},
+		},
+		{
+			ClusterID: "cluster-2",
+			RBD:       cephcsi.RBD{NetNamespaceFilePath: danglingRBD},
+			NFS:       cephcsi.NFS{NetNamespaceFilePath: danglingCephFS},
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+	}
+	content, err := json.Marshal(csiConfig)
+	require.NoError(t, err)
+	pathToConfig := filepath.Join(tmpDir, "ceph-csi.json")
+	require.NoError(t, os.WriteFile(pathToConfig, content, 0o600))
+
+	return pathToConfig, existing, danglingRBD, danglingCephFS
+}
+
+func TestFindStaleNetNSFiles(t *testing.T) {
+	t.Parallel()
+
+	pathToConfig, existing, danglingRBD, danglingCephFS := writeNetNSTestConfig(t)
+	before, err := os.ReadFile(pathToConfig)
+	require.NoError(t, err)
+
+	stale, err := FindStaleNetNSFiles(pathToConfig)
+	require.NoError(t, err)
+	require.Equal(t, []string{danglingCephFS, danglingRBD}, stale)
+
+	// the config is not modified
+	after, err := os.ReadFile(pathToConfig)
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+
+	netNSPath, err := GetRBDNetNamespaceFilePath(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, existing, netNSPath)
+
+	_, err = FindStaleNetNSFiles(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
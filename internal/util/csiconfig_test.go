@@ -19,12 +19,18 @@ package util
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util/log"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
 )
 
 var (
@@ -352,6 +358,126 @@ func TestGetNFSNetNamespaceFilePath(t *testing.T) {
 	}
 }
 
+//nolint:paralleltest // t.Setenv() can not be used in parallel tests
+func TestExpandConfigPath(t *testing.T) {
+	t.Setenv("CSI_TEST_KUBELET_DIR", "/var/lib/kubelet")
+	t.Setenv("CSI_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		path    string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "path without variables",
+			path: "/var/lib/kubelet/plugins/rbd.csi.ceph.com/net",
+			want: "/var/lib/kubelet/plugins/rbd.csi.ceph.com/net",
+		},
+		{
+			name: "expand $VAR",
+			path: "$CSI_TEST_KUBELET_DIR/plugins/rbd.csi.ceph.com/net",
+			want: "/var/lib/kubelet/plugins/rbd.csi.ceph.com/net",
+		},
+		{
+			name:   "expand ${VAR} in strict mode",
+			path:   "${CSI_TEST_KUBELET_DIR}/plugins/rbd.csi.ceph.com/net",
+			strict: true,
+			want:   "/var/lib/kubelet/plugins/rbd.csi.ceph.com/net",
+		},
+		{
+			name:   "variable set to an empty value in strict mode",
+			path:   "/var/lib/kubelet${CSI_TEST_EMPTY}/plugins",
+			strict: true,
+			want:   "/var/lib/kubelet/plugins",
+		},
+		{
+			name: "unset variable",
+			path: "${CSI_TEST_UNSET}/plugins",
+			want: "/plugins",
+		},
+		{
+			name:    "unset variable in strict mode",
+			path:    "${CSI_TEST_UNSET}/plugins",
+			strict:  true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandConfigPath(tt.path, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExpandConfigPath() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if tt.wantErr {
+				require.ErrorContains(t, err, "CSI_TEST_UNSET")
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ExpandConfigPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // the config path expansion is a package setting
+func TestGetNetNamespaceFilePathExpansion(t *testing.T) {
+	t.Setenv("CSI_TEST_KUBELET_DIR", "/var/lib/kubelet")
+	defer SetConfigPathExpansion(false, false)
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1", "ip-2"},
+			RBD: cephcsi.RBD{
+				NetNamespaceFilePath: "$CSI_TEST_KUBELET_DIR/plugins/rbd.ceph.csi.com/net",
+			},
+			CephFS: cephcsi.CephFS{
+				NetNamespaceFilePath: "${CSI_TEST_KUBELET_DIR}/plugins/cephfs.ceph.csi.com/net",
+			},
+			NFS: cephcsi.NFS{
+				NetNamespaceFilePath: "${CSI_TEST_UNSET}/plugins/nfs.ceph.csi.com/net",
+			},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	// without expansion the paths are returned as configured
+	got, err := GetRBDNetNamespaceFilePath(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "$CSI_TEST_KUBELET_DIR/plugins/rbd.ceph.csi.com/net", got)
+
+	SetConfigPathExpansion(true, false)
+	got, err = GetRBDNetNamespaceFilePath(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/kubelet/plugins/rbd.ceph.csi.com/net", got)
+	got, err = GetCephFSNetNamespaceFilePath(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/kubelet/plugins/cephfs.ceph.csi.com/net", got)
+	got, err = GetNFSNetNamespaceFilePath(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "/plugins/nfs.ceph.csi.com/net", got)
+
+	SetConfigPathExpansion(false, true)
+	got, err = GetCephFSNetNamespaceFilePath(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/kubelet/plugins/cephfs.ceph.csi.com/net", got)
+	_, err = GetNFSNetNamespaceFilePath(tmpConfPath, "cluster-1")
+	require.ErrorContains(t, err, "CSI_TEST_UNSET")
+}
+
 func TestGetReadAffinityOptions(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -529,12 +655,93 @@ func TestGetCephFSMountOptions(t *testing.T) {
 	}
 }
 
+func TestGetEffectiveCephFSMountOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		mounter   string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "kernel mounter",
+			clusterID: "cluster-1",
+			mounter:   "kernel",
+			want:      "crc",
+		},
+		{
+			name:      "fuse mounter",
+			clusterID: "cluster-1",
+			mounter:   "fuse",
+			want:      "ro",
+		},
+		{
+			name:      "fuse mounter without mount options",
+			clusterID: "cluster-2",
+			mounter:   "fuse",
+			want:      "",
+		},
+		{
+			name:      "invalid mounter",
+			clusterID: "cluster-1",
+			mounter:   "nfs",
+			wantErr:   true,
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-3",
+			mounter:   "kernel",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			CephFS: cephcsi.CephFS{
+				KernelMountOptions: "crc",
+				FuseMountOptions:   "ro",
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			CephFS:    cephcsi.CephFS{},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetEffectiveCephFSMountOptions(tmpConfPath, tt.clusterID, tt.mounter)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetEffectiveCephFSMountOptions() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetEffectiveCephFSMountOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetRBDMirrorDaemonCount(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
 		name      string
 		clusterID string
 		want      int
+		wantErr   bool
 	}{
 		{
 			name:      "get rbd mirror daemon count for cluster-1",
@@ -551,8 +758,22 @@ func TestGetRBDMirrorDaemonCount(t *testing.T) {
 			clusterID: "cluster-3",
 			want:      1, // default mirror daemon count
 		},
+		{
+			name:      "when rbd mirror daemon count is negative",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+		{
+			name:      "when rbd mirror daemon count is zero",
+			clusterID: "cluster-5",
+			wantErr:   true,
+		},
 	}
 
+	// a count of 0 is only told apart from an unset count when it is parsed
+	var zeroCount cephcsi.RBD
+	require.NoError(t, json.Unmarshal([]byte(`{"mirrorDaemonCount":0}`), &zeroCount))
+
 	csiConfig := []cephcsi.ClusterInfo{
 		{
 			ClusterID: "cluster-1",
@@ -572,6 +793,18 @@ func TestGetRBDMirrorDaemonCount(t *testing.T) {
 			ClusterID: "cluster-3",
 			Monitors:  []string{"ip-5", "ip-6"},
 		},
+		{
+			ClusterID: "cluster-4",
+			Monitors:  []string{"ip-7", "ip-8"},
+			RBD: cephcsi.RBD{
+				MirrorDaemonCount: -1,
+			},
+		},
+		{
+			ClusterID: "cluster-5",
+			Monitors:  []string{"ip-9"},
+			RBD:       zeroCount,
+		},
 	}
 	csiConfigFileContent, err := json.Marshal(csiConfig)
 	if err != nil {
@@ -587,8 +820,8 @@ func TestGetRBDMirrorDaemonCount(t *testing.T) {
 			t.Parallel()
 			var got int
 			got, err = GetRBDMirrorDaemonCount(tmpConfPath, tt.clusterID)
-			if err != nil {
-				t.Errorf("GetRBDMirrorDaemonCount() error = %v", err)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRBDMirrorDaemonCount() error = %v, wantErr %v", err, tt.wantErr)
 
 				return
 			}
@@ -612,3 +845,2766 @@ func TestGetRBDMirrorDaemonCount(t *testing.T) {
 	_, err = GetRBDMirrorDaemonCount(tmpCSIConfPath, "test")
 	require.Error(t, err)
 }
+
+func TestCanonicalizeCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	want := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1", "ip-2", "ip-3"},
+			ReadAffinity: cephcsi.ReadAffinity{
+				Enabled: true,
+				CrushLocationLabels: []string{
+					"topology.io/rack",
+					"topology.kubernetes.io/region",
+					"topology.kubernetes.io/zone",
+				},
+			},
+		},
+		{
+			ClusterID:         "cluster-2",
+			Monitors:          []string{"ip-4", "ip-5"},
+			MonitorPriorities: map[string]int{"ip-4": 1},
+			RBD: cephcsi.RBD{
+				TopologyConstrainedPools: []cephcsi.TopologyPool{
+					{
+						PoolName: "pool-b",
+						DomainSegments: []cephcsi.TopologySegment{
+							{DomainLabel: "region", DomainValue: "east"},
+							{DomainLabel: "zone", DomainValue: "zone1"},
+						},
+					},
+					{
+						PoolName: "pool-a",
+					},
+				},
+			},
+		},
+		{
+			ClusterID: "cluster-3",
+			NFS: cephcsi.NFS{
+				Clients: []string{"10.0.0.1", "10.0.0.2"},
+			},
+		},
+	}
+
+	shuffled := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-3",
+			NFS: cephcsi.NFS{
+				Clients: []string{"10.0.0.2", "10.0.0.1"},
+			},
+		},
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-3", "ip-1", "ip-2"},
+			ReadAffinity: cephcsi.ReadAffinity{
+				Enabled: true,
+				CrushLocationLabels: []string{
+					"topology.kubernetes.io/zone",
+					"topology.io/rack",
+					"topology.kubernetes.io/region",
+				},
+			},
+		},
+		{
+			ClusterID:         "cluster-2",
+			Monitors:          []string{"ip-5", "ip-4"},
+			MonitorPriorities: map[string]int{"ip-4": 1},
+			RBD: cephcsi.RBD{
+				TopologyConstrainedPools: []cephcsi.TopologyPool{
+					{
+						PoolName: "pool-b",
+						DomainSegments: []cephcsi.TopologySegment{
+							{DomainLabel: "zone", DomainValue: "zone1"},
+							{DomainLabel: "region", DomainValue: "east"},
+						},
+					},
+					{
+						PoolName: "pool-a",
+					},
+				},
+			},
+		},
+	}
+
+	got := CanonicalizeCSIConfig(shuffled)
+	require.Equal(t, want, got)
+
+	// the passed in clusters should not be modified
+	require.Equal(t, "cluster-3", shuffled[0].ClusterID)
+	require.Equal(t, []string{"ip-3", "ip-1", "ip-2"}, shuffled[1].Monitors)
+	require.Equal(t, []string{"10.0.0.2", "10.0.0.1"}, shuffled[0].NFS.Clients)
+	require.Equal(t, "zone", shuffled[2].RBD.TopologyConstrainedPools[0].DomainSegments[0].DomainLabel)
+
+	// the copy should not share maps with the passed in clusters
+	got[1].MonitorPriorities["ip-5"] = 2
+	require.NotContains(t, shuffled[2].MonitorPriorities, "ip-5")
+
+	// canonicalizing an already canonical config should not change it
+	require.Equal(t, want, CanonicalizeCSIConfig(got))
+}
+
+func TestListMirroringClusters(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{MirrorDaemonCount: 2},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+		{
+			ClusterID: "cluster-3",
+			RBD:       cephcsi.RBD{MirrorDaemonCount: 1},
+		},
+		{
+			ClusterID: "cluster-4",
+			RBD:       cephcsi.RBD{MirrorDaemonCount: -1},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	got, err := ListMirroringClusters(tmpConfPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cluster-1", "cluster-3"}, got)
+
+	noMirroringPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(noMirroringPath, []byte(`[{"clusterID": "cluster-1"}]`), 0o600)
+	require.NoError(t, err)
+	got, err = ListMirroringClusters(noMirroringPath)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	_, err = ListMirroringClusters(t.TempDir() + "/missing.json")
+	require.Error(t, err)
+}
+
+func TestGetRBDMapOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		clusterID        string
+		wantMapOptions   string
+		wantUnmapOptions string
+	}{
+		{
+			name:             "cluster-1 with map and unmap options",
+			clusterID:        "cluster-1",
+			wantMapOptions:   "krbd:exclusive,lock_on_read;nbd:try-netlink",
+			wantUnmapOptions: "force",
+		},
+		{
+			name:             "cluster-2 with only map options",
+			clusterID:        "cluster-2",
+			wantMapOptions:   "exclusive",
+			wantUnmapOptions: "",
+		},
+		{
+			name:             "cluster-3 with no map and unmap options",
+			clusterID:        "cluster-3",
+			wantMapOptions:   "",
+			wantUnmapOptions: "",
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD: cephcsi.RBD{
+				MapOptions:   "krbd:exclusive,lock_on_read;nbd:try-netlink",
+				UnmapOptions: "force",
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			RBD: cephcsi.RBD{
+				MapOptions: "exclusive",
+			},
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mapOptions, err := GetRBDMapOptions(tmpConfPath, tt.clusterID)
+			if err != nil {
+				t.Errorf("GetRBDMapOptions() error = %v", err)
+			}
+			if mapOptions != tt.wantMapOptions {
+				t.Errorf("GetRBDMapOptions() = %v, want %v", mapOptions, tt.wantMapOptions)
+			}
+			unmapOptions, err := GetRBDUnmapOptions(tmpConfPath, tt.clusterID)
+			if err != nil {
+				t.Errorf("GetRBDUnmapOptions() error = %v", err)
+			}
+			if unmapOptions != tt.wantUnmapOptions {
+				t.Errorf("GetRBDUnmapOptions() = %v, want %v", unmapOptions, tt.wantUnmapOptions)
+			}
+		})
+	}
+}
+
+func TestCSIConfigModTime(t *testing.T) {
+	t.Parallel()
+
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+
+	// TEST: Should fail as the config file is missing
+	_, err := CSIConfigModTime(tmpConfPath)
+	require.Error(t, err)
+
+	err = os.WriteFile(tmpConfPath, []byte("[]"), 0o600)
+	require.NoError(t, err)
+
+	modTime, err := CSIConfigModTime(tmpConfPath)
+	require.NoError(t, err)
+
+	// touch the file, setting the modification time in the future
+	touched := modTime.Add(time.Minute)
+	err = os.Chtimes(tmpConfPath, touched, touched)
+	require.NoError(t, err)
+
+	newModTime, err := CSIConfigModTime(tmpConfPath)
+	require.NoError(t, err)
+	require.True(t, newModTime.After(modTime), "modification time %v did not advance past %v", newModTime, modTime)
+	require.True(t, newModTime.Equal(touched))
+}
+
+func TestValidateNetNamespaceFilePath(t *testing.T) {
+	t.Parallel()
+
+	regularFile := t.TempDir() + "/net"
+	err := os.WriteFile(regularFile, []byte{}, 0o600)
+	if err != nil {
+		t.Errorf("failed to create %s: %v", regularFile, err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{
+			name:    "netNamespaceFilePath is not set",
+			path:    "",
+			wantErr: false,
+		},
+		{
+			name:    "netNamespaceFilePath of the current process",
+			path:    "/proc/self/ns/net",
+			wantErr: false,
+		},
+		{
+			name:    "netNamespaceFilePath is missing",
+			path:    "/var/lib/kubelet/plugins/rbd.ceph.csi.com/missing-net",
+			wantErr: true,
+		},
+		{
+			name:    "netNamespaceFilePath is not a network namespace",
+			path:    regularFile,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateNetNamespaceFilePath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNetNamespaceFilePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetClusterInfoFromMonitors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		monitors      string
+		wantClusterID string
+		wantMonitors  []string
+		wantErr       bool
+	}{
+		{
+			name:          "legacy handle with monitors of cluster-1",
+			monitors:      "ip-1:6789,ip-2:6789",
+			wantClusterID: "cluster-1",
+			wantMonitors:  []string{"ip-1:6789", "ip-2:6789"},
+		},
+		{
+			name:          "legacy handle with a single monitor of cluster-3",
+			monitors:      "ip-0:6789,ip-6:6789",
+			wantClusterID: "cluster-3",
+			wantMonitors:  []string{"ip-5:6789", "ip-6:6789"},
+		},
+		{
+			name:          "cluster-2 with radosNamespace is skipped",
+			monitors:      "ip-3:6789",
+			wantClusterID: "",
+			wantMonitors:  []string{"ip-3:6789"},
+		},
+		{
+			name:          "legacy handle without matching cluster",
+			monitors:      "ip-7:6789,ip-8:6789",
+			wantClusterID: "",
+			wantMonitors:  []string{"ip-7:6789", "ip-8:6789"},
+		},
+		{
+			name:     "legacy handle without monitors",
+			monitors: "",
+			wantErr:  true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1:6789", "ip-2:6789"},
+		},
+		{
+			ClusterID: "cluster-2",
+			Monitors:  []string{"ip-3:6789", "ip-4:6789"},
+			RBD: cephcsi.RBD{
+				RadosNamespace: "ns",
+			},
+		},
+		{
+			ClusterID: "cluster-3",
+			Monitors:  []string{"ip-5:6789", "ip-6:6789"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetClusterInfoFromMonitors(tmpConfPath, tt.monitors)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetClusterInfoFromMonitors() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.ClusterID != tt.wantClusterID {
+				t.Errorf("GetClusterInfoFromMonitors() ClusterID = %v, want %v", got.ClusterID, tt.wantClusterID)
+			}
+			require.Equal(t, tt.wantMonitors, got.Monitors)
+		})
+	}
+}
+
+func TestGetRBDImageFeatures(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+	}{
+		{
+			name:      "get rbd default image features for cluster-1",
+			clusterID: "cluster-1",
+			want:      "layering,exclusive-lock,object-map,fast-diff,deep-flatten",
+		},
+		{
+			name:      "when rbd default image features are empty",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "when rbd default image features are absent",
+			clusterID: "cluster-3",
+			want:      "",
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD: cephcsi.RBD{
+				DefaultImageFeatures: "layering,exclusive-lock,object-map,fast-diff,deep-flatten",
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			RBD: cephcsi.RBD{
+				DefaultImageFeatures: "",
+			},
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetRBDImageFeatures(tmpConfPath, tt.clusterID)
+			if err != nil {
+				t.Errorf("GetRBDImageFeatures() error = %v", err)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetRBDImageFeatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRBDMounter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "get rbd mounter for cluster-1",
+			clusterID: "cluster-1",
+			want:      "rbd",
+		},
+		{
+			name:      "get rbd-nbd mounter for cluster-2",
+			clusterID: "cluster-2",
+			want:      "rbd-nbd",
+		},
+		{
+			name:      "nbd is an alias for rbd-nbd",
+			clusterID: "cluster-3",
+			want:      "rbd-nbd",
+		},
+		{
+			name:      "when rbd mounter is absent",
+			clusterID: "cluster-4",
+			want:      "",
+		},
+		{
+			name:      "when rbd mounter is invalid",
+			clusterID: "cluster-5",
+			wantErr:   true,
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-6",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{Mounter: "rbd"},
+		},
+		{
+			ClusterID: "cluster-2",
+			RBD:       cephcsi.RBD{Mounter: "rbd-nbd"},
+		},
+		{
+			ClusterID: "cluster-3",
+			RBD:       cephcsi.RBD{Mounter: "nbd"},
+		},
+		{
+			ClusterID: "cluster-4",
+		},
+		{
+			ClusterID: "cluster-5",
+			RBD:       cephcsi.RBD{Mounter: "fuse"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetRBDMounter(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRBDMounter() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetRBDMounter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRBDStripeConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		wantUnit  int
+		wantCount int
+		wantErr   bool
+	}{
+		{
+			name:      "get striping for cluster-1",
+			clusterID: "cluster-1",
+			wantUnit:  4194304,
+			wantCount: 4,
+		},
+		{
+			name:      "when striping is absent",
+			clusterID: "cluster-2",
+		},
+		{
+			name:      "when stripe unit is not a power of two",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+		{
+			name:      "when only stripe unit is set",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+		{
+			name:      "when only stripe count is set",
+			clusterID: "cluster-5",
+			wantErr:   true,
+		},
+		{
+			name:      "when stripe count is negative",
+			clusterID: "cluster-6",
+			wantErr:   true,
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-7",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{StripeUnit: 4194304, StripeCount: 4},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+		{
+			ClusterID: "cluster-3",
+			RBD:       cephcsi.RBD{StripeUnit: 3000000, StripeCount: 4},
+		},
+		{
+			ClusterID: "cluster-4",
+			RBD:       cephcsi.RBD{StripeUnit: 65536},
+		},
+		{
+			ClusterID: "cluster-5",
+			RBD:       cephcsi.RBD{StripeCount: 8},
+		},
+		{
+			ClusterID: "cluster-6",
+			RBD:       cephcsi.RBD{StripeUnit: 65536, StripeCount: -1},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			unit, count, err := GetRBDStripeConfig(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRBDStripeConfig() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if unit != tt.wantUnit || count != tt.wantCount {
+				t.Errorf("GetRBDStripeConfig() = (%d, %d), want (%d, %d)", unit, count, tt.wantUnit, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestGetRBDMaxCloneDepth(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      int
+		wantErr   bool
+	}{
+		{
+			name:      "get max clone depth for cluster-1",
+			clusterID: "cluster-1",
+			want:      3,
+		},
+		{
+			name:      "when max clone depth is absent",
+			clusterID: "cluster-2",
+			want:      DefaultRBDMaxCloneDepth,
+		},
+		{
+			name:      "when max clone depth is negative",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{MaxCloneDepth: 3},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+		{
+			ClusterID: "cluster-3",
+			RBD:       cephcsi.RBD{MaxCloneDepth: -1},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetRBDMaxCloneDepth(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRBDMaxCloneDepth() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetRBDMaxCloneDepth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNFSExportOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      *NFSExportOptions
+		wantErr   bool
+	}{
+		{
+			name:      "defaults when the options are absent",
+			clusterID: "cluster-1",
+			want:      &NFSExportOptions{Squash: "none", AccessType: "RW"},
+		},
+		{
+			name:      "all options are set",
+			clusterID: "cluster-2",
+			want: &NFSExportOptions{
+				Squash:     "rootid",
+				AccessType: "RO",
+				Clients:    []string{"192.168.0.0/16", "10.0.0.1"},
+			},
+		},
+		{
+			name:      "options are case insensitive",
+			clusterID: "cluster-3",
+			want:      &NFSExportOptions{Squash: "all", AccessType: "RW"},
+		},
+		{
+			name:      "when squash is invalid",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+		{
+			name:      "when accessType is invalid",
+			clusterID: "cluster-5",
+			wantErr:   true,
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-6",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+		},
+		{
+			ClusterID: "cluster-2",
+			NFS: cephcsi.NFS{
+				Squash:     "rootid",
+				AccessType: "RO",
+				Clients:    []string{"192.168.0.0/16", "10.0.0.1"},
+			},
+		},
+		{
+			ClusterID: "cluster-3",
+			NFS:       cephcsi.NFS{Squash: "All", AccessType: "rw"},
+		},
+		{
+			ClusterID: "cluster-4",
+			NFS:       cephcsi.NFS{Squash: "no_root_squash"},
+		},
+		{
+			ClusterID: "cluster-5",
+			NFS:       cephcsi.NFS{AccessType: "none"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetNFSExportOptions(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetNFSExportOptions() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetClusterName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "get name for cluster-1",
+			clusterID: "cluster-1",
+			want:      "production-east",
+		},
+		{
+			name:      "when name is empty",
+			clusterID: "cluster-2",
+			want:      "cluster-2",
+		},
+		{
+			name:      "when name is absent",
+			clusterID: "cluster-3",
+			want:      "cluster-3",
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Name:      "production-east",
+		},
+		{
+			ClusterID: "cluster-2",
+			Name:      "",
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetClusterName(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetClusterName() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetClusterName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClusterNamespace(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "get namespace for cluster-1",
+			clusterID: "cluster-1",
+			want:      "tenant-a",
+		},
+		{
+			name:      "when namespace is empty",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "when namespace is absent",
+			clusterID: "cluster-3",
+			want:      "",
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Namespace: "tenant-a",
+		},
+		{
+			ClusterID: "cluster-2",
+			Namespace: "",
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetClusterNamespace(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetClusterNamespace() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetClusterNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeClusterInfo(t *testing.T) {
+	t.Parallel()
+
+	base := cephcsi.ClusterInfo{
+		ClusterID: "cluster-1",
+		Monitors:  []string{"mon1", "mon2"},
+		RBD: cephcsi.RBD{
+			RadosNamespace:    "base-ns",
+			MirrorDaemonCount: 1,
+			MapOptions:        "krbd:queue_depth=1024",
+		},
+		CephFS: cephcsi.CephFS{
+			SubvolumeGroup:     "base-group",
+			KernelMountOptions: "ms_mode=secure",
+		},
+		ReadAffinity: cephcsi.ReadAffinity{
+			Enabled:             true,
+			CrushLocationLabels: []string{"zone"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		override cephcsi.ClusterInfo
+		want     cephcsi.ClusterInfo
+	}{
+		{
+			name:     "empty override",
+			override: cephcsi.ClusterInfo{},
+			want:     base,
+		},
+		{
+			name:     "scalar override",
+			override: cephcsi.ClusterInfo{ClusterID: "cluster-2", Namespace: "tenant-a"},
+			want: func() cephcsi.ClusterInfo {
+				want := base
+				want.ClusterID = "cluster-2"
+				want.Namespace = "tenant-a"
+
+				return want
+			}(),
+		},
+		{
+			name: "slice replacement",
+			override: cephcsi.ClusterInfo{
+				Monitors: []string{"mon3"},
+				ReadAffinity: cephcsi.ReadAffinity{
+					CrushLocationLabels: []string{"rack", "host"},
+				},
+			},
+			want: func() cephcsi.ClusterInfo {
+				want := base
+				want.Monitors = []string{"mon3"}
+				want.ReadAffinity = cephcsi.ReadAffinity{
+					Enabled:             true,
+					CrushLocationLabels: []string{"rack", "host"},
+				}
+
+				return want
+			}(),
+		},
+		{
+			name: "nested struct merge",
+			override: cephcsi.ClusterInfo{
+				RBD: cephcsi.RBD{
+					MirrorDaemonCount: 3,
+					Mounter:           "rbd-nbd",
+				},
+				CephFS: cephcsi.CephFS{
+					SubvolumeGroup: "override-group",
+				},
+			},
+			want: func() cephcsi.ClusterInfo {
+				want := base
+				want.RBD = cephcsi.RBD{
+					RadosNamespace:    "base-ns",
+					MirrorDaemonCount: 3,
+					MapOptions:        "krbd:queue_depth=1024",
+					Mounter:           "rbd-nbd",
+				}
+				want.CephFS = cephcsi.CephFS{
+					SubvolumeGroup:     "override-group",
+					KernelMountOptions: "ms_mode=secure",
+				}
+
+				return want
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := MergeClusterInfo(base, tt.override)
+			require.Equal(t, tt.want, got)
+
+			// the result should not share the slices with base
+			got.Monitors[0] = "changed"
+			require.Equal(t, "mon1", base.Monitors[0])
+		})
+	}
+}
+
+func TestIsClusterReadOnly(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      bool
+		wantErr   bool
+	}{
+		{
+			name:      "read-only cluster",
+			clusterID: "cluster-1",
+			want:      true,
+		},
+		{
+			name:      "read-write cluster",
+			clusterID: "cluster-2",
+			want:      false,
+		},
+		{
+			name:      "when readOnly is absent",
+			clusterID: "cluster-3",
+			want:      false,
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	csiConfigFileContent := []byte(`[
+		{"clusterID": "cluster-1", "readOnly": true},
+		{"clusterID": "cluster-2", "readOnly": false},
+		{"clusterID": "cluster-3"}
+	]`)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err := os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := IsClusterReadOnly(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IsClusterReadOnly() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("IsClusterReadOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClusterInfoByVolumeID(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1:6789", "ip-2:6789"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	composeVolID := func(clusterID string) string {
+		vi := CSIIdentifier{
+			LocationID: 2,
+			ClusterID:  clusterID,
+			ObjectUUID: "02346b2e-0f8a-4d9b-8a4b-0e1b0fbf8a4b",
+		}
+		volID, cErr := vi.ComposeCSIID()
+		if cErr != nil {
+			t.Fatalf("failed to compose volume ID: %v", cErr)
+		}
+
+		return volID
+	}
+
+	tests := []struct {
+		name          string
+		volumeID      string
+		wantClusterID string
+		wantErr       bool
+	}{
+		{
+			name:          "well-formed handle",
+			volumeID:      composeVolID("cluster-1"),
+			wantClusterID: "cluster-1",
+		},
+		{
+			name:     "unknown cluster",
+			volumeID: composeVolID("cluster-2"),
+			wantErr:  true,
+		},
+		{
+			name:     "garbage handle",
+			volumeID: "this-is-not-a-volume-handle",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetClusterInfoByVolumeID(tmpConfPath, tt.volumeID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetClusterInfoByVolumeID() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !tt.wantErr && got.ClusterID != tt.wantClusterID {
+				t.Errorf("GetClusterInfoByVolumeID() = %v, want %v", got.ClusterID, tt.wantClusterID)
+			}
+		})
+	}
+}
+
+func TestMonsOrdered(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "all monitors prioritized",
+			clusterID: "cluster-1",
+			want:      "mon3,mon1,mon2",
+		},
+		{
+			name:      "unprioritized monitors keep their order",
+			clusterID: "cluster-2",
+			want:      "mon4,mon2,mon1,mon3,mon5",
+		},
+		{
+			name:      "without priorities",
+			clusterID: "cluster-3",
+			want:      "mon2,mon1,mon3",
+		},
+		{
+			name:      "empty monitor list",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+		{
+			name:      "prefer msgr2 for monitors without port",
+			clusterID: "cluster-5",
+			want:      "10.0.0.2:3300,10.0.0.1:6789",
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID:         "cluster-1",
+			Monitors:          []string{"mon1", "mon2", "mon3"},
+			MonitorPriorities: map[string]int{"mon1": 2, "mon2": 3, "mon3": 1},
+		},
+		{
+			ClusterID:         "cluster-2",
+			Monitors:          []string{"mon1", "mon2", "mon3", "mon4", "mon5"},
+			MonitorPriorities: map[string]int{"mon2": 10, "mon4": -1, "unknown": 0},
+		},
+		{
+			ClusterID: "cluster-3",
+			Monitors:  []string{"mon2", "mon1", "mon3"},
+		},
+		{
+			ClusterID: "cluster-4",
+		},
+		{
+			ClusterID:         "cluster-5",
+			Monitors:          []string{"10.0.0.1:6789", "10.0.0.2"},
+			MonitorPriorities: map[string]int{"10.0.0.2": 1},
+			PreferMsgr2:       true,
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := MonsOrdered(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MonsOrdered() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("MonsOrdered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRBDMetadataPool(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{MetadataPool: "metadata"},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "metadata pool for cluster-1",
+			clusterID: "cluster-1",
+			want:      "metadata",
+		},
+		{
+			name:      "metadata pool not set for cluster-2",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "metadata pool for unknown cluster",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetRBDMetadataPool(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRBDMetadataPool() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetRBDMetadataPool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClientID(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{ClientID: "csi-rbd"},
+			CephFS:    cephcsi.CephFS{ClientID: "csi-cephfs"},
+			NFS:       cephcsi.NFS{ClientID: "csi-nfs"},
+		},
+		{
+			ClusterID: "cluster-2",
+			RBD:       cephcsi.RBD{ClientID: "csi-rbd"},
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	getters := map[string]func(string, string) (string, error){
+		"GetRBDClientID":    GetRBDClientID,
+		"GetCephFSClientID": GetCephFSClientID,
+		"GetNFSClientID":    GetNFSClientID,
+	}
+
+	tests := []struct {
+		name      string
+		getter    string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "rbd user for cluster-1",
+			getter:    "GetRBDClientID",
+			clusterID: "cluster-1",
+			want:      "csi-rbd",
+		},
+		{
+			name:      "cephfs user for cluster-1",
+			getter:    "GetCephFSClientID",
+			clusterID: "cluster-1",
+			want:      "csi-cephfs",
+		},
+		{
+			name:      "nfs user for cluster-1",
+			getter:    "GetNFSClientID",
+			clusterID: "cluster-1",
+			want:      "csi-nfs",
+		},
+		{
+			name:      "rbd user for cluster-2",
+			getter:    "GetRBDClientID",
+			clusterID: "cluster-2",
+			want:      "csi-rbd",
+		},
+		{
+			name:      "cephfs user not set for cluster-2",
+			getter:    "GetCephFSClientID",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "nfs user not set for cluster-2",
+			getter:    "GetNFSClientID",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "rbd user not set for cluster-3",
+			getter:    "GetRBDClientID",
+			clusterID: "cluster-3",
+			want:      "",
+		},
+		{
+			name:      "rbd user for unknown cluster",
+			getter:    "GetRBDClientID",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+		{
+			name:      "cephfs user for unknown cluster",
+			getter:    "GetCephFSClientID",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+		{
+			name:      "nfs user for unknown cluster",
+			getter:    "GetNFSClientID",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getters[tt.getter](tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%s() error = %v, wantErr %v", tt.getter, err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("%s() = %v, want %v", tt.getter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	oldClusters := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"mon1"},
+		},
+	}
+	newClusters := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"mon1", "mon2"},
+		},
+	}
+
+	writeConfig := func(t *testing.T) string {
+		t.Helper()
+
+		content, err := json.Marshal(oldClusters)
+		require.NoError(t, err)
+		configPath := t.TempDir() + "/ceph-csi.json"
+		require.NoError(t, os.WriteFile(configPath, content, 0o600))
+
+		return configPath
+	}
+
+	t.Run("rotate config", func(t *testing.T) {
+		t.Parallel()
+		configPath := writeConfig(t)
+		old, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+
+		backupPath, err := RotateCSIConfig(configPath, newClusters)
+		require.NoError(t, err)
+		require.NotEmpty(t, backupPath)
+
+		backup, err := os.ReadFile(backupPath)
+		require.NoError(t, err)
+		require.Equal(t, old, backup)
+
+		config, err := readCSIConfig(configPath)
+		require.NoError(t, err)
+		require.Equal(t, newClusters, config)
+
+		info, err := os.Stat(configPath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("rotate config in canonical order", func(t *testing.T) {
+		t.Parallel()
+		configPath := writeConfig(t)
+
+		unsorted := []cephcsi.ClusterInfo{
+			{
+				ClusterID: "cluster-2",
+				Monitors:  []string{"mon4", "mon3"},
+			},
+			newClusters[0],
+		}
+		_, err := RotateCSIConfig(configPath, unsorted)
+		require.NoError(t, err)
+
+		config, err := readCSIConfig(configPath)
+		require.NoError(t, err)
+		require.Equal(t, CanonicalizeCSIConfig(unsorted), config)
+	})
+
+	t.Run("no previous config", func(t *testing.T) {
+		t.Parallel()
+		configPath := t.TempDir() + "/ceph-csi.json"
+
+		backupPath, err := RotateCSIConfig(configPath, newClusters)
+		require.NoError(t, err)
+		require.Empty(t, backupPath)
+
+		config, err := readCSIConfig(configPath)
+		require.NoError(t, err)
+		require.Equal(t, newClusters, config)
+	})
+
+	t.Run("failure to write the config", func(t *testing.T) {
+		t.Parallel()
+		configPath := writeConfig(t)
+		old, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+
+		errWrite := errors.New("disk full")
+		failingWrite := func(path string, data []byte, perm os.FileMode) error {
+			if path == configPath {
+				return errWrite
+			}
+
+			return writeFileAtomic(path, data, perm)
+		}
+
+		backupPath, err := rotateCSIConfig(configPath, newClusters, failingWrite)
+		require.ErrorIs(t, err, errWrite)
+		require.Empty(t, backupPath)
+
+		content, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Equal(t, old, content)
+
+		// only the config remains, the backup has been removed
+		entries, err := os.ReadDir(filepath.Dir(configPath))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+}
+
+func TestGetCephFSFsName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "cluster-1 with fsName",
+			clusterID: "cluster-1",
+			want:      "myfs",
+		},
+		{
+			name:      "cluster-2 with empty fsName",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "cluster-3 without cephFS options",
+			clusterID: "cluster-3",
+			want:      "",
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			CephFS: cephcsi.CephFS{
+				FsName: "myfs",
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			CephFS: cephcsi.CephFS{
+				FsName: "",
+			},
+		},
+		{
+			ClusterID: "cluster-3",
+			CephFS:    cephcsi.CephFS{},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetCephFSFsName(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetCephFSFsName() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetCephFSFsName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTopologyConstrainedPools(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD: cephcsi.RBD{
+				TopologyConstrainedPools: []cephcsi.TopologyPool{
+					{
+						PoolName: "pool-zone1",
+						DomainSegments: []cephcsi.TopologySegment{
+							{DomainLabel: "region", DomainValue: "east"},
+							{DomainLabel: "zone", DomainValue: "zone1"},
+						},
+					},
+					{
+						PoolName:     "pool-zone2",
+						DataPoolName: "ec-pool-zone2",
+						DomainSegments: []cephcsi.TopologySegment{
+							{DomainLabel: "region", DomainValue: "east"},
+							{DomainLabel: "zone", DomainValue: "zone2"},
+						},
+					},
+				},
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		want      []TopologyConstrainedPool
+		wantErr   bool
+	}{
+		{
+			name:      "cluster-1 with two topology domains",
+			clusterID: "cluster-1",
+			want: []TopologyConstrainedPool{
+				{
+					PoolName: "pool-zone1",
+					DomainSegments: []topologySegment{
+						{DomainLabel: "region", DomainValue: "east"},
+						{DomainLabel: "zone", DomainValue: "zone1"},
+					},
+				},
+				{
+					PoolName:     "pool-zone2",
+					DataPoolName: "ec-pool-zone2",
+					DomainSegments: []topologySegment{
+						{DomainLabel: "region", DomainValue: "east"},
+						{DomainLabel: "zone", DomainValue: "zone2"},
+					},
+				},
+			},
+		},
+		{
+			name:      "cluster-2 without topology constrained pools",
+			clusterID: "cluster-2",
+			want:      nil,
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetTopologyConstrainedPools(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetTopologyConstrainedPools() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	// the pools from the config can be matched against a topology
+	pools, err := GetTopologyConstrainedPools(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	poolName, dataPoolName, _, err := FindPoolAndTopology(&pools, &csi.TopologyRequirement{
+		Preferred: []*csi.Topology{
+			{
+				Segments: map[string]string{
+					"prefix/region": "east",
+					"prefix/zone":   "zone2",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pool-zone2", poolName)
+	require.Equal(t, "ec-pool-zone2", dataPoolName)
+}
+
+func TestGetClusterLogLevel(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      int
+		wantErr   bool
+	}{
+		{
+			name:      "cluster-1 with log level",
+			clusterID: "cluster-1",
+			want:      5,
+		},
+		{
+			name:      "cluster-2 without log level",
+			clusterID: "cluster-2",
+			want:      int(log.Verbosity()),
+		},
+		{
+			name:      "cluster-3 with log level 0",
+			clusterID: "cluster-3",
+			want:      0,
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			LogLevel:  ptr.To[cephcsi.FlexInt](5),
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+		{
+			ClusterID: "cluster-3",
+			LogLevel:  ptr.To[cephcsi.FlexInt](0),
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetClusterLogLevel(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetClusterLogLevel() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetClusterLogLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClusterLogDir(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "cluster-1 with log directory",
+			clusterID: "cluster-1",
+			want:      "/var/log/ceph/cluster-1",
+		},
+		{
+			name:      "cluster-2 without log directory",
+			clusterID: "cluster-2",
+			want:      "",
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			LogDir:    "/var/log/ceph/cluster-1",
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetClusterLogDir(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetClusterLogDir() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetClusterLogDir() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCephConfFile(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	confFile := tmpDir + "/ceph.conf"
+	err := os.WriteFile(confFile, []byte("[global]\n"), 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		clusterID string
+		validate  bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "cluster-1 with existing file",
+			clusterID: "cluster-1",
+			want:      confFile,
+		},
+		{
+			name:      "cluster-1 with validation",
+			clusterID: "cluster-1",
+			validate:  true,
+			want:      confFile,
+		},
+		{
+			name:      "cluster-2 with missing file",
+			clusterID: "cluster-2",
+			want:      tmpDir + "/missing.conf",
+		},
+		{
+			name:      "cluster-2 with missing file and validation",
+			clusterID: "cluster-2",
+			validate:  true,
+			wantErr:   true,
+		},
+		{
+			name:      "cluster-3 with directory and validation",
+			clusterID: "cluster-3",
+			validate:  true,
+			wantErr:   true,
+		},
+		{
+			name:      "cluster-4 without file",
+			clusterID: "cluster-4",
+			validate:  true,
+			want:      "",
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-5",
+			wantErr:   true,
+		},
+	}
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID:    "cluster-1",
+			CephConfFile: confFile,
+		},
+		{
+			ClusterID:    "cluster-2",
+			CephConfFile: tmpDir + "/missing.conf",
+		},
+		{
+			ClusterID:    "cluster-3",
+			CephConfFile: tmpDir,
+		},
+		{
+			ClusterID: "cluster-4",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := tmpDir + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got string
+			var err error
+			if tt.validate {
+				var cluster *cephcsi.ClusterInfo
+				cluster, err = readClusterInfo(tmpConfPath, tt.clusterID)
+				if err == nil {
+					got, err = checkCephConfFile(cluster, true)
+				}
+			} else {
+				got, err = GetCephConfFile(tmpConfPath, tt.clusterID)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetCephConfFile() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetCephConfFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonsForClusters(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+		},
+		{
+			ClusterID: "cluster-2",
+			Monitors:  []string{"10.1.0.1:6789"},
+		},
+		{
+			ClusterID: "cluster-3",
+		},
+		{
+			ClusterID:   "cluster-5",
+			Monitors:    []string{"10.2.0.1", "10.2.0.2:6789"},
+			PreferMsgr2: true,
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name        string
+		clusterIDs  []string
+		want        map[string]string
+		wantMissing []string
+	}{
+		{
+			name:       "all clusters present",
+			clusterIDs: []string{"cluster-1", "cluster-2"},
+			want: map[string]string{
+				"cluster-1": "10.0.0.1:6789,10.0.0.2:6789",
+				"cluster-2": "10.1.0.1:6789",
+			},
+		},
+		{
+			name:       "some clusters missing",
+			clusterIDs: []string{"cluster-1", "cluster-3", "cluster-4"},
+			want: map[string]string{
+				"cluster-1": "10.0.0.1:6789,10.0.0.2:6789",
+			},
+			wantMissing: []string{"cluster-3", "cluster-4"},
+		},
+		{
+			name:       "msgr2 port added like Mons",
+			clusterIDs: []string{"cluster-5"},
+			want: map[string]string{
+				"cluster-5": "10.2.0.1:3300,10.2.0.2:6789",
+			},
+		},
+		{
+			name:       "no clusters",
+			clusterIDs: []string{},
+			want:       map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := MonsForClusters(tmpConfPath, tt.clusterIDs)
+			require.Equal(t, tt.want, got)
+			if len(tt.wantMissing) == 0 {
+				require.NoError(t, err)
+
+				return
+			}
+			require.Error(t, err)
+			for _, clusterID := range tt.wantMissing {
+				require.ErrorContains(t, err, clusterID)
+			}
+			require.NotContains(t, err.Error(), "cluster-1")
+		})
+	}
+
+	_, err = MonsForClusters(t.TempDir()+"/missing.json", []string{"cluster-1"})
+	require.Error(t, err)
+}
+
+func TestGetMaxSnapshotsPerVolume(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD:       cephcsi.RBD{MaxSnapshotsPerVolume: 10},
+			CephFS:    cephcsi.CephFS{MaxSnapshotsPerVolume: 5},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+		{
+			ClusterID: "cluster-3",
+			RBD:       cephcsi.RBD{MaxSnapshotsPerVolume: -1},
+			CephFS:    cephcsi.CephFS{MaxSnapshotsPerVolume: -1},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	getters := map[string]func(string, string) (int, error){
+		"GetRBDMaxSnapshotsPerVolume":    GetRBDMaxSnapshotsPerVolume,
+		"GetCephFSMaxSnapshotsPerVolume": GetCephFSMaxSnapshotsPerVolume,
+	}
+
+	tests := []struct {
+		name      string
+		getter    string
+		clusterID string
+		want      int
+		wantErr   bool
+	}{
+		{
+			name:      "rbd limit for cluster-1",
+			getter:    "GetRBDMaxSnapshotsPerVolume",
+			clusterID: "cluster-1",
+			want:      10,
+		},
+		{
+			name:      "cephfs limit for cluster-1",
+			getter:    "GetCephFSMaxSnapshotsPerVolume",
+			clusterID: "cluster-1",
+			want:      5,
+		},
+		{
+			name:      "rbd unlimited for cluster-2",
+			getter:    "GetRBDMaxSnapshotsPerVolume",
+			clusterID: "cluster-2",
+			want:      0,
+		},
+		{
+			name:      "cephfs unlimited for cluster-2",
+			getter:    "GetCephFSMaxSnapshotsPerVolume",
+			clusterID: "cluster-2",
+			want:      0,
+		},
+		{
+			name:      "rbd negative limit",
+			getter:    "GetRBDMaxSnapshotsPerVolume",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+		{
+			name:      "cephfs negative limit",
+			getter:    "GetCephFSMaxSnapshotsPerVolume",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+		{
+			name:      "unknown cluster",
+			getter:    "GetRBDMaxSnapshotsPerVolume",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getters[tt.getter](tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%s() error = %v, wantErr %v", tt.getter, err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("%s() = %v, want %v", tt.getter, got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // modifies the global in-memory config
+func TestInMemoryCSIConfig(t *testing.T) {
+	defer SetInMemoryCSIConfig(nil)
+
+	// nothing registered
+	_, err := Mons(InMemoryCSIConfig, "cluster-1")
+	require.Error(t, err)
+
+	clusters := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"mon1:6789", "mon2:6789"},
+			RBD:       cephcsi.RBD{RadosNamespace: "ns"},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+	}
+	SetInMemoryCSIConfig(clusters)
+
+	mons, err := Mons(InMemoryCSIConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon1:6789,mon2:6789", mons)
+
+	_, err = Mons(InMemoryCSIConfig, "cluster-2")
+	require.Error(t, err)
+
+	cluster, err := GetClusterInfo(InMemoryCSIConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, clusters[0], *cluster)
+
+	_, err = GetClusterInfo(InMemoryCSIConfig, "cluster-3")
+	require.Error(t, err)
+
+	// the default mirror daemon count does not need a config file
+	count, err := GetRBDMirrorDaemonCount(InMemoryCSIConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// the registered config is a copy, it is not affected by modifications
+	clusters[0].Monitors[0] = "mon3:6789"
+	cluster.Monitors[1] = "mon4:6789"
+	mons, err = Mons(InMemoryCSIConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon1:6789,mon2:6789", mons)
+
+	// the config file is still used for other paths
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, []byte(`[{"clusterID": "cluster-1", "monitors": ["mon5:6789"]}]`), 0o600)
+	require.NoError(t, err)
+	mons, err = Mons(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon5:6789", mons)
+
+	SetInMemoryCSIConfig(nil)
+	_, err = GetClusterInfo(InMemoryCSIConfig, "cluster-1")
+	require.Error(t, err)
+}
+
+func TestGetCephFSSnapshotRetention(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			CephFS:    cephcsi.CephFS{SnapshotRetentionCount: 7},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+		{
+			ClusterID: "cluster-3",
+			CephFS:    cephcsi.CephFS{SnapshotRetentionCount: -1},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		want      int
+		wantErr   bool
+	}{
+		{
+			name:      "retention count set",
+			clusterID: "cluster-1",
+			want:      7,
+		},
+		{
+			name:      "unlimited when not set",
+			clusterID: "cluster-2",
+			want:      0,
+		},
+		{
+			name:      "negative retention count",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-4",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetCephFSSnapshotRetention(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetCephFSSnapshotRetention() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetCephFSSnapshotRetention() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCephFSForceKernelClient(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			CephFS:    cephcsi.CephFS{ForceKernelClient: true},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		want      bool
+		wantErr   bool
+	}{
+		{
+			name:      "kernel client forced",
+			clusterID: "cluster-1",
+			want:      true,
+		},
+		{
+			name:      "disabled when not set",
+			clusterID: "cluster-2",
+			want:      false,
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetCephFSForceKernelClient(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetCephFSForceKernelClient() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetCephFSForceKernelClient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRBDPool(t *testing.T) {
+	t.Parallel()
+
+	topologyPools := []cephcsi.TopologyPool{
+		{
+			PoolName: "pool-zone-a",
+			DomainSegments: []cephcsi.TopologySegment{
+				{DomainLabel: "zone", DomainValue: "zone-a"},
+			},
+		},
+	}
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD: cephcsi.RBD{
+				DefaultPool:              "replicapool",
+				TopologyConstrainedPools: topologyPools,
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			RBD:       cephcsi.RBD{TopologyConstrainedPools: topologyPools},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	zoneA := map[string]string{"topology.rbd.csi.ceph.com/zone": "zone-a"}
+	zoneB := map[string]string{"topology.rbd.csi.ceph.com/zone": "zone-b"}
+
+	tests := []struct {
+		name         string
+		clusterID    string
+		scPool       string
+		nodeTopology map[string]string
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "StorageClass pool takes precedence",
+			clusterID:    "cluster-1",
+			scPool:       "sc-pool",
+			nodeTopology: zoneA,
+			want:         "sc-pool",
+		},
+		{
+			name:         "topology matched pool",
+			clusterID:    "cluster-1",
+			nodeTopology: zoneA,
+			want:         "pool-zone-a",
+		},
+		{
+			name:         "cluster default pool without topology match",
+			clusterID:    "cluster-1",
+			nodeTopology: zoneB,
+			want:         "replicapool",
+		},
+		{
+			name:      "cluster default pool without topology",
+			clusterID: "cluster-1",
+			want:      "replicapool",
+		},
+		{
+			name:         "no pool resolves",
+			clusterID:    "cluster-2",
+			nodeTopology: zoneB,
+			wantErr:      true,
+		},
+		{
+			name:      "unknown cluster",
+			clusterID: "cluster-3",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ResolveRBDPool(tmpConfPath, tt.clusterID, tt.scPool, tt.nodeTopology)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveRBDPool() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRBDPool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCSIConfigMap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  []cephcsi.ClusterInfo
+		want    map[string]cephcsi.ClusterInfo
+		wantErr bool
+	}{
+		{
+			name: "unique cluster IDs",
+			config: []cephcsi.ClusterInfo{
+				{ClusterID: "cluster-1", Monitors: []string{"mon1:6789"}},
+				{ClusterID: "cluster-2", Monitors: []string{"mon2:6789"}},
+			},
+			want: map[string]cephcsi.ClusterInfo{
+				"cluster-1": {ClusterID: "cluster-1", Monitors: []string{"mon1:6789"}},
+				"cluster-2": {ClusterID: "cluster-2", Monitors: []string{"mon2:6789"}},
+			},
+		},
+		{
+			name:   "empty config",
+			config: []cephcsi.ClusterInfo{},
+			want:   map[string]cephcsi.ClusterInfo{},
+		},
+		{
+			name: "duplicate cluster IDs",
+			config: []cephcsi.ClusterInfo{
+				{ClusterID: "cluster-1", Monitors: []string{"mon1:6789"}},
+				{ClusterID: "cluster-1", Monitors: []string{"mon2:6789"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := json.Marshal(tt.config)
+			require.NoError(t, err)
+			tmpConfPath := t.TempDir() + "/ceph-csi.json"
+			require.NoError(t, os.WriteFile(tmpConfPath, content, 0o600))
+
+			got, err := LoadCSIConfigMap(tmpConfPath)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := LoadCSIConfigMap(t.TempDir() + "/missing.json")
+	require.Error(t, err)
+}
+
+func TestCSIConfigYAML(t *testing.T) {
+	t.Parallel()
+
+	content := `# clusters templated with Helm
+- clusterID: cluster-1
+  monitors:
+    - mon1:6789
+    - mon2:6789
+  logLevel: "3"
+  rbd:
+    radosNamespace: rbd-ns
+    mirrorDaemonCount: 2
+- clusterID: cluster-2
+  monitors: [mon3:6789]
+  readOnly: "true"
+`
+	pathToConfig := t.TempDir() + "/config.json"
+	require.NoError(t, os.WriteFile(pathToConfig, []byte(content), 0o600))
+
+	mons, err := Mons(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon1:6789,mon2:6789", mons)
+
+	cluster, err := GetClusterInfo(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "rbd-ns", cluster.RBD.RadosNamespace)
+	require.Equal(t, ptr.To[cephcsi.FlexInt](3), cluster.LogLevel)
+
+	count, err := GetRBDMirrorDaemonCount(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	readOnly, err := IsClusterReadOnly(pathToConfig, "cluster-2")
+	require.NoError(t, err)
+	require.True(t, readOnly)
+
+	// the same config in JSON is parsed to the same clusters
+	fromYAML, err := ParseCSIConfig([]byte(content))
+	require.NoError(t, err)
+	jsonContent, err := json.Marshal(fromYAML)
+	require.NoError(t, err)
+	fromJSON, err := ParseCSIConfig(jsonContent)
+	require.NoError(t, err)
+	require.Equal(t, fromJSON, fromYAML)
+
+	_, err = ParseCSIConfig([]byte("- clusterID: [cluster-1"))
+	require.Error(t, err)
+}
+
+func TestParseCSIConfigStrictYAML(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseCSIConfigStrict([]byte("- clusterID: cluster-1\n  monitors: [mon1:6789]\n"))
+	require.NoError(t, err)
+
+	typo := "- clusterID: cluster-1\n  monitorss: [mon1:6789]\n"
+	_, err = ParseCSIConfig([]byte(typo))
+	require.NoError(t, err)
+	_, err = ParseCSIConfigStrict([]byte(typo))
+	require.Error(t, err)
+
+	duplicate := "- clusterID: cluster-1\n  clusterID: cluster-2\n"
+	_, err = ParseCSIConfigStrict([]byte(duplicate))
+	require.Error(t, err)
+}
+
+func TestListClusterIDs(t *testing.T) {
+	t.Parallel()
+
+	config := []cephcsi.ClusterInfo{
+		{ClusterID: "cluster-2", Monitors: []string{"mon2:6789"}},
+		{ClusterID: "cluster-1", Monitors: []string{"mon1:6789"}},
+		{ClusterID: "cluster-2", Monitors: []string{"mon3:6789"}},
+	}
+	content, err := json.Marshal(config)
+	require.NoError(t, err)
+	pathToConfig := t.TempDir() + "/ceph-csi.json"
+	require.NoError(t, os.WriteFile(pathToConfig, content, 0o600))
+
+	clusterIDs, err := ListClusterIDs(pathToConfig)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cluster-2", "cluster-1"}, clusterIDs)
+
+	_, err = ListClusterIDs(t.TempDir() + "/missing.json")
+	require.Error(t, err)
+}
+
+func TestParseCSIConfigStrict(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		content       string
+		want          []cephcsi.ClusterInfo
+		wantLenient   bool
+		wantStrictErr bool
+	}{
+		{
+			name:    "valid config",
+			content: `[{"clusterID":"cluster-1","monitors":["mon1:6789"],"rbd":{"radosNamespace":"ns"}}]`,
+			want: []cephcsi.ClusterInfo{{
+				ClusterID: "cluster-1",
+				Monitors:  []string{"mon1:6789"},
+				RBD:       cephcsi.RBD{RadosNamespace: "ns"},
+			}},
+			wantLenient: true,
+		},
+		{
+			name:          "typo in top-level key",
+			content:       `[{"clusterID":"cluster-1","monitorss":["mon1:6789"]}]`,
+			wantLenient:   true,
+			wantStrictErr: true,
+		},
+		{
+			name:          "typo in nested key",
+			content:       `[{"clusterID":"cluster-1","monitors":["mon1:6789"],"rbd":{"radosNamespaec":"ns"}}]`,
+			wantLenient:   true,
+			wantStrictErr: true,
+		},
+		{
+			name:          "trailing data",
+			content:       `[{"clusterID":"cluster-1"}]]`,
+			wantStrictErr: true,
+		},
+		{
+			name:          "invalid JSON",
+			content:       `[{"clusterID":`,
+			wantStrictErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseCSIConfig([]byte(tt.content))
+			if tt.wantLenient {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			got, err := ParseCSIConfigStrict([]byte(tt.content))
+			if tt.wantStrictErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+//nolint:paralleltest // modifies the global default cluster
+func TestDefaultClusterInfo(t *testing.T) {
+	defer SetDefaultClusterFallback(false)
+	defer SetDefaultClusterInfo(nil)
+
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err := os.WriteFile(tmpConfPath, []byte(`[{"clusterID": "cluster-1", "monitors": ["mon1:6789"]}]`), 0o600)
+	require.NoError(t, err)
+
+	fallback := &cephcsi.ClusterInfo{
+		ClusterID: "default",
+		Monitors:  []string{"mon2:6789", "mon3:6789"},
+	}
+	SetDefaultClusterInfo(fallback)
+	// the registered default is a copy
+	fallback.Monitors[0] = "mon4:6789"
+
+	// fallback disabled
+	_, err = GetClusterInfo(tmpConfPath, "cluster-2")
+	require.Error(t, err)
+	_, err = Mons(tmpConfPath, "cluster-2")
+	require.Error(t, err)
+
+	// fallback enabled
+	SetDefaultClusterFallback(true)
+	cluster, err := GetClusterInfo(tmpConfPath, "cluster-2")
+	require.NoError(t, err)
+	require.Equal(t, "cluster-2", cluster.ClusterID)
+	require.Equal(t, []string{"mon2:6789", "mon3:6789"}, cluster.Monitors)
+	mons, err := Mons(tmpConfPath, "cluster-2")
+	require.NoError(t, err)
+	require.Equal(t, "mon2:6789,mon3:6789", mons)
+
+	// configured clusters are not affected
+	mons, err = Mons(tmpConfPath, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon1:6789", mons)
+
+	// fallback enabled without a registered default
+	SetDefaultClusterInfo(nil)
+	_, err = GetClusterInfo(tmpConfPath, "cluster-2")
+	require.Error(t, err)
+}
+
+func TestIsReadBalancingEnabled(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		clusterID        string
+		want             bool
+		wantReadAffinity bool
+		wantErr          bool
+	}{
+		{
+			name:      "read balancing enabled",
+			clusterID: "cluster-1",
+			want:      true,
+		},
+		{
+			name:      "read balancing disabled",
+			clusterID: "cluster-2",
+			want:      false,
+		},
+		{
+			name:      "when readBalancing is absent",
+			clusterID: "cluster-3",
+			want:      false,
+		},
+		{
+			name:             "read affinity does not enable read balancing",
+			clusterID:        "cluster-4",
+			want:             false,
+			wantReadAffinity: true,
+		},
+		{
+			name:             "read balancing together with read affinity",
+			clusterID:        "cluster-5",
+			want:             true,
+			wantReadAffinity: true,
+		},
+		{
+			name:      "when cluster is not found",
+			clusterID: "cluster-6",
+			wantErr:   true,
+		},
+	}
+
+	csiConfigFileContent := []byte(`[
+		{"clusterID": "cluster-1", "readBalancing": true},
+		{"clusterID": "cluster-2", "readBalancing": false},
+		{"clusterID": "cluster-3"},
+		{"clusterID": "cluster-4", "readAffinity": {"enabled": true, "crushLocationLabels": ["zone"]}},
+		{"clusterID": "cluster-5", "readBalancing": "true",
+			"readAffinity": {"enabled": true, "crushLocationLabels": ["zone"]}}
+	]`)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err := os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := IsReadBalancingEnabled(tmpConfPath, tt.clusterID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IsReadBalancingEnabled() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got != tt.want {
+				t.Errorf("IsReadBalancingEnabled() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			readAffinity, _, err := GetCrushLocationLabels(tmpConfPath, tt.clusterID)
+			if err != nil {
+				t.Errorf("GetCrushLocationLabels() error = %v", err)
+			}
+			if readAffinity != tt.wantReadAffinity {
+				t.Errorf("GetCrushLocationLabels() = %v, want %v", readAffinity, tt.wantReadAffinity)
+			}
+		})
+	}
+}
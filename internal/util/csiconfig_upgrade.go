@@ -0,0 +1,182 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+// legacyClusterFields are the fields of a cluster in old versions of the CSI
+// config, that moved or changed their type in the current version.
+type legacyClusterFields struct {
+	// Monitors can be a list, or a comma separated string
+	Monitors json.RawMessage `json:"monitors"`
+	// RadosNamespace moved to rbd.radosNamespace
+	RadosNamespace string `json:"radosNamespace"`
+	// SubvolumeGroup moved to cephFS.subvolumeGroup
+	SubvolumeGroup string `json:"subvolumeGroup"`
+}
+
+// UpgradeCSIConfig converts a CSI config in one of the legacy formats into
+// the current format. The following formats are accepted:
+//
+//   - a list of clusters, where the monitors can be a comma separated string,
+//     and radosNamespace and subvolumeGroup are set at the top of a cluster
+//   - a single cluster, in the same format as the clusters in the list
+//   - an object with the clusterIDs as keys, and the monitors as values
+//
+// Clusters that are already in the current format are returned unmodified.
+// The sections of a cluster that are not in the legacy config are empty.
+func UpgradeCSIConfig(oldJSON []byte) ([]kubernetes.ClusterInfo, error) {
+	oldJSON = bytes.TrimSpace(oldJSON)
+	if len(oldJSON) == 0 {
+		return nil, errors.New("empty CSI config")
+	}
+
+	var clusters []json.RawMessage
+	switch oldJSON[0] {
+	case '[':
+		if err := json.Unmarshal(oldJSON, &clusters); err != nil {
+			return nil, fmt.Errorf("failed to parse CSI config: %w", err)
+		}
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(oldJSON, &fields); err != nil {
+			return nil, fmt.Errorf("failed to parse CSI config: %w", err)
+		}
+
+		_, hasClusterID := fields["clusterID"]
+		_, hasMonitors := fields["monitors"]
+		if !hasClusterID && !hasMonitors {
+			return upgradeMonitorsMap(fields)
+		}
+		clusters = []json.RawMessage{oldJSON}
+	default:
+		return nil, errors.New("CSI config is not a JSON list or object")
+	}
+
+	config := make([]kubernetes.ClusterInfo, 0, len(clusters))
+	for i, raw := range clusters {
+		cluster, err := upgradeCluster(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upgrade cluster #%d: %w", i, err)
+		}
+		config = append(config, *cluster)
+	}
+
+	return config, nil
+}
+
+// upgradeMonitorsMap converts the object with the clusterIDs as keys and the
+// monitors as values. The clusters are sorted by their clusterID.
+func upgradeMonitorsMap(fields map[string]json.RawMessage) ([]kubernetes.ClusterInfo, error) {
+	clusterIDs := make([]string, 0, len(fields))
+	for clusterID := range fields {
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	slices.Sort(clusterIDs)
+
+	config := make([]kubernetes.ClusterInfo, 0, len(clusterIDs))
+	for _, clusterID := range clusterIDs {
+		mons, err := parseLegacyMonitors(fields[clusterID])
+		if err != nil {
+			return nil, fmt.Errorf("invalid monitors for cluster ID %q: %w", clusterID, err)
+		}
+		config = append(config, kubernetes.ClusterInfo{ClusterID: clusterID, Monitors: mons})
+	}
+
+	return config, nil
+}
+
+// upgradeCluster converts a single cluster. The fields of the current format
+// take precedence over the legacy fields, when both are set.
+func upgradeCluster(raw json.RawMessage) (*kubernetes.ClusterInfo, error) {
+	var legacy legacyClusterFields
+	err := json.Unmarshal(raw, &legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	// the monitors are parsed separately, as they may be a string
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "monitors")
+	current, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &kubernetes.ClusterInfo{}
+	err = json.Unmarshal(current, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if cluster.ClusterID == "" {
+		return nil, errors.New("missing clusterID")
+	}
+
+	cluster.Monitors, err = parseLegacyMonitors(legacy.Monitors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid monitors for cluster ID %q: %w", cluster.ClusterID, err)
+	}
+
+	if cluster.RBD.RadosNamespace == "" {
+		cluster.RBD.RadosNamespace = legacy.RadosNamespace
+	}
+	if cluster.CephFS.SubvolumeGroup == "" {
+		cluster.CephFS.SubvolumeGroup = legacy.SubvolumeGroup
+	}
+
+	return cluster, nil
+}
+
+// parseLegacyMonitors parses a list of monitors, or a comma separated string
+// of monitors.
+func parseLegacyMonitors(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	var mons []string
+	if err := json.Unmarshal(raw, &mons); err == nil {
+		return mons, nil
+	}
+
+	var monList string
+	if err := json.Unmarshal(raw, &monList); err != nil {
+		return nil, fmt.Errorf("monitors must be a list or a comma separated string, not %s", raw)
+	}
+
+	for _, mon := range strings.Split(monList, ",") {
+		if mon = strings.TrimSpace(mon); mon != "" {
+			mons = append(mons, mon)
+		}
+	}
+
+	return mons, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+func TestUpgradeCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		oldJSON string
+		want    []cephcsi.ClusterInfo
+		mons    map[string]string
+	}{
+		{
+			name: "flat list with monitor strings",
+			oldJSON: `[
+				{"clusterID": "cluster-1", "monitors": "10.0.0.1:6789, 10.0.0.2:6789"},
+				{"clusterID": "cluster-2", "monitors": ["10.0.1.1:6789"], "radosNamespace": "ns",
+				 "subvolumeGroup": "group"}
+			]`,
+			want: []cephcsi.ClusterInfo{
+				{ClusterID: "cluster-1", Monitors: []string{"10.0.0.1:6789", "10.0.0.2:6789"}},
+				{
+					ClusterID: "cluster-2",
+					Monitors:  []string{"10.0.1.1:6789"},
+					RBD:       cephcsi.RBD{RadosNamespace: "ns"},
+					CephFS:    cephcsi.CephFS{SubvolumeGroup: "group"},
+				},
+			},
+			mons: map[string]string{
+				"cluster-1": "10.0.0.1:6789,10.0.0.2:6789",
+				"cluster-2": "10.0.1.1:6789",
+			},
+		},
+		{
+			name:    "single cluster",
+			oldJSON: `{"clusterID": "cluster-1", "monitors": "10.0.0.1:6789"}`,
+			want: []cephcsi.ClusterInfo{
+				{ClusterID: "cluster-1", Monitors: []string{"10.0.0.1:6789"}},
+			},
+			mons: map[string]string{"cluster-1": "10.0.0.1:6789"},
+		},
+		{
+			name:    "monitors by clusterID",
+			oldJSON: `{"cluster-2": ["10.0.1.1:6789"], "cluster-1": "10.0.0.1:6789,10.0.0.2:6789"}`,
+			want: []cephcsi.ClusterInfo{
+				{ClusterID: "cluster-1", Monitors: []string{"10.0.0.1:6789", "10.0.0.2:6789"}},
+				{ClusterID: "cluster-2", Monitors: []string{"10.0.1.1:6789"}},
+			},
+			mons: map[string]string{
+				"cluster-1": "10.0.0.1:6789,10.0.0.2:6789",
+				"cluster-2": "10.0.1.1:6789",
+			},
+		},
+		{
+			name: "current format is kept",
+			oldJSON: `[{"clusterID": "cluster-1", "monitors": ["10.0.0.1:6789"], "radosNamespace": "old",
+				"rbd": {"radosNamespace": "new", "mounter": "rbd-nbd"}, "readAffinity": {"enabled": true}}]`,
+			want: []cephcsi.ClusterInfo{
+				{
+					ClusterID:    "cluster-1",
+					Monitors:     []string{"10.0.0.1:6789"},
+					RBD:          cephcsi.RBD{RadosNamespace: "new", Mounter: "rbd-nbd"},
+					ReadAffinity: cephcsi.ReadAffinity{Enabled: true},
+				},
+			},
+			mons: map[string]string{"cluster-1": "10.0.0.1:6789"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := UpgradeCSIConfig([]byte(tt.oldJSON))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+
+			// the upgraded config can be read by the driver
+			content, err := json.Marshal(got)
+			require.NoError(t, err)
+			path := t.TempDir() + "/ceph-csi.json"
+			require.NoError(t, os.WriteFile(path, content, 0o600))
+			for clusterID, want := range tt.mons {
+				mons, err := Mons(path, clusterID)
+				require.NoError(t, err)
+				require.Equal(t, want, mons)
+			}
+		})
+	}
+}
+
+func TestUpgradeCSIConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"empty":              "",
+		"not a list":         `"cluster-1"`,
+		"malformed":          `[{"clusterID": `,
+		"missing clusterID":  `{"monitors": "10.0.0.1:6789"}`,
+		"invalid monitors":   `[{"clusterID": "cluster-1", "monitors": 6789}]`,
+		"invalid map values": `{"cluster-1": {"monitors": "10.0.0.1:6789"}}`,
+	}
+
+	for name, oldJSON := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := UpgradeCSIConfig([]byte(oldJSON))
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// cachedCSIConfig is the parsed CSI config of a watched file.
+type cachedCSIConfig struct {
+	// config is nil until the config is read after an invalidation
+	config *csiConfig
+	// generation changes on every invalidation, so that a config that was
+	// read before the invalidation is not cached
+	generation uint64
+}
+
+var (
+	configCacheLock sync.Mutex
+	// configGeneration is the last generation of any cached config
+	configGeneration uint64
+	// configCache contains the CSI configs of the files that are watched
+	// with WatchCSIConfig(), by the path of the file
+	configCache = map[string]*cachedCSIConfig{}
+)
+
+// WatchCSIConfig caches the CSI config at pathToConfig, and watches its
+// directory for changes until the context is done. Any change in the
+// directory invalidates the cache, so that the next read of the config
+// parses the file again. Watching the directory instead of the file is
+// needed for ConfigMaps, as the kubelet updates them by replacing a symlink
+// in the directory. Paths that are not watched are read on every access.
+func WatchCSIConfig(ctx context.Context, pathToConfig string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher for %q: %w", pathToConfig, err)
+	}
+
+	dir := filepath.Dir(pathToConfig)
+	err = watcher.Add(dir)
+	if err != nil {
+		watcher.Close()
+
+		return fmt.Errorf("failed to watch directory %q of %q: %w", dir, pathToConfig, err)
+	}
+
+	configCacheLock.Lock()
+	if _, ok := configCache[pathToConfig]; ok {
+		configCacheLock.Unlock()
+		watcher.Close()
+
+		return fmt.Errorf("CSI config %q is already watched", pathToConfig)
+	}
+	configGeneration++
+	configCache[pathToConfig] = &cachedCSIConfig{generation: configGeneration}
+	configCacheLock.Unlock()
+
+	go watchCSIConfig(ctx, pathToConfig, watcher)
+
+	return nil
+}
+
+// watchCSIConfig invalidates the cached config at pathToConfig for the events
+// of the watcher, until the context is done.
+func watchCSIConfig(ctx context.Context, pathToConfig string, watcher *fsnotify.Watcher) {
+	defer func() {
+		watcher.Close()
+
+		configCacheLock.Lock()
+		delete(configCache, pathToConfig)
+		configCacheLock.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			log.DebugLogMsg("CSI config %q changed (%s), invalidating the cache", pathToConfig, event)
+			InvalidateCSIConfig(pathToConfig)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			// events may have been lost, do not keep a stale config
+			log.ErrorLogMsg("failed to watch CSI config %q: %v", pathToConfig, err)
+			InvalidateCSIConfig(pathToConfig)
+		}
+	}
+}
+
+// InvalidateCSIConfig drops the cached CSI config at pathToConfig, so that
+// the next read parses the file again. It is called when the watched file
+// changes, and can be called before retrying an operation that failed with
+// a monitor list that may be outdated. It is a no-op for paths that are not
+// watched.
+func InvalidateCSIConfig(pathToConfig string) {
+	configCacheLock.Lock()
+	defer configCacheLock.Unlock()
+
+	cached, ok := configCache[pathToConfig]
+	if !ok {
+		return
+	}
+
+	configGeneration++
+	cached.config = nil
+	cached.generation = configGeneration
+}
+
+// getCachedCSIConfig returns the cached CSI config at pathToConfig. When the
+// config is not cached, false is returned together with the generation that
+// needs to be passed to setCachedCSIConfig() after reading the config.
+func getCachedCSIConfig(pathToConfig string) (*csiConfig, uint64, bool) {
+	configCacheLock.Lock()
+	defer configCacheLock.Unlock()
+
+	cached, ok := configCache[pathToConfig]
+	if !ok {
+		return nil, 0, false
+	}
+	if cached.config == nil {
+		return nil, cached.generation, false
+	}
+
+	return cached.config, cached.generation, true
+}
+
+// setCachedCSIConfig caches the CSI config at pathToConfig, when the path is
+// watched and the cache was not invalidated since getCachedCSIConfig()
+// returned generation.
+func setCachedCSIConfig(pathToConfig string, generation uint64, config *csiConfig) {
+	configCacheLock.Lock()
+	defer configCacheLock.Unlock()
+
+	cached, ok := configCache[pathToConfig]
+	if !ok || cached.generation != generation {
+		return
+	}
+
+	cached.config = config
+}
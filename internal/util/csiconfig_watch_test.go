@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	watchTimeout  = 5 * time.Second
+	watchInterval = 10 * time.Millisecond
+)
+
+func writeMonitorConfig(t *testing.T, path, monitor string) {
+	t.Helper()
+
+	content := `[{"clusterID":"cluster-1","monitors":["` + monitor + `"]}]`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestWatchCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	pathToConfig := filepath.Join(t.TempDir(), "config.json")
+	writeMonitorConfig(t, pathToConfig, "mon1:6789")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, WatchCSIConfig(ctx, pathToConfig))
+	require.Error(t, WatchCSIConfig(ctx, pathToConfig), "a config can only be watched once")
+
+	mons, err := Mons(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon1:6789", mons)
+
+	_, _, cached := getCachedCSIConfig(pathToConfig)
+	require.True(t, cached)
+
+	// the cached clusters are looked up by their clusterID, without copies
+	first, err := readClusterInfo(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	second, err := readClusterInfo(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Same(t, first, second)
+
+	writeMonitorConfig(t, pathToConfig, "mon2:6789")
+	require.Eventually(t, func() bool {
+		mons, err = Mons(pathToConfig, "cluster-1")
+
+		return err == nil && mons == "mon2:6789"
+	}, watchTimeout, watchInterval)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		configCacheLock.Lock()
+		defer configCacheLock.Unlock()
+		_, watched := configCache[pathToConfig]
+
+		return !watched
+	}, watchTimeout, watchInterval)
+}
+
+func TestWatchCSIConfigMap(t *testing.T) {
+	t.Parallel()
+
+	// the kubelet mounts a ConfigMap as symlinks to the ..data symlink,
+	// which is replaced to update all files at once
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, version), 0o700))
+	}
+	writeMonitorConfig(t, filepath.Join(dir, "v1", "config.json"), "mon1:6789")
+	writeMonitorConfig(t, filepath.Join(dir, "v2", "config.json"), "mon2:6789")
+	require.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+	pathToConfig := filepath.Join(dir, "config.json")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.json"), pathToConfig))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, WatchCSIConfig(ctx, pathToConfig))
+
+	mons, err := Mons(pathToConfig, "cluster-1")
+	require.NoError(t, err)
+	require.Equal(t, "mon1:6789", mons)
+
+	require.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	require.Eventually(t, func() bool {
+		mons, err = Mons(pathToConfig, "cluster-1")
+
+		return err == nil && mons == "mon2:6789"
+	}, watchTimeout, watchInterval)
+}
+
+func TestInvalidateCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	pathToConfig := filepath.Join(t.TempDir(), "config.json")
+	writeMonitorConfig(t, pathToConfig, "mon1:6789")
+
+	// paths that are not watched are not cached
+	_, err := readCSIConfig(pathToConfig)
+	require.NoError(t, err)
+	_, _, cached := getCachedCSIConfig(pathToConfig)
+	require.False(t, cached)
+	InvalidateCSIConfig(pathToConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, WatchCSIConfig(ctx, pathToConfig))
+
+	_, err = readCSIConfig(pathToConfig)
+	require.NoError(t, err)
+	_, _, cached = getCachedCSIConfig(pathToConfig)
+	require.True(t, cached)
+
+	InvalidateCSIConfig(pathToConfig)
+	_, generation, cached := getCachedCSIConfig(pathToConfig)
+	require.False(t, cached)
+
+	// a config that was read before an invalidation is not cached
+	config, err := loadCSIConfig(pathToConfig)
+	require.NoError(t, err)
+	InvalidateCSIConfig(pathToConfig)
+	setCachedCSIConfig(pathToConfig, generation, config)
+	_, _, cached = getCachedCSIConfig(pathToConfig)
+	require.False(t, cached)
+}
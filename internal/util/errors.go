@@ -18,6 +18,7 @@ package util
 
 import (
 	"errors"
+	"regexp"
 )
 
 var (
@@ -36,4 +37,62 @@ var (
 	ErrClusterIDNotSet = errors.New("clusterID must be set")
 	// ErrMissingConfigForMonitor is returned when clusterID is not found for the mon.
 	ErrMissingConfigForMonitor = errors.New("missing configuration of cluster ID for monitor")
+	// ErrOutputTruncated is returned when the output of an executed command
+	// exceeded the maximum size and was truncated.
+	ErrOutputTruncated = errors.New("command output truncated")
+	// ErrCommandAborted is returned when an executed command was killed,
+	// because its stderr matched the pattern to abort on.
+	ErrCommandAborted = errors.New("command aborted")
+	// ErrNoCrushLocationLabels is returned when read affinity is enabled,
+	// but no CRUSH location labels are configured.
+	ErrNoCrushLocationLabels = errors.New("read affinity is enabled without crush location labels")
 )
+
+// redactedValue replaces the secrets in error messages.
+const redactedValue = "***"
+
+// secretPatterns match the secrets that may be part of error messages, like
+// the command line of a Ceph CLI, or the options of a mount command. The
+// first group of each pattern is kept, the rest of the match is redacted.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(--key[= ])[^\s,]+`),
+	regexp.MustCompile(`(\bsecret=)[^\s,]+`),
+	regexp.MustCompile(`(\bkey = )\S+`),
+}
+
+// redactedError is an error with a message from which the secrets have been
+// removed. The original error can still be inspected with errors.Is() and
+// errors.As().
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (re *redactedError) Error() string {
+	return re.msg
+}
+
+func (re *redactedError) Unwrap() error {
+	return re.err
+}
+
+// RedactError returns an error with the secrets in the message of err
+// replaced by "***", so that it is safe to log the error or return it to the
+// user. When the message does not contain secrets, err is returned as is.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	redacted := msg
+	for _, pattern := range secretPatterns {
+		redacted = pattern.ReplaceAllString(redacted, "${1}"+redactedValue)
+	}
+
+	if redacted == msg {
+		return err
+	}
+
+	return &redactedError{msg: redacted, err: err}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRedactError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "key argument",
+			err:  errors.New("failed to run rbd map --id admin --key=AQBxxxx== pool/image"),
+			want: "failed to run rbd map --id admin --key=*** pool/image",
+		},
+		{
+			name: "separate key argument",
+			err:  errors.New("failed to run ceph --key AQBxxxx== status"),
+			want: "failed to run ceph --key *** status",
+		},
+		{
+			name: "secret mount option",
+			err:  errors.New("mount -o name=admin,secret=AQBxxxx==,mds_namespace=fs failed"),
+			want: "mount -o name=admin,secret=***,mds_namespace=fs failed",
+		},
+		{
+			name: "key in keyring",
+			err:  errors.New("invalid keyring: [client.admin]\n\tkey = AQBxxxx==\n"),
+			want: "invalid keyring: [client.admin]\n\tkey = ***\n",
+		},
+		{
+			name: "keyfile is not a secret",
+			err:  errors.New("failed to run ceph --keyfile=/tmp/csi/keys/keyfile-123 status"),
+			want: "failed to run ceph --keyfile=/tmp/csi/keys/keyfile-123 status",
+		},
+		{
+			name: "no secrets",
+			err:  errors.New("image not found"),
+			want: "image not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := RedactError(tt.err)
+			if got.Error() != tt.want {
+				t.Errorf("RedactError() = %q, want %q", got.Error(), tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("RedactError() = %v, does not wrap %v", got, tt.err)
+			}
+		})
+	}
+
+	if err := RedactError(nil); err != nil {
+		t.Errorf("RedactError(nil) = %v, want nil", err)
+	}
+
+	err := RedactError(fmt.Errorf("%w: --key=AQBxxxx==", ErrPoolNotFound))
+	if !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("RedactError() = %v, does not wrap %v", err, ErrPoolNotFound)
+	}
+}
@@ -37,8 +37,34 @@ var CtxKey = contextKey("ID")
 // ReqID for logging request ID.
 var ReqID = contextKey("Req-ID")
 
+// TraceID for logging a trace ID that is shared with other components.
+var TraceID = contextKey("Trace-ID")
+
+// WithTraceID returns a copy of ctx with the trace ID set. The trace ID is
+// included in all context based log messages, including the messages of the
+// commands that are executed for the request, so that they can be
+// correlated with the request in other components.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, TraceID, traceID)
+}
+
+// Verbosity returns the highest log level that is enabled.
+func Verbosity() klog.Level {
+	for level := Trace; level >= Default; level-- {
+		if klog.V(level).Enabled() {
+			return level
+		}
+	}
+
+	return 0
+}
+
 // Log helps in context based logging.
 func Log(ctx context.Context, format string) string {
+	if traceID := ctx.Value(TraceID); traceID != nil {
+		format = fmt.Sprintf("Trace-ID: %v ", traceID) + format
+	}
+
 	id := ctx.Value(CtxKey)
 	if id == nil {
 		return format
@@ -17,6 +17,7 @@ limitations under the License.
 package log
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -44,3 +45,39 @@ func TestGzipLogFile(t *testing.T) {
 
 	os.Remove(newExt)
 }
+
+func TestLogTraceID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "no IDs",
+			ctx:  context.Background(),
+			want: "msg",
+		},
+		{
+			name: "trace ID only",
+			ctx:  WithTraceID(context.Background(), "trace-1"),
+			want: "Trace-ID: trace-1 msg",
+		},
+		{
+			name: "trace ID and request ID",
+			ctx: context.WithValue(
+				context.WithValue(WithTraceID(context.Background(), "trace-1"), CtxKey, 7),
+				ReqID, "pvc-1"),
+			want: "ID: 7 Req-ID: pvc-1 Trace-ID: trace-1 msg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := Log(tt.ctx, "msg"); got != tt.want {
+				t.Errorf("Log() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// monV2Port is the default port of the msgr2 protocol of the monitors.
+	monV2Port = "3300"
+	// monV1Port is the default port of the legacy msgr1 protocol.
+	monV1Port = "6789"
+)
+
+// monitorAddresses returns the host:port addresses that can be used to
+// connect to a monitor. The monitor can be configured as
+//   - "host:port", an IPv6 address needs to be enclosed in brackets
+//   - "host" (an IP-address or DNS name), the default ports are used
+//   - "[v2:host:port,v1:host:port]", the address vector of Ceph
+func monitorAddresses(mon string) []string {
+	if strings.HasPrefix(mon, "[v") && strings.HasSuffix(mon, "]") {
+		var addrs []string
+		for _, addr := range strings.Split(strings.Trim(mon, "[]"), ",") {
+			addr = strings.TrimPrefix(strings.TrimPrefix(addr, "v2:"), "v1:")
+			// strip the nonce, like in "v2:192.168.0.1:3300/0"
+			addr, _, _ = strings.Cut(addr, "/")
+			addrs = append(addrs, addr)
+		}
+
+		return addrs
+	}
+
+	if _, _, err := net.SplitHostPort(mon); err == nil {
+		return []string{mon}
+	}
+
+	host := strings.Trim(mon, "[]")
+
+	return []string{net.JoinHostPort(host, monV2Port), net.JoinHostPort(host, monV1Port)}
+}
+
+// NormalizeMonitors returns the monitors with the default port appended to
+// the monitors that do not have a port. The msgr2 port (3300) is used when
+// preferV2 is set, otherwise the legacy msgr1 port (6789). Monitors with an
+// explicit port and address vectors are returned unmodified.
+func NormalizeMonitors(mons []string, preferV2 bool) []string {
+	port := monV1Port
+	if preferV2 {
+		port = monV2Port
+	}
+
+	normalized := make([]string, 0, len(mons))
+	for _, mon := range mons {
+		if strings.HasPrefix(mon, "[v") && strings.HasSuffix(mon, "]") {
+			normalized = append(normalized, mon)
+
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(mon); err == nil {
+			normalized = append(normalized, mon)
+
+			continue
+		}
+
+		normalized = append(normalized, net.JoinHostPort(strings.Trim(mon, "[]"), port))
+	}
+
+	return normalized
+}
+
+// MergeMons returns the union of the monitors of the override and base
+// lists, with the monitors of override first. A monitor that is listed more
+// than once is only returned the first time it is listed. The "v1:" and "v2:"
+// prefixes and the nonce of the addresses are ignored when comparing the
+// monitors, so "v2:10.0.0.1:3300/0" and "10.0.0.1:3300" are the same monitor.
+func MergeMons(base, override []string) []string {
+	merged := make([]string, 0, len(override)+len(base))
+	seen := make(map[string]bool, len(override)+len(base))
+	for _, mon := range slices.Concat(override, base) {
+		key := monitorKey(mon)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, mon)
+	}
+
+	return merged
+}
+
+// MonsDeduped returns a comma separated MON list from the csi config for the
+// given clusterID, like Mons(), but every monitor is only listed once. The
+// monitors are compared by their addresses, ignoring the "v1:" and "v2:"
+// prefixes and nonces. A monitor that shares an address with a monitor that
+// was listed before it, like "10.0.0.1:6789" after "10.0.0.1" (which uses
+// both default ports) or "[v2:10.0.0.1:3300,v1:10.0.0.1:6789]", is a
+// duplicate as well.
+func MonsDeduped(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(cluster.Monitors) == 0 {
+		return "", fmt.Errorf("empty monitor list for cluster ID (%s) in config", clusterID)
+	}
+
+	mons := dedupMons(cluster.Monitors)
+	if cluster.PreferMsgr2 {
+		mons = NormalizeMonitors(mons, true)
+	}
+
+	return strings.Join(mons, ","), nil
+}
+
+// dedupMons returns the monitors without the ones that share an address with
+// a monitor listed before them.
+func dedupMons(mons []string) []string {
+	deduped := make([]string, 0, len(mons))
+	seen := make(map[string]bool, len(mons))
+	for _, mon := range mons {
+		addrs := strings.Split(monitorKey(mon), ",")
+		if slices.ContainsFunc(addrs, func(addr string) bool { return seen[addr] }) {
+			continue
+		}
+		for _, addr := range addrs {
+			seen[addr] = true
+		}
+		deduped = append(deduped, mon)
+	}
+
+	return deduped
+}
+
+// monitorKey returns the addresses of the monitor without the "v1:" and "v2:"
+// prefixes and nonces, sorted and joined, to compare monitors that are
+// written in different notations.
+func monitorKey(mon string) string {
+	addr := strings.TrimPrefix(strings.TrimPrefix(mon, "v2:"), "v1:")
+	if addr != mon {
+		// a single prefixed address, like "v2:192.168.0.1:3300/0"
+		addr, _, _ = strings.Cut(addr, "/")
+
+		return addr
+	}
+
+	addrs := monitorAddresses(mon)
+	slices.Sort(addrs)
+
+	return strings.Join(addrs, ",")
+}
+
+// ProbeMonitors checks if any of the monitors of the cluster with the given
+// clusterID accepts TCP connections within the timeout. An error that
+// contains the failure for each of the monitor addresses is returned when
+// none of the monitors can be reached.
+func ProbeMonitors(ctx context.Context, pathToConfig, clusterID string, timeout time.Duration) error {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return err
+	}
+
+	if len(cluster.Monitors) == 0 {
+		return fmt.Errorf("empty monitor list for cluster ID (%s) in config", clusterID)
+	}
+
+	var addrs []string
+	for _, mon := range cluster.Monitors {
+		addrs = append(addrs, monitorAddresses(mon)...)
+	}
+
+	return probeAddresses(ctx, addrs, timeout)
+}
+
+// probeAddresses dials all addresses concurrently, and returns nil as soon as
+// one of the addresses accepted the connection.
+func probeAddresses(ctx context.Context, addrs []string, timeout time.Duration) error {
+	pctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make(chan error, len(addrs))
+	dialer := &net.Dialer{}
+	for _, addr := range addrs {
+		go func() {
+			conn, err := dialer.DialContext(pctx, "tcp", addr)
+			if err != nil {
+				results <- fmt.Errorf("monitor %q is not reachable: %w", addr, err)
+
+				return
+			}
+			_ = conn.Close()
+			results <- nil
+		}()
+	}
+
+	errs := make([]error, 0, len(addrs))
+	for range addrs {
+		err := <-results
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	return fmt.Errorf("none of the monitors is reachable: %w", errors.Join(errs...))
+}
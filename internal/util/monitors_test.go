@@ -0,0 +1,322 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorAddresses(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mon  string
+		want []string
+	}{
+		{"10.0.0.1:6789", []string{"10.0.0.1:6789"}},
+		{"10.0.0.1", []string{"10.0.0.1:3300", "10.0.0.1:6789"}},
+		{"mon-a.rook-ceph.svc", []string{"mon-a.rook-ceph.svc:3300", "mon-a.rook-ceph.svc:6789"}},
+		{"[fd00::1]:3300", []string{"[fd00::1]:3300"}},
+		{"[fd00::1]", []string{"[fd00::1]:3300", "[fd00::1]:6789"}},
+		{"[v2:10.0.0.1:3300/0,v1:10.0.0.1:6789/0]", []string{"10.0.0.1:3300", "10.0.0.1:6789"}},
+		{"[v2:[fd00::1]:3300,v1:[fd00::1]:6789]", []string{"[fd00::1]:3300", "[fd00::1]:6789"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mon, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, monitorAddresses(tt.mon))
+		})
+	}
+}
+
+func TestNormalizeMonitors(t *testing.T) {
+	t.Parallel()
+
+	mons := []string{
+		"10.0.0.1",
+		"10.0.0.2:6789",
+		"10.0.0.3:3300",
+		"fd00::1",
+		"[fd00::2]",
+		"[fd00::3]:6789",
+		"mon-a.rook-ceph.svc",
+		"[v2:10.0.0.4:3300/0,v1:10.0.0.4:6789/0]",
+	}
+
+	tests := []struct {
+		name     string
+		preferV2 bool
+		want     []string
+	}{
+		{
+			name:     "prefer msgr2",
+			preferV2: true,
+			want: []string{
+				"10.0.0.1:3300",
+				"10.0.0.2:6789",
+				"10.0.0.3:3300",
+				"[fd00::1]:3300",
+				"[fd00::2]:3300",
+				"[fd00::3]:6789",
+				"mon-a.rook-ceph.svc:3300",
+				"[v2:10.0.0.4:3300/0,v1:10.0.0.4:6789/0]",
+			},
+		},
+		{
+			name:     "prefer msgr1",
+			preferV2: false,
+			want: []string{
+				"10.0.0.1:6789",
+				"10.0.0.2:6789",
+				"10.0.0.3:3300",
+				"[fd00::1]:6789",
+				"[fd00::2]:6789",
+				"[fd00::3]:6789",
+				"mon-a.rook-ceph.svc:6789",
+				"[v2:10.0.0.4:3300/0,v1:10.0.0.4:6789/0]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, NormalizeMonitors(mons, tt.preferV2))
+		})
+	}
+}
+
+// closedAddress returns an address on which no process is listening.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	return addr
+}
+
+func TestProbeMonitors(t *testing.T) {
+	t.Parallel()
+
+	// the listener acts as a monitor that accepts connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, aErr := l.Accept()
+			if aErr != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	live := l.Addr().String()
+	dead := closedAddress(t)
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{ClusterID: "live", Monitors: []string{live}},
+		{ClusterID: "dead", Monitors: []string{dead}},
+		{ClusterID: "mixed", Monitors: []string{dead, live}},
+		{ClusterID: "empty"},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	require.NoError(t, err)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	require.NoError(t, os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600))
+
+	tests := []struct {
+		clusterID string
+		wantErr   bool
+	}{
+		{"live", false},
+		{"dead", true},
+		{"mixed", false},
+		{"empty", true},
+		{"unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clusterID, func(t *testing.T) {
+			t.Parallel()
+
+			err := ProbeMonitors(context.TODO(), tmpConfPath, tt.clusterID, time.Second)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("error contains all monitors", func(t *testing.T) {
+		t.Parallel()
+
+		other := closedAddress(t)
+		err := probeAddresses(context.TODO(), []string{dead, other}, time.Second)
+		require.ErrorContains(t, err, dead)
+		require.ErrorContains(t, err, other)
+	})
+}
+
+func TestMergeMons(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		base     []string
+		override []string
+		want     []string
+	}{
+		{
+			name:     "disjoint",
+			base:     []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+			override: []string{"10.0.0.3:6789"},
+			want:     []string{"10.0.0.3:6789", "10.0.0.1:6789", "10.0.0.2:6789"},
+		},
+		{
+			name:     "overlapping",
+			base:     []string{"10.0.0.1:3300", "10.0.0.2:3300", "[v2:10.0.0.4:3300/0,v1:10.0.0.4:6789/0]"},
+			override: []string{"10.0.0.3:3300", "v2:10.0.0.2:3300/0", "[v1:10.0.0.4:6789,v2:10.0.0.4:3300]"},
+			want: []string{
+				"10.0.0.3:3300",
+				"v2:10.0.0.2:3300/0",
+				"[v1:10.0.0.4:6789,v2:10.0.0.4:3300]",
+				"10.0.0.1:3300",
+			},
+		},
+		{
+			name:     "identical",
+			base:     []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+			override: []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+			want:     []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+		},
+		{
+			name:     "duplicates within a list",
+			base:     []string{"10.0.0.1", "10.0.0.1"},
+			override: nil,
+			want:     []string{"10.0.0.1"},
+		},
+		{
+			name:     "empty",
+			base:     nil,
+			override: nil,
+			want:     []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, MergeMons(tt.base, tt.override))
+		})
+	}
+}
+
+func TestMonsDeduped(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "duplicates",
+			Monitors: []string{
+				"10.0.0.1:6789",
+				"10.0.0.1:6789",
+				"10.0.0.2",
+				"10.0.0.2:6789",
+				"v1:10.0.0.2:6789/0",
+				"[v2:10.0.0.3:3300/0,v1:10.0.0.3:6789/0]",
+				"[v1:10.0.0.3:6789,v2:10.0.0.3:3300]",
+				"10.0.0.3:6789",
+				"v2:10.0.0.3:3300",
+			},
+		},
+		{
+			ClusterID:   "msgr2",
+			Monitors:    []string{"10.0.0.1", "10.0.0.1:3300", "10.0.0.1:6789"},
+			PreferMsgr2: true,
+		},
+		{
+			ClusterID: "unique",
+			Monitors:  []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+		},
+		{
+			ClusterID: "empty",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	require.NoError(t, err)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	require.NoError(t, os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600))
+
+	tests := []struct {
+		clusterID string
+		want      string
+		wantErr   bool
+	}{
+		{
+			clusterID: "duplicates",
+			want:      "10.0.0.1:6789,10.0.0.2,[v2:10.0.0.3:3300/0,v1:10.0.0.3:6789/0]",
+		},
+		{
+			clusterID: "msgr2",
+			want:      "10.0.0.1:3300",
+		},
+		{
+			clusterID: "unique",
+			want:      "10.0.0.1:6789,10.0.0.2:6789",
+		},
+		{
+			clusterID: "empty",
+			wantErr:   true,
+		},
+		{
+			clusterID: "unknown",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clusterID, func(t *testing.T) {
+			t.Parallel()
+			got, err := MonsDeduped(tmpConfPath, tt.clusterID)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	// Mons is not deduplicated
+	mons, err := Mons(tmpConfPath, "duplicates")
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(csiConfig[0].Monitors, ","), mons)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PoolStats contains the capacity of a pool. The sizes are the logical
+// sizes of the data, replication or erasure coding is not included.
+type PoolStats struct {
+	// TotalBytes is the sum of UsedBytes and AvailableBytes
+	TotalBytes uint64
+	// UsedBytes is the size of the data that is stored in the pool
+	UsedBytes uint64
+	// AvailableBytes is the size of the data that can still be stored in
+	// the pool
+	AvailableBytes uint64
+}
+
+// cephDF is the output of `ceph df -f json`.
+type cephDF struct {
+	Pools []cephDFPool `json:"pools"`
+}
+
+// cephDFPool is a pool in the output of `ceph df -f json`.
+type cephDFPool struct {
+	Name  string `json:"name"`
+	Stats struct {
+		Stored   uint64 `json:"stored"`
+		MaxAvail uint64 `json:"max_avail"`
+	} `json:"stats"`
+}
+
+// poolStatsFromDF returns the PoolStats of the pool in the output of ceph df.
+// An error wrapping ErrPoolNotFound is returned when the pool is missing.
+func poolStatsFromDF(df *cephDF, pool string) (*PoolStats, error) {
+	for _, p := range df.Pools {
+		if p.Name != pool {
+			continue
+		}
+
+		return &PoolStats{
+			TotalBytes:     p.Stats.Stored + p.Stats.MaxAvail,
+			UsedBytes:      p.Stats.Stored,
+			AvailableBytes: p.Stats.MaxAvail,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrPoolNotFound, pool)
+}
+
+// GetPoolStats returns the capacity of the pool in the cluster with the given
+// clusterID, as reported by `ceph df`. The returned error wraps
+// ErrPoolNotFound when the pool does not exist.
+func GetPoolStats(
+	ctx context.Context,
+	timeout time.Duration,
+	clusterID, pool string,
+	cr *Credentials,
+) (*PoolStats, error) {
+	monitors, err := Mons(CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monitors for cluster ID %q: %w", clusterID, err)
+	}
+
+	confFile, err := GetEffectiveCephConfFile(CsiConfigFile, clusterID, monitors)
+	if err != nil {
+		return nil, err
+	}
+
+	df, err := ExecCommandJSON[cephDF](
+		ctx,
+		timeout,
+		"ceph",
+		"df",
+		"-m", monitors,
+		"--id", cr.ID,
+		"--keyfile="+cr.KeyFile,
+		"-c", confFile,
+		"-f", "json",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the usage of cluster ID %q: %w", clusterID, err)
+	}
+
+	stats, err := poolStatsFromDF(&df, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the usage in cluster ID %q: %w", clusterID, err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const cephDFOutput = `{
+  "stats": {
+    "total_bytes": 32212254720,
+    "total_avail_bytes": 31130390528,
+    "total_used_bytes": 1081864192,
+    "total_used_raw_bytes": 1081864192,
+    "total_used_raw_ratio": 0.033585608005523682,
+    "num_osds": 3,
+    "num_per_pool_osds": 3,
+    "num_per_pool_omap_osds": 3
+  },
+  "stats_by_class": {
+    "hdd": {
+      "total_bytes": 32212254720,
+      "total_avail_bytes": 31130390528,
+      "total_used_bytes": 1081864192,
+      "total_used_raw_bytes": 1081864192,
+      "total_used_raw_ratio": 0.033585608005523682
+    }
+  },
+  "pools": [
+    {
+      "name": ".mgr",
+      "id": 1,
+      "stats": {
+        "stored": 459280,
+        "objects": 2,
+        "kb_used": 1348,
+        "bytes_used": 1380352,
+        "percent_used": 4.6864298928994685e-05,
+        "max_avail": 9817981952
+      }
+    },
+    {
+      "name": "replicapool",
+      "id": 2,
+      "stats": {
+        "stored": 347214669,
+        "objects": 103,
+        "kb_used": 1017228,
+        "bytes_used": 1041641472,
+        "percent_used": 0.034160025417804718,
+        "max_avail": 9817981952
+      }
+    }
+  ]
+}`
+
+func TestPoolStatsFromDF(t *testing.T) {
+	t.Parallel()
+
+	var df cephDF
+	require.NoError(t, json.Unmarshal([]byte(cephDFOutput), &df))
+
+	t.Run("existing pool", func(t *testing.T) {
+		t.Parallel()
+		stats, err := poolStatsFromDF(&df, "replicapool")
+		require.NoError(t, err)
+		require.Equal(t, &PoolStats{
+			TotalBytes:     347214669 + 9817981952,
+			UsedBytes:      347214669,
+			AvailableBytes: 9817981952,
+		}, stats)
+	})
+
+	t.Run("missing pool", func(t *testing.T) {
+		t.Parallel()
+		_, err := poolStatsFromDF(&df, "ecpool")
+		require.ErrorIs(t, err, ErrPoolNotFound)
+		require.ErrorContains(t, err, "ecpool")
+	})
+
+	t.Run("no pools", func(t *testing.T) {
+		t.Parallel()
+		_, err := poolStatsFromDF(&cephDF{}, "replicapool")
+		require.ErrorIs(t, err, ErrPoolNotFound)
+	})
+}
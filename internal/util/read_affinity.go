@@ -19,8 +19,51 @@ package util
 import (
 	"fmt"
 	"strings"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
 )
 
+// ValidateReadAffinity checks that crush location labels are available when
+// read affinity is enabled. Without labels in the read affinity options, the
+// cliCrushLocationLabels from the command line are used. When neither is set,
+// the CRUSH location of the node is empty, and reading from the nearest
+// replica has no effect. Labels that are empty are rejected as well.
+func ValidateReadAffinity(readAffinity *kubernetes.ReadAffinity, cliCrushLocationLabels string) error {
+	if !readAffinity.Enabled {
+		return nil
+	}
+
+	if len(readAffinity.CrushLocationLabels) == 0 && cliCrushLocationLabels == "" {
+		return ErrNoCrushLocationLabels
+	}
+
+	for i, label := range readAffinity.CrushLocationLabels {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("empty crush location label at index %d", i)
+		}
+	}
+
+	return nil
+}
+
+// ValidateReadAffinityConfig runs ValidateReadAffinity for the read affinity
+// options of all clusters in the CSI config at pathToConfig.
+func ValidateReadAffinityConfig(pathToConfig, cliCrushLocationLabels string) error {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return fmt.Errorf("failed to read CSI config %q: %w", pathToConfig, err)
+	}
+
+	for i := range config {
+		err = ValidateReadAffinity(&config[i].ReadAffinity, cliCrushLocationLabels)
+		if err != nil {
+			return fmt.Errorf("invalid readAffinity for cluster ID %q: %w", config[i].ClusterID, err)
+		}
+	}
+
+	return nil
+}
+
 // ConstructReadAffinityMapOption constructs a read affinity map option based on the provided crushLocationMap.
 // It appends crush location labels in the format
 // "read_from_replica=localize,crush_location=label1:value1|label2:value2|...".
@@ -46,7 +89,8 @@ func ConstructReadAffinityMapOption(crushLocationMap map[string]string) string {
 
 // GetReadAffinityMapOptions retrieves the readAffinityMapOptions from the CSI config file if it exists.
 // If not, it falls back to returning the `cliReadAffinityMapOptions` from the command line.
-// If neither of these options is available, it returns an empty string.
+// If neither of these options is available, it returns an empty string. Such a configuration is
+// rejected by ValidateReadAffinityConfig when the driver starts.
 func GetReadAffinityMapOptions(
 	csiConfigFile, clusterID, cliReadAffinityMapOptions string,
 	nodeLabels map[string]string,
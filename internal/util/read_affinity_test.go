@@ -17,8 +17,11 @@ limitations under the License.
 package util
 
 import (
+	"os"
 	"testing"
 
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -65,3 +68,103 @@ func TestReadAffinity_ConstructReadAffinityMapOption(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateReadAffinity(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                   string
+		readAffinity           kubernetes.ReadAffinity
+		cliCrushLocationLabels string
+		wantErr                bool
+	}{
+		{
+			name: "enabled with labels",
+			readAffinity: kubernetes.ReadAffinity{
+				Enabled:             true,
+				CrushLocationLabels: []string{"topology.kubernetes.io/region", "topology.kubernetes.io/zone"},
+			},
+		},
+		{
+			name: "disabled with labels",
+			readAffinity: kubernetes.ReadAffinity{
+				CrushLocationLabels: []string{"topology.io/rack"},
+			},
+		},
+		{
+			name: "disabled without labels",
+		},
+		{
+			name: "enabled without labels",
+			readAffinity: kubernetes.ReadAffinity{
+				Enabled: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "enabled without labels, with labels on the command line",
+			readAffinity: kubernetes.ReadAffinity{
+				Enabled: true,
+			},
+			cliCrushLocationLabels: "topology.kubernetes.io/zone",
+		},
+		{
+			name: "enabled with an empty label",
+			readAffinity: kubernetes.ReadAffinity{
+				Enabled:             true,
+				CrushLocationLabels: []string{"topology.kubernetes.io/region", " "},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateReadAffinity(&tt.readAffinity, tt.cliCrushLocationLabels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReadAffinity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetReadAffinityMapOptionsWithoutLabels(t *testing.T) {
+	t.Parallel()
+
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err := os.WriteFile(tmpConfPath, []byte(`[{"clusterID": "cluster-1", "readAffinity": {"enabled": true}}]`), 0o600)
+	require.NoError(t, err)
+
+	// the options of the command line are used
+	cliOptions := "read_from_replica=localize,crush_location=zone:east-1"
+	options, err := GetReadAffinityMapOptions(tmpConfPath, "cluster-1", cliOptions, nil)
+	require.NoError(t, err)
+	require.Equal(t, cliOptions, options)
+
+	// without any labels, no options are used
+	options, err = GetReadAffinityMapOptions(tmpConfPath, "cluster-1", "", nil)
+	require.NoError(t, err)
+	require.Empty(t, options)
+}
+
+func TestValidateReadAffinityConfig(t *testing.T) {
+	t.Parallel()
+
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err := os.WriteFile(tmpConfPath, []byte(`[
+		{"clusterID": "cluster-1", "readAffinity": {"enabled": true, "crushLocationLabels": ["zone"]}},
+		{"clusterID": "cluster-2", "readAffinity": {"enabled": true}}
+	]`), 0o600)
+	require.NoError(t, err)
+
+	// enabled without any labels is rejected
+	err = ValidateReadAffinityConfig(tmpConfPath, "")
+	require.ErrorIs(t, err, ErrNoCrushLocationLabels)
+	require.ErrorContains(t, err, "cluster-2")
+
+	// the labels of the command line are used for cluster-2
+	err = ValidateReadAffinityConfig(tmpConfPath, "zone,rack")
+	require.NoError(t, err)
+
+	err = ValidateReadAffinityConfig(t.TempDir()+"/missing.json", "")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
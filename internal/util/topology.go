@@ -112,6 +112,54 @@ func GetTopologyFromDomainLabels(domainLabels, nodeName, driverName string) (map
 	return topology, nil
 }
 
+// strictTopologySegments makes BuildTopologySegments fail when a label is
+// missing on the node.
+var strictTopologySegments bool
+
+// SetStrictTopologySegments configures whether BuildTopologySegments reports
+// labels that are missing on the node as an error, instead of leaving them
+// out of the topology.
+func SetStrictTopologySegments(strict bool) {
+	strictTopologySegments = strict
+}
+
+// BuildTopologySegments returns the topology segments for the node, that can
+// be reported in the AccessibleTopology of NodeGetInfo. The segments contain
+// the labels, as returned by GetCrushLocationLabels, that are set on the node
+// with a non-empty value. Other node labels are not included. In strict mode,
+// see SetStrictTopologySegments, a label that is missing on the node is an
+// error.
+func BuildTopologySegments(labels []string, nodeLabels map[string]string) (map[string]string, error) {
+	return buildTopologySegments(labels, nodeLabels, strictTopologySegments)
+}
+
+// buildTopologySegments implements BuildTopologySegments, strict reports
+// missing labels as an error.
+func buildTopologySegments(labels []string, nodeLabels map[string]string, strict bool) (map[string]string, error) {
+	segments := make(map[string]string, len(labels))
+	missing := []string{}
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+
+		value := nodeLabels[label]
+		if value == "" {
+			missing = append(missing, label)
+
+			continue
+		}
+		segments[label] = value
+	}
+
+	if strict && len(missing) != 0 {
+		return nil, fmt.Errorf("missing topology labels %v on node", missing)
+	}
+
+	return segments, nil
+}
+
 type topologySegment struct {
 	DomainLabel string `json:"domainLabel"`
 	DomainValue string `json:"value"`
@@ -18,6 +18,7 @@ package util
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -332,6 +333,81 @@ func TestFindPoolAndTopology(t *testing.T) {
 	checkAndReportError(t, "expected success got:", err)
 }
 
+func TestBuildTopologySegments(t *testing.T) {
+	t.Parallel()
+
+	nodeLabels := map[string]string{
+		"topology.kubernetes.io/region": "east",
+		"topology.kubernetes.io/zone":   "east-1",
+		"kubernetes.io/hostname":        "worker1",
+		"rack":                          "",
+	}
+
+	tests := []struct {
+		name    string
+		labels  []string
+		strict  bool
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "all labels present",
+			labels: []string{"topology.kubernetes.io/region", "topology.kubernetes.io/zone"},
+			want: map[string]string{
+				"topology.kubernetes.io/region": "east",
+				"topology.kubernetes.io/zone":   "east-1",
+			},
+		},
+		{
+			name:   "partial labels present",
+			labels: []string{"topology.kubernetes.io/zone", "rack", "row"},
+			want: map[string]string{
+				"topology.kubernetes.io/zone": "east-1",
+			},
+		},
+		{
+			name:   "no labels",
+			labels: nil,
+			want:   map[string]string{},
+		},
+		{
+			name:   "strict with all labels present",
+			labels: []string{"kubernetes.io/hostname", ""},
+			strict: true,
+			want: map[string]string{
+				"kubernetes.io/hostname": "worker1",
+			},
+		},
+		{
+			name:    "strict with missing label",
+			labels:  []string{"topology.kubernetes.io/zone", "row"},
+			strict:  true,
+			wantErr: true,
+		},
+		{
+			name:    "strict with empty label value",
+			labels:  []string{"rack"},
+			strict:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := buildTopologySegments(tt.labels, nodeLabels, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildTopologySegments() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("buildTopologySegments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 /*
 // TODO: To test GetTopologyFromDomainLabels we need it to accept a k8s client interface, to mock k8sGetNdeLabels output
 func TestGetTopologyFromDomainLabels(t *testing.T) {
@@ -152,6 +152,12 @@ type Config struct {
 	// Read affinity related options
 	EnableReadAffinity  bool   // enable OSD read affinity.
 	CrushLocationLabels string // list of CRUSH location labels to read from the node.
+
+	// CSI config related options
+	ExpandConfigPaths bool // expand environment variables in paths of the CSI config.
+	StrictConfigPaths bool // fail the expansion of paths with unset environment variables.
+	ValidateCephConf  bool // fail when the cephConfFile of a cluster does not exist.
+	WatchCSIConfig    bool // cache the CSI config, and reload it when it changes.
 }
 
 // ValidateDriverName validates the driver name.